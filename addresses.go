@@ -0,0 +1,273 @@
+package mobilewallet
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrwallet/wallet"
+	"github.com/decred/dcrwallet/wallet/udb"
+)
+
+// addressLabelPrefix begins the metadata keys of address labels, which are
+// followed by the encoded address.
+const addressLabelPrefix = "addresslabel:"
+
+// Address is an address of an account listed by ListAddresses.  Received is
+// the total amount the wallet has received to the address, and Used is set if
+// any transaction paid to it.
+type Address struct {
+	Address  string
+	Index    int32
+	Used     bool
+	Received int64
+	Label    string
+}
+
+// AddressList is a page of the addresses of an account branch.  Count is the
+// number of addresses of the branch handed out so far, which ListAddresses
+// pages through.
+type AddressList struct {
+	Account   int32
+	Branch    int32
+	Count     int32
+	Addresses []Address
+}
+
+// ListAddresses returns the JSON encoded AddressList of up to limit addresses
+// of an account, beginning at the child index offset.  branch is 0 for the
+// external branch, which receives payments, and 1 for the internal branch,
+// which receives change.  Only addresses that have been handed out by
+// CurrentAddress, NextAddress or transaction creation are listed.
+func (lw *LibWallet) ListAddresses(account, branch, offset, limit int32) (string, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return "", newWalletError(ErrWalletNotLoaded)
+	}
+	if account < 0 || (branch != 0 && branch != 1) || offset < 0 || limit < 0 {
+		return "", newWalletError(ErrInvalid)
+	}
+
+	extCount, intCount, err := lw.accountKeyCounts(uint32(account))
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	count := uint32(extCount)
+	if branch == 1 {
+		count = uint32(intCount)
+	}
+
+	list := &AddressList{
+		Account:   account,
+		Branch:    branch,
+		Count:     int32(count),
+		Addresses: make([]Address, 0),
+	}
+	start := uint32(offset)
+	end := start + uint32(limit)
+	if end > count || end < start {
+		end = count
+	}
+	if start >= end {
+		result, err := json.Marshal(list)
+		if err != nil {
+			log.Error(err)
+			return "", translateError(err)
+		}
+		return string(result), nil
+	}
+
+	addrs, err := lw.wallet.AccountBranchAddressRange(uint32(account), uint32(branch), start, end)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	encodedAddrs := make([]string, len(addrs))
+	for i, addr := range addrs {
+		encodedAddrs[i] = addr.EncodeAddress()
+	}
+	received, err := lw.receivedByAddress(uint32(account), encodedAddrs)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	for i, encoded := range encodedAddrs {
+		label, err := lw.readMetadata([]byte(addressLabelPrefix + encoded))
+		if err != nil {
+			log.Error(err)
+			return "", translateError(err)
+		}
+		amount, used := received[encoded]
+		list.Addresses = append(list.Addresses, Address{
+			Address:  encoded,
+			Index:    int32(start) + int32(i),
+			Used:     used,
+			Received: int64(amount),
+			Label:    string(label),
+		})
+	}
+
+	result, err := json.Marshal(list)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+// receivedCache holds the total amount received by each address of each
+// account in transactions mined up to the block tipHash at tipHeight, so that
+// ListAddresses only reads the transactions of newer blocks.  It is cleared
+// when a rescan finishes, as rescans add transactions of older blocks.
+type receivedCache struct {
+	mu        sync.Mutex
+	wallet    *wallet.Wallet
+	tipHash   chainhash.Hash
+	tipHeight int32
+	accounts  map[uint32]map[string]dcrutil.Amount
+}
+
+// receivedByAddress returns the total amount received by each of addresses of
+// an account, including unmined transactions.  Addresses that never received a
+// payment are not included.
+func (lw *LibWallet) receivedByAddress(account uint32, addresses []string) (map[string]dcrutil.Amount, error) {
+	ctx := contextWithShutdownCancel(context.Background())
+	c := &lw.received
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.accounts != nil && c.wallet == lw.wallet {
+		// Blocks after a reorganized block must be read again.
+		info, err := lw.wallet.BlockInfo(wallet.NewBlockIdentifierFromHeight(c.tipHeight))
+		if err != nil || info.Hash != c.tipHash {
+			c.accounts = nil
+		}
+	}
+	if c.accounts == nil || c.wallet != lw.wallet {
+		c.wallet = lw.wallet
+		c.tipHeight = -1
+		c.accounts = make(map[uint32]map[string]dcrutil.Amount)
+	}
+
+	addCredits := func(accounts map[uint32]map[string]dcrutil.Amount) func(*wallet.Block) (bool, error) {
+		return func(block *wallet.Block) (bool, error) {
+			for _, transaction := range block.Transactions {
+				for _, credit := range transaction.MyOutputs {
+					if credit.Address == nil {
+						continue
+					}
+					received := accounts[credit.Account]
+					if received == nil {
+						received = make(map[string]dcrutil.Amount)
+						accounts[credit.Account] = received
+					}
+					received[credit.Address.EncodeAddress()] += credit.Amount
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return true, ctx.Err()
+			default:
+				return false, nil
+			}
+		}
+	}
+
+	tipHash, tipHeight := lw.wallet.MainChainTip()
+	if c.tipHeight < tipHeight {
+		// Newer blocks are added to a copy so that a failed read leaves
+		// the cache as it was.
+		accounts := make(map[uint32]map[string]dcrutil.Amount, len(c.accounts))
+		for a, received := range c.accounts {
+			accounts[a] = make(map[string]dcrutil.Amount, len(received))
+			for addr, amount := range received {
+				accounts[a][addr] = amount
+			}
+		}
+		err := lw.wallet.GetTransactions(addCredits(accounts),
+			wallet.NewBlockIdentifierFromHeight(c.tipHeight+1),
+			wallet.NewBlockIdentifierFromHeight(tipHeight))
+		if err != nil {
+			return nil, err
+		}
+		c.accounts = accounts
+		c.tipHash = tipHash
+		c.tipHeight = tipHeight
+	}
+
+	// Unmined transactions are read on every call.  The height -1 selects
+	// them without any block.
+	unmined := make(map[uint32]map[string]dcrutil.Amount)
+	err := lw.wallet.GetTransactions(addCredits(unmined),
+		wallet.NewBlockIdentifierFromHeight(-1),
+		wallet.NewBlockIdentifierFromHeight(-1))
+	if err != nil {
+		return nil, err
+	}
+
+	received := make(map[string]dcrutil.Amount)
+	for _, addr := range addresses {
+		mined, minedOk := c.accounts[account][addr]
+		pending, unminedOk := unmined[account][addr]
+		if minedOk || unminedOk {
+			received[addr] = mined + pending
+		}
+	}
+	return received, nil
+}
+
+// clearReceivedCache forgets the amounts cached by receivedByAddress.
+func (lw *LibWallet) clearReceivedCache() {
+	lw.received.mu.Lock()
+	lw.received.accounts = nil
+	lw.received.mu.Unlock()
+}
+
+// SetAddressLabel records a label for an address of the wallet, which is
+// returned by ListAddresses.  An empty label removes the address's label.
+func (lw *LibWallet) SetAddressLabel(address string, label string) error {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return newWalletError(ErrWalletNotLoaded)
+	}
+	addr, err := decodeAddress(address, lw.wallet.ChainParams())
+	if err != nil {
+		return newWalletError(ErrInvalidAddress)
+	}
+	have, err := lw.wallet.HaveAddress(addr)
+	if err != nil {
+		log.Error(err)
+		return translateError(err)
+	}
+	if !have {
+		return newWalletError(ErrNotExist)
+	}
+
+	key := []byte(addressLabelPrefix + addr.EncodeAddress())
+	if label == "" {
+		err = lw.deleteMetadata(key)
+	} else {
+		err = lw.writeMetadata(key, []byte(label))
+	}
+	if err != nil {
+		log.Error(err)
+		return translateError(err)
+	}
+	return nil
+}
+
+// accountKeyCounts returns the number of external and internal addresses of an
+// account that have been handed out.  The external address returned by
+// CurrentAddress is counted, as it is shown before it is used.  The imported
+// account has no branches.
+func (lw *LibWallet) accountKeyCounts(account uint32) (external, internal int32, err error) {
+	if account == udb.ImportedAddrAccount {
+		return 0, 0, nil
+	}
+	ext, in, err := lw.wallet.BIP0044BranchNextIndexes(account)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int32(ext) + 1, int32(in), nil
+}
@@ -0,0 +1,192 @@
+package mobilewallet
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/gcs/blockcf"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/decred/dcrwallet/wallet"
+	"github.com/decred/dcrwallet/wallet/udb"
+)
+
+func TestAccountKeyCounts(t *testing.T) {
+	lw, dir := newTestWallet(t, "bdb")
+	defer os.RemoveAll(dir)
+	defer lw.CloseWallet()
+
+	external, internal, err := lw.accountKeyCounts(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The current address is counted before it is used.
+	if external != 1 || internal != 0 {
+		t.Errorf("new account has %d external and %d internal addresses, want 1 and 0",
+			external, internal)
+	}
+	if _, err := lw.CurrentAddress(0); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := lw.NextAddress(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	external, internal, err = lw.accountKeyCounts(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if external != 3 || internal != 0 {
+		t.Errorf("account has %d external and %d internal addresses, want 3 and 0",
+			external, internal)
+	}
+
+	external, internal, err = lw.accountKeyCounts(udb.ImportedAddrAccount)
+	if err != nil || external != 0 || internal != 0 {
+		t.Errorf("imported account has %d external and %d internal addresses (%v)",
+			external, internal, err)
+	}
+	if _, _, err := lw.accountKeyCounts(1); err == nil {
+		t.Errorf("accountKeyCounts of a missing account succeeded")
+	}
+}
+
+// testChain adds blocks to the main chain of a wallet as the SPV syncer does.
+type testChain struct {
+	t      *testing.T
+	w      *wallet.Wallet
+	forest wallet.SidechainForest
+	txs    map[chainhash.Hash][]*wire.MsgTx
+}
+
+// extend adds a block holding txs after parent and switches the main chain to
+// it when it has the most work.  nonce tells apart blocks that compete at the
+// same height.
+func (c *testChain) extend(parent *wire.BlockHeader, nonce uint32, txs ...*wire.MsgTx) *wire.BlockHeader {
+	// Filters of blocks without outputs cannot be built, so every block
+	// has a coinbase paying nothing.  Blocks approve their parent so that
+	// its regular transactions stay valid.
+	coinbase := wire.NewMsgTx()
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex,
+		wire.TxTreeRegular), 0, nil))
+	coinbase.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+	block := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   parent.Version,
+			PrevBlock: parent.BlockHash(),
+			VoteBits:  dcrutil.BlockValid,
+			Bits:      c.w.ChainParams().PowLimitBits,
+			Height:    parent.Height + 1,
+			Timestamp: parent.Timestamp.Add(time.Minute),
+			Nonce:     nonce,
+		},
+		Transactions: append([]*wire.MsgTx{coinbase}, txs...),
+	}
+	filter, err := blockcf.Regular(block)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	hash := block.BlockHash()
+	c.txs[hash] = txs
+	c.forest.AddBlockNode(wallet.NewBlockNode(&block.Header, &hash, filter))
+
+	chain, err := c.w.EvaluateBestChain(&c.forest)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if len(chain) == 0 {
+		return &block.Header
+	}
+	relevant := make(map[chainhash.Hash][]*wire.MsgTx)
+	for _, n := range chain {
+		relevant[*n.Hash] = c.txs[*n.Hash]
+	}
+	detached, err := c.w.ChainSwitch(&c.forest, chain, relevant)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.forest.PruneTree(chain[0].Hash)
+	for _, n := range detached {
+		c.forest.AddBlockNode(n)
+	}
+	return &block.Header
+}
+
+func TestReceivedCacheReorg(t *testing.T) {
+	lw, dir := newTestWallet(t, "bdb")
+	defer os.RemoveAll(dir)
+	defer lw.CloseWallet()
+
+	// Transactions paying to the current address are only recorded once
+	// it is returned by NextAddress.
+	address, err := lw.NextAddress(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := dcrutil.DecodeAddress(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment := func(prevHash chainhash.Hash, amount int64) *wire.MsgTx {
+		tx := wire.NewMsgTx()
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0, wire.TxTreeRegular), amount+1e5, nil))
+		tx.AddTxOut(wire.NewTxOut(amount, pkScript))
+		return tx
+	}
+	checkReceived := func(step string, want dcrutil.Amount) {
+		received, err := lw.receivedByAddress(0, []string{address})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if received[address] != want {
+			t.Errorf("%s: received %v, want %v", step, received[address], want)
+		}
+		// The cache agrees with reading every block again.
+		lw.clearReceivedCache()
+		uncached, err := lw.receivedByAddress(0, []string{address})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uncached[address] != received[address] {
+			t.Errorf("%s: cached %v, uncached %v", step, received[address], uncached[address])
+		}
+	}
+
+	c := &testChain{t: t, w: lw.wallet, txs: make(map[chainhash.Hash][]*wire.MsgTx)}
+	genesis := &lw.wallet.ChainParams().GenesisBlock.Header
+	checkReceived("no blocks", 0)
+	first := c.extend(genesis, 1, payment(chainhash.Hash{1}, 1e8))
+	checkReceived("first block", 1e8)
+	c.extend(first, 1)
+	checkReceived("second block", 1e8)
+
+	// A longer chain from the genesis block replaces both blocks.  The
+	// payment of the first block is unmined again.
+	reorged := c.extend(genesis, 2, payment(chainhash.Hash{2}, 2e8))
+	for i := 0; i < 2; i++ {
+		reorged = c.extend(reorged, 2)
+	}
+	if tipHash, tipHeight := lw.wallet.MainChainTip(); tipHash != reorged.BlockHash() || tipHeight != 3 {
+		t.Fatalf("main chain tip is %v at height %d after the reorganization", tipHash, tipHeight)
+	}
+	checkReceived("reorganized", 3e8)
+
+	// The cached blocks are replaced by a longer chain without payments.
+	// Both payments are unmined and only counted once.
+	fork := c.extend(genesis, 3)
+	for i := 0; i < 3; i++ {
+		fork = c.extend(fork, 3)
+	}
+	if tipHash, tipHeight := lw.wallet.MainChainTip(); tipHash != fork.BlockHash() || tipHeight != 4 {
+		t.Fatalf("main chain tip is %v at height %d after the second reorganization", tipHash, tipHeight)
+	}
+	checkReceived("reorganized again", 3e8)
+}
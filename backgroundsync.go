@@ -0,0 +1,126 @@
+package mobilewallet
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/decred/dcrd/chaincfg/chainhash"
+)
+
+// SyncSummary reports the work done by SyncForDuration.  Synced is true if the
+// wallet caught up with the network before the time budget ran out.
+type SyncSummary struct {
+	StartHeight     int32
+	EndHeight       int32
+	NewTransactions int32
+	Synced          bool
+}
+
+// SyncForDuration synchronizes the wallet over SPV for at most seconds, which
+// suits the short windows mobile operating systems allow for background work.
+// It fetches headers and cfilters up to the network tip, processes new
+// transactions, publishes unmined transactions and then stops, returning a
+// summary of what was done.  Everything synced is persisted as it is
+// processed, so a later call resumes where this one stopped.
+//
+// SyncForDuration blocks until syncing has stopped and fails with
+// ErrFailedPrecondition if the wallet is already syncing.
+func (lw *LibWallet) SyncForDuration(peerAddresses string, seconds int32) (*SyncSummary, error) {
+	w, ok := lw.loader.LoadedWallet()
+	if !ok {
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
+	if _, err := w.NetworkBackend(); err == nil || lw.loader.ReadOnly() {
+		return nil, newWalletError(ErrFailedPrecondition)
+	}
+	if seconds <= 0 {
+		return nil, newWalletError(ErrInvalid)
+	}
+
+	_, startHeight := w.MainChainTip()
+	summary := &SyncSummary{StartHeight: startHeight}
+
+	ctx, cancel := context.WithTimeout(contextWithShutdownCancel(context.Background()),
+		time.Duration(seconds)*time.Second)
+	defer cancel()
+	lw.mu.Lock()
+	lw.cancelSync = cancel
+	lw.mu.Unlock()
+
+	syncer, syncErr := lw.newSpvSyncer(ctx, w, peerAddresses)
+	if syncErr != nil {
+		return nil, syncErr
+	}
+
+	var caughtUpOnce sync.Once
+	caughtUp := make(chan struct{})
+	ntfns := lw.spvNotifications(w)
+	synced := ntfns.Synced
+	ntfns.Synced = func(sync bool) {
+		synced(sync)
+		if sync {
+			caughtUpOnce.Do(func() { close(caughtUp) })
+		}
+	}
+	syncer.SetNotifications(ntfns)
+
+	// Count the new transactions processed while syncing.
+	txHashes := make(map[chainhash.Hash]struct{})
+	txNtfns := w.NtfnServer.TransactionNotifications()
+	txNtfnsDone := make(chan struct{})
+	go func() {
+		defer close(txNtfnsDone)
+		for {
+			select {
+			case v := <-txNtfns.C:
+				for i := range v.UnminedTransactions {
+					txHashes[*v.UnminedTransactions[i].Hash] = struct{}{}
+				}
+				for _, block := range v.AttachedBlocks {
+					for i := range block.Transactions {
+						txHashes[*block.Transactions[i].Hash] = struct{}{}
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	w.SetNetworkBackend(syncer)
+	lw.loader.SetNetworkBackend(syncer)
+	defer w.SetNetworkBackend(nil)
+	defer lw.loader.SetNetworkBackend(nil)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- syncer.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case <-caughtUp:
+		summary.Synced = true
+		if err := w.PublishUnminedTransactions(ctx, syncer); err != nil {
+			log.Errorf("Failed to publish unmined transactions: %v", err)
+		}
+		cancel()
+		<-errc
+	case err = <-errc:
+	}
+	cancel()
+	<-txNtfnsDone
+	txNtfns.Done()
+
+	_, summary.EndHeight = w.MainChainTip()
+	summary.NewTransactions = int32(len(txHashes))
+
+	if err != nil {
+		code := syncErrorCode(err)
+		if code != SyncErrCanceled && code != SyncErrDeadlineExceeded {
+			return summary, newSyncError(SyncBackendSPV, code, err)
+		}
+	}
+	return summary, nil
+}
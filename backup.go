@@ -0,0 +1,503 @@
+package mobilewallet
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet"
+	"github.com/decred/dcrwallet/wallet/walletdb"
+	"github.com/raedahgroup/mobilewallet/badgerdb"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// backupVersion is the version of the archive written by BackupWallet.
+	backupVersion = 1
+
+	// backupChunkSize is the plaintext size of each encrypted chunk.
+	backupChunkSize = 64 * 1024
+
+	// Key derivation parameters for backup passphrases.
+	backupScryptN = 1 << 15
+	backupScryptR = 8
+	backupScryptP = 1
+)
+
+// backupMagic begins every wallet backup archive.
+var backupMagic = []byte("MWBACKUP")
+
+// The transaction store bucket of a wallet database and its nested bucket of
+// main chain blocks keyed by big-endian height, whose values begin with the
+// block hash.
+var (
+	wtxmgrNamespaceKey     = []byte("wtxmgr")
+	txStoreBlocksBucketKey = []byte("b")
+)
+
+// backupManifest describes the wallet database held by a backup archive.  The
+// metadata bucket, which records labels and settings, is part of the database.
+type backupManifest struct {
+	Version   int
+	Network   string
+	DbDriver  string
+	CreatedAt int64
+	DbSize    int64
+	DbSHA256  string
+}
+
+// BackupWallet writes an encrypted backup of the loaded wallet database to
+// path.  The backup is a consistent copy taken with the database driver and may
+// be written while the wallet is in use.  passphrase is required to restore it
+// with RestoreWallet.
+func (lw *LibWallet) BackupWallet(path string, passphrase []byte) (err error) {
+	defer func() {
+		for i := range passphrase {
+			passphrase[i] = 0
+		}
+	}()
+	if len(passphrase) == 0 {
+		return newWalletError(ErrPassphraseRequired)
+	}
+	db, err := lw.walletDB()
+	if err != nil {
+		return translateError(err)
+	}
+
+	// Copy the database to a temporary file first, its size and hash are
+	// recorded in the manifest that precedes it in the archive.
+	dbCopy, err := ioutil.TempFile(lw.dataDir, "backup")
+	if err != nil {
+		return translateError(errors.E(errors.IO, err))
+	}
+	defer func() {
+		dbCopy.Close()
+		os.Remove(dbCopy.Name())
+	}()
+	h := sha256.New()
+	err = db.Copy(io.MultiWriter(dbCopy, h))
+	if err != nil {
+		return translateError(err)
+	}
+	size, err := dbCopy.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return translateError(errors.E(errors.IO, err))
+	}
+	if _, err := dbCopy.Seek(0, io.SeekStart); err != nil {
+		return translateError(errors.E(errors.IO, err))
+	}
+
+	manifest, err := json.Marshal(&backupManifest{
+		Version:   backupVersion,
+		Network:   lw.activeNet.Name,
+		DbDriver:  lw.dbDriver,
+		CreatedAt: time.Now().Unix(),
+		DbSize:    size,
+		DbSHA256:  hex.EncodeToString(h.Sum(nil)),
+	})
+	if err != nil {
+		return translateError(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return translateError(errors.E(errors.IO, err))
+	}
+	defer func() {
+		closeErr := f.Close()
+		if err == nil && closeErr != nil {
+			err = errors.E(errors.IO, closeErr)
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	bw := bufio.NewWriter(f)
+	ew, err := newBackupWriter(bw, passphrase)
+	if err != nil {
+		return translateError(err)
+	}
+	var manifestLen [4]byte
+	binary.LittleEndian.PutUint32(manifestLen[:], uint32(len(manifest)))
+	if _, err := ew.Write(manifestLen[:]); err != nil {
+		return translateError(err)
+	}
+	if _, err := ew.Write(manifest); err != nil {
+		return translateError(err)
+	}
+	if _, err := io.Copy(ew, dbCopy); err != nil {
+		return translateError(errors.E(errors.IO, err))
+	}
+	if err := ew.Close(); err != nil {
+		return translateError(err)
+	}
+	if err := bw.Flush(); err != nil {
+		return translateError(errors.E(errors.IO, err))
+	}
+	return translateError(f.Sync())
+}
+
+// RestoreWallet replaces the wallet with one from a backup written by
+// BackupWallet.  The backup must be for the active network and database driver.
+// Its contents are verified and the restored database is checked to belong to
+// the active network before the current wallet database is replaced.  pubPass
+// opens the restored database if it is encrypted; if it is empty the default
+// public passphrase is used.  Any loaded wallet is closed first, and the
+// restored wallet must be opened with OpenWallet.
+func (lw *LibWallet) RestoreWallet(path string, passphrase, pubPass []byte) error {
+	defer func() {
+		for i := range passphrase {
+			passphrase[i] = 0
+		}
+	}()
+	if len(pubPass) == 0 {
+		pubPass = []byte(wallet.InsecurePubPassphrase)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return translateError(errors.E(errors.IO, err))
+	}
+	defer f.Close()
+
+	er, err := newBackupReader(bufio.NewReader(f), passphrase)
+	if err != nil {
+		return translateError(err)
+	}
+	var manifestLen [4]byte
+	if _, err := io.ReadFull(er, manifestLen[:]); err != nil {
+		return translateError(err)
+	}
+	manifestBytes := make([]byte, binary.LittleEndian.Uint32(manifestLen[:]))
+	if _, err := io.ReadFull(er, manifestBytes); err != nil {
+		return translateError(err)
+	}
+	var manifest backupManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return translateError(errors.E(errors.Encoding, err))
+	}
+	if manifest.Version != backupVersion {
+		return translateError(errors.E(errors.Invalid, errors.Errorf("unsupported backup version %d", manifest.Version)))
+	}
+	if manifest.Network != lw.activeNet.Name {
+		return translateError(errors.E(errors.Invalid, errors.Errorf("backup is for %s, not %s",
+			manifest.Network, lw.activeNet.Name)))
+	}
+	if manifest.DbDriver != lw.dbDriver {
+		return translateError(errors.E(errors.Invalid, errors.Errorf("backup uses the %s database driver, not %s",
+			manifest.DbDriver, lw.dbDriver)))
+	}
+
+	// Decrypt, verify and check the database before touching the current
+	// wallet.  It is restored next to the wallet so that it can be moved in
+	// place.
+	dbCopy, err := ioutil.TempFile(lw.dataDir, "restore")
+	if err != nil {
+		return translateError(errors.E(errors.IO, err))
+	}
+	defer func() {
+		dbCopy.Close()
+		os.Remove(dbCopy.Name())
+	}()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(dbCopy, h), er)
+	if err != nil {
+		return translateError(err)
+	}
+	if n != manifest.DbSize || hex.EncodeToString(h.Sum(nil)) != manifest.DbSHA256 {
+		return translateError(errors.E(errors.Crypto, "backup database failed integrity check"))
+	}
+	if _, err := dbCopy.Seek(0, io.SeekStart); err != nil {
+		return translateError(errors.E(errors.IO, err))
+	}
+
+	stageDir, err := ioutil.TempDir(lw.dataDir, "restore")
+	if err != nil {
+		return translateError(errors.E(errors.IO, err))
+	}
+	defer os.RemoveAll(stageDir)
+	stagedPath := filepath.Join(stageDir, walletDbName)
+	if err := writeRestoredDB(manifest.DbDriver, stagedPath, dbCopy); err != nil {
+		return translateError(err)
+	}
+	if err := lw.checkDatabaseNetwork(stagedPath, pubPass); err != nil {
+		log.Error(err)
+		return translateError(err)
+	}
+
+	if _, loaded := lw.loader.LoadedWallet(); loaded {
+		if err := lw.loader.UnloadWallet(); err != nil {
+			return translateError(err)
+		}
+	}
+	// The closed wallet must not be used until the restored one is opened.
+	lw.wallet = nil
+
+	err = lw.loader.ReplaceWalletDB(lw.dbDriver, func(dbPath string) error {
+		if err := os.Rename(stagedPath, dbPath); err != nil {
+			return errors.E(errors.IO, err)
+		}
+		return nil
+	})
+	return translateError(err)
+}
+
+// writeRestoredDB creates the database at dbPath from the copy of a database
+// of the driver read from r.
+func writeRestoredDB(driver, dbPath string, r io.Reader) error {
+	if driver == "badgerdb" {
+		return badgerdb.Restore(dbPath, r)
+	}
+	out, err := os.OpenFile(dbPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	_, err = io.Copy(out, r)
+	if err == nil {
+		err = out.Sync()
+	}
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
+
+// checkDatabaseNetwork returns an error unless the wallet database at dbPath
+// belongs to the active network.  The genesis block recorded by the
+// transaction store, the first block of its main chain, identifies the network.
+func (lw *LibWallet) checkDatabaseNetwork(dbPath string, pubPass []byte) error {
+	driver, args, err := lw.loader.readOnlyDbArgs(dbPath, pubPass)
+	if err != nil {
+		return err
+	}
+	db, err := walletdb.Open(driver, args...)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var genesis []byte
+	err = walletdb.View(db, func(tx walletdb.ReadTx) error {
+		ns := tx.ReadBucket(wtxmgrNamespaceKey)
+		if ns == nil {
+			return nil
+		}
+		blocks := ns.NestedReadBucket(txStoreBlocksBucketKey)
+		if blocks == nil {
+			return nil
+		}
+		var height [4]byte
+		genesis = blocks.Get(height[:])
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(genesis) < chainhash.HashSize {
+		return errors.E(errors.Invalid, "backup does not hold a wallet")
+	}
+	if !bytes.Equal(genesis[:chainhash.HashSize], lw.activeNet.GenesisHash[:]) {
+		return errors.E(errors.Invalid, errors.Errorf("backup database is not for %s", lw.activeNet.Name))
+	}
+	return nil
+}
+
+// backupHeader is written unencrypted at the start of an archive.  It holds
+// what is needed to derive the key from the passphrase.
+type backupHeader struct {
+	Salt  [32]byte
+	Nonce [24]byte
+}
+
+func deriveBackupKey(passphrase []byte, salt []byte) (*[32]byte, error) {
+	k, err := scrypt.Key(passphrase, salt, backupScryptN, backupScryptR, backupScryptP, 32)
+	if err != nil {
+		return nil, errors.E(errors.Crypto, err)
+	}
+	var key [32]byte
+	copy(key[:], k)
+	for i := range k {
+		k[i] = 0
+	}
+	return &key, nil
+}
+
+// chunkNonce returns the nonce of the chunk with the given index.  The last 8
+// bytes of the base nonce are replaced by the index so no nonce is reused.
+func chunkNonce(base *[24]byte, index uint64) *[24]byte {
+	var nonce [24]byte
+	copy(nonce[:], base[:])
+	binary.LittleEndian.PutUint64(nonce[16:], index)
+	return &nonce
+}
+
+// backupWriter encrypts everything written to it as a sequence of secretbox
+// sealed chunks.  The first plaintext byte of every chunk records whether it
+// is the final chunk so truncated archives are detected.
+type backupWriter struct {
+	w     io.Writer
+	key   *[32]byte
+	nonce [24]byte
+	index uint64
+	buf   []byte
+}
+
+func newBackupWriter(w io.Writer, passphrase []byte) (*backupWriter, error) {
+	var header backupHeader
+	if _, err := rand.Read(header.Salt[:]); err != nil {
+		return nil, errors.E(errors.Crypto, err)
+	}
+	if _, err := rand.Read(header.Nonce[:]); err != nil {
+		return nil, errors.E(errors.Crypto, err)
+	}
+	key, err := deriveBackupKey(passphrase, header.Salt[:])
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(backupMagic); err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(backupVersion)); err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+	return &backupWriter{
+		w:     w,
+		key:   key,
+		nonce: header.Nonce,
+		buf:   make([]byte, 1, backupChunkSize+1),
+	}, nil
+}
+
+func (bw *backupWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := backupChunkSize + 1 - len(bw.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		bw.buf = append(bw.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(bw.buf) == backupChunkSize+1 {
+			if err := bw.seal(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (bw *backupWriter) seal(final bool) error {
+	bw.buf[0] = 0
+	if final {
+		bw.buf[0] = 1
+	}
+	sealed := secretbox.Seal(nil, bw.buf, chunkNonce(&bw.nonce, bw.index), bw.key)
+	bw.index++
+	bw.buf = bw.buf[:1]
+	if err := binary.Write(bw.w, binary.LittleEndian, uint32(len(sealed))); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	if _, err := bw.w.Write(sealed); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
+
+// Close seals the final chunk.
+func (bw *backupWriter) Close() error {
+	return bw.seal(true)
+}
+
+// backupReader decrypts an archive written by backupWriter.
+type backupReader struct {
+	r     io.Reader
+	key   *[32]byte
+	nonce [24]byte
+	index uint64
+	buf   []byte
+	final bool
+}
+
+func newBackupReader(r io.Reader, passphrase []byte) (*backupReader, error) {
+	magic := make([]byte, len(backupMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, backupMagic) {
+		return nil, errors.E(errors.Encoding, "not a wallet backup")
+	}
+	var version uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, errors.E(errors.Encoding, err)
+	}
+	if version != backupVersion {
+		return nil, errors.E(errors.Invalid, errors.Errorf("unsupported backup version %d", version))
+	}
+	var header backupHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, errors.E(errors.Encoding, err)
+	}
+	key, err := deriveBackupKey(passphrase, header.Salt[:])
+	if err != nil {
+		return nil, err
+	}
+	return &backupReader{r: r, key: key, nonce: header.Nonce}, nil
+}
+
+func (br *backupReader) Read(p []byte) (int, error) {
+	for len(br.buf) == 0 {
+		if br.final {
+			return 0, io.EOF
+		}
+		if err := br.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, br.buf)
+	br.buf = br.buf[n:]
+	return n, nil
+}
+
+func (br *backupReader) open() error {
+	var size uint32
+	if err := binary.Read(br.r, binary.LittleEndian, &size); err != nil {
+		return errors.E(errors.Encoding, "backup is truncated")
+	}
+	if size < secretbox.Overhead+1 || size > backupChunkSize+1+secretbox.Overhead {
+		return errors.E(errors.Encoding, "backup is corrupt")
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(br.r, sealed); err != nil {
+		return errors.E(errors.Encoding, "backup is truncated")
+	}
+	chunk, ok := secretbox.Open(nil, sealed, chunkNonce(&br.nonce, br.index), br.key)
+	if !ok {
+		if br.index == 0 {
+			return errors.E(errors.Passphrase, "invalid backup passphrase")
+		}
+		return errors.E(errors.Crypto, "backup is corrupt")
+	}
+	br.index++
+	br.final = chunk[0] == 1
+	br.buf = chunk[1:]
+	return nil
+}
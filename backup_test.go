@@ -0,0 +1,209 @@
+package mobilewallet
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/decred/dcrwallet/wallet"
+)
+
+// checkWalletErrorCode fails the test unless err is a WalletError with code.
+func checkWalletErrorCode(t *testing.T, prefix string, err error, code string) {
+	if walletErr, ok := err.(*WalletError); !ok || walletErr.Code != code {
+		t.Errorf("%sreturned %v, want %s", prefix, err, code)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	for _, driver := range []string{"bdb", "badgerdb"} {
+		lw, dir := newTestWallet(t, driver)
+		defer os.RemoveAll(dir)
+
+		key := []byte("backuptest")
+		if err := lw.writeMetadata(key, []byte("backed up")); err != nil {
+			t.Fatal(err)
+		}
+		address, err := lw.CurrentAddress(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backupPath := filepath.Join(dir, "wallet.backup")
+		if err := lw.BackupWallet(backupPath, []byte("backup pass")); err != nil {
+			t.Fatalf("%s: BackupWallet: %v", driver, err)
+		}
+		if err := lw.writeMetadata(key, []byte("changed")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := lw.RestoreWallet(backupPath, []byte("backup pass"), nil); err != nil {
+			t.Fatalf("%s: RestoreWallet: %v", driver, err)
+		}
+		if _, loaded := lw.loader.LoadedWallet(); loaded || lw.wallet != nil {
+			t.Errorf("%s: wallet is still loaded after the restore", driver)
+		}
+		if err := lw.OpenWallet([]byte(wallet.InsecurePubPassphrase)); err != nil {
+			t.Fatalf("%s: opening restored wallet: %v", driver, err)
+		}
+		if v, err := lw.readMetadata(key); err != nil || string(v) != "backed up" {
+			t.Errorf("%s: restored metadata is %q (%v), want %q", driver, v, err, "backed up")
+		}
+		if got, err := lw.CurrentAddress(0); err != nil || got != address {
+			t.Errorf("%s: restored current address is %s (%v), want %s", driver, got, err, address)
+		}
+		checkNoReplacementFiles(t, lw, driver+": ")
+		lw.CloseWallet()
+	}
+}
+
+func TestRestoreDamagedBackup(t *testing.T) {
+	lw, dir := newTestWallet(t, "bdb")
+	defer os.RemoveAll(dir)
+	defer lw.CloseWallet()
+
+	// Make the database span several chunks.
+	if err := lw.writeMetadata([]byte("backuptest"), make([]byte, 3*backupChunkSize)); err != nil {
+		t.Fatal(err)
+	}
+	backupPath := filepath.Join(dir, "wallet.backup")
+	passphrase := "backup pass"
+	if err := lw.BackupWallet(backupPath, []byte(passphrase)); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := ioutil.ReadFile(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The archive begins with the magic, version and header, followed by
+	// chunks each prefixed by their length.
+	headerSize := len(backupMagic) + 4 + binary.Size(backupHeader{})
+	var boundaries []int
+	for offset := headerSize; offset < len(archive); {
+		offset += 4 + int(binary.LittleEndian.Uint32(archive[offset:]))
+		boundaries = append(boundaries, offset)
+	}
+	if len(boundaries) < 2 {
+		t.Fatalf("backup has %d chunks, want several", len(boundaries))
+	}
+	corrupt := append([]byte(nil), archive...)
+	corrupt[boundaries[0]+10] ^= 1
+
+	tests := []struct {
+		name       string
+		archive    []byte
+		passphrase string
+		code       string
+	}{
+		{"wrong passphrase", archive, "wrong pass", ErrInvalidPassphrase},
+		{"header only", archive[:headerSize], passphrase, ErrEncoding},
+		{"chunk boundary", archive[:boundaries[0]], passphrase, ErrEncoding},
+		{"last chunk boundary", archive[:boundaries[len(boundaries)-2]], passphrase, ErrEncoding},
+		{"mid chunk", archive[:boundaries[0]+100], passphrase, ErrEncoding},
+		{"corrupt chunk", corrupt, passphrase, ErrCrypto},
+		{"not a backup", []byte("wallet"), passphrase, ErrEncoding},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, "damaged.backup")
+		if err := ioutil.WriteFile(path, test.archive, 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := lw.RestoreWallet(path, []byte(test.passphrase), nil)
+		checkWalletErrorCode(t, test.name+": RestoreWallet ", err, test.code)
+		if _, loaded := lw.loader.LoadedWallet(); !loaded {
+			t.Fatalf("%s: failed restore closed the wallet", test.name)
+		}
+	}
+}
+
+// writeTestBackup writes a backup of the database db described by manifest,
+// which need not match it.
+func writeTestBackup(t *testing.T, path string, manifest *backupManifest, db, passphrase []byte) {
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	bw := bufio.NewWriter(&archive)
+	ew, err := newBackupWriter(bw, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifestLen [4]byte
+	binary.LittleEndian.PutUint32(manifestLen[:], uint32(len(manifestBytes)))
+	for _, b := range [][]byte{manifestLen[:], manifestBytes, db} {
+		if _, err := ew.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ew.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, archive.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreOtherNetwork(t *testing.T) {
+	lw, dir := newTestWallet(t, "bdb")
+	defer os.RemoveAll(dir)
+	defer lw.CloseWallet()
+
+	// Create a mainnet wallet and back it up.
+	mainDir, err := ioutil.TempDir("", "mobilewallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mainDir)
+	mainnet := NewLibWallet(mainDir, "bdb", "mainnet")
+	mainnet.InitLoader()
+	seed, err := mainnet.GenerateSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mainnet.CreateWallet("private", seed, nil); err != nil {
+		t.Fatal(err)
+	}
+	passphrase := "backup pass"
+	mainBackup := filepath.Join(mainDir, "mainnet.backup")
+	if err := mainnet.BackupWallet(mainBackup, []byte(passphrase)); err != nil {
+		t.Fatal(err)
+	}
+	mainnet.CloseWallet()
+	mainDB, err := ioutil.ReadFile(filepath.Join(mainnet.loader.DbDirPath(), walletDbName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = lw.RestoreWallet(mainBackup, []byte(passphrase), nil)
+	checkWalletErrorCode(t, "restoring a mainnet backup: ", err, ErrInvalid)
+
+	// A backup claiming to be for testnet is refused by the network of
+	// its database.
+	hash := sha256.Sum256(mainDB)
+	forged := filepath.Join(dir, "forged.backup")
+	writeTestBackup(t, forged, &backupManifest{
+		Version:  backupVersion,
+		Network:  lw.activeNet.Name,
+		DbDriver: "bdb",
+		DbSize:   int64(len(mainDB)),
+		DbSHA256: hex.EncodeToString(hash[:]),
+	}, mainDB, []byte(passphrase))
+	err = lw.RestoreWallet(forged, []byte(passphrase), nil)
+	checkWalletErrorCode(t, "restoring a mainnet database: ", err, ErrInvalid)
+
+	if _, loaded := lw.loader.LoadedWallet(); !loaded {
+		t.Fatal("failed restore closed the wallet")
+	}
+	checkNoReplacementFiles(t, lw, "")
+}
@@ -2,325 +2,398 @@ package badgerdb
 
 import (
 	"bytes"
+	"encoding/binary"
 
 	"github.com/decred/dcrwallet/errors"
 	"github.com/dgraph-io/badger"
 )
 
 const (
-	// Maximum length of a key, in bytes.
-	maxKeySize = 65378
-
-	// Maximum length of a prefix, in bytes
-	maxPrefixSize = 50
+	// Maximum length of a key, in bytes, including the prefix of its bucket.
+	maxKeySize = 65000
 
 	// Holds an identifier for a bucket
 	metaBucket = 5
+
+	// iterBatchSize is the number of key/value pairs read by each iterator
+	// opened for ForEach and cursors.
+	iterBatchSize = 64
 )
 
+// Keys are encoded so that every bucket owns a distinct, contiguous range of
+// keys.  The prefix of a bucket is the number of buckets in its path plus one,
+// as a uvarint, followed by the name of every bucket in the path from the top
+// level, each preceded by its length as a uvarint.  A key stored in a bucket is
+// the prefix of the bucket followed by the key itself, and nested buckets are
+// recorded as keys of their parent with the metaBucket user metadata.
+//
+// Two buckets at the same depth have prefixes that are not prefixes of each
+// other, and buckets at different depths begin with different depths, so keys
+// of different buckets never collide and keys of a bucket sort in the same
+// order as the keys themselves.  Keys that begin with a zero byte are reserved
+// for the driver.
+
+// rootPrefix is the prefix of the keys recording top-level buckets.
+var rootPrefix = []byte{1}
+
+// childPrefix returns the prefix of the nested bucket name of the bucket with
+// the given prefix.
+func childPrefix(prefix []byte, name []byte) []byte {
+	depth, n := binary.Uvarint(prefix)
+	child := make([]byte, 0, len(prefix)+2*binary.MaxVarintLen64+len(name))
+	child = appendUvarint(child, depth+1)
+	child = append(child, prefix[n:]...)
+	child = appendUvarint(child, uint64(len(name)))
+	return append(child, name...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// dbKey returns the database key of key in the bucket with the given prefix.
+func dbKey(prefix []byte, key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errors.E(errors.Invalid, "key is empty")
+	}
+	if len(prefix)+len(key) > maxKeySize {
+		return nil, errors.E(errors.Invalid, "key is too large")
+	}
+	k := make([]byte, 0, len(prefix)+len(key))
+	k = append(k, prefix...)
+	return append(k, key...), nil
+}
+
+// prefixEnd returns the smallest key greater than every key beginning with
+// prefix, or nil if there is no such key.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
 // Bucket is an internal type used to represent a collection of key/value pairs
 // and implements the walletdb Bucket interfaces.
 type Bucket struct {
 	prefix        []byte
-	buckets       []*Bucket
-	cursor        *Cursor
-	txn           *badger.Txn
 	dbTransaction *transaction
 }
 
 // Cursor represents a cursor over key/value pairs and nested buckets of a
 // bucket.
 //
+// Badger permits a single open iterator per transaction, so cursors do not keep
+// an iterator open between calls.  Pairs are read in batches in the direction
+// of travel and served from the batch.
+//
 // Note that open cursors are not tracked on bucket changes and any
 // modifications to the bucket, with the exception of cursor.Delete, invalidate
 // the cursor. After invalidation, the cursor must be repositioned, or the keys
 // and values returned may be unpredictable.
 type Cursor struct {
-	iterator        *badger.Iterator
-	reverseIterator *badger.Iterator
-	txn             *badger.Txn
-	prefix          []byte
-	ck              []byte
-	dbTransaction   *transaction
+	bucket  *Bucket
+	batch   []pair
+	pos     int
+	reverse bool
+	more    bool
 }
 
-func newBucket(tx *badger.Txn, badgerKey []byte, dbTx *transaction) (*Bucket, error) {
-	prefix := make([]byte, len(badgerKey))
-	copy(prefix, badgerKey)
-	item, err := tx.Get(prefix)
-	if err != nil {
-		//Not Found
-		if err == badger.ErrKeyNotFound {
-			err = tx.SetWithMeta(prefix, insertPrefixLength([]byte{}, len(prefix)), metaBucket)
-			if err != nil {
-				return nil, convertErr(err)
-			}
-			return &Bucket{txn: tx, prefix: prefix, dbTransaction: dbTx}, nil
-		}
-		return nil, convertErr(err)
-	}
-	if item.UserMeta() != metaBucket {
-		errors.E(errors.Invalid, "key is not associated with a bucket")
-	}
-	return &Bucket{txn: tx, prefix: prefix, dbTransaction: dbTx}, nil
+// pair is a key/value pair of a bucket.  value is nil for nested buckets.
+type pair struct {
+	key   []byte
+	value []byte
 }
 
-func trimByte(b []byte) []byte {
-	for i := 0; i < len(b); i++ {
-		if b[i] != 0 {
-			return b[i:]
-		}
-	}
-	return []byte{}
+func (b *Bucket) txn() *badger.Txn {
+	return b.dbTransaction.badgerTx
 }
 
-func createPrefix(prefix []byte) ([]byte, error) {
-	prefix = trimByte(prefix)
-	if len(prefix) > maxPrefixSize {
-		return nil, errors.E(errors.Invalid, "prefix too long")
+// entry returns the item recording key in the bucket, or nil if there is none.
+func (b *Bucket) entry(key []byte) (*badger.Item, error) {
+	k, err := dbKey(b.prefix, key)
+	if err != nil {
+		return nil, err
 	}
-
-	finalPrefix := make([]byte, maxPrefixSize)
-	finalPrefix = append(finalPrefix[len(prefix):maxPrefixSize], prefix...)
-
-	return prefix, nil
-}
-
-func insertPrefixLength(val []byte, length int) []byte {
-	result := make([]byte, 0)
-	prefixBytes := byte(length)
-	result = append(result, prefixBytes)
-	result = append(result, val...)
-	return result
-}
-
-func addPrefix(prefix []byte, key []byte) ([]byte, error) {
-	if len(key) > maxKeySize {
-		return nil, errors.E(errors.Invalid, "key too long")
+	item, err := b.txn().Get(k)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
 	}
-	return append(prefix, key...), nil
-}
-
-// SetTx changes the transaction for bucket and sub buckets
-func (b *Bucket) setTx(tx *badger.Txn) {
-	b.txn = tx
-	for _, bkt := range b.buckets {
-		bkt.setTx(tx)
+	if err != nil {
+		return nil, convertErr(err)
 	}
+	return item, nil
 }
 
-func (b *Bucket) iterator() *badger.Iterator {
-	opts := badger.DefaultIteratorOptions
-	opts.PrefetchSize = 100
-	it := b.txn.NewIterator(opts)
-	return it
-}
-
-func (b *Bucket) badgerCursor() *Cursor {
-	reverseOptions := badger.DefaultIteratorOptions
-	//Key-only iteration for faster search. Value gets fetched when item.Value() is called.
-	reverseOptions.PrefetchValues = false
-	reverseOptions.Reverse = true
-	txn := b.dbTransaction.db.NewTransaction(false)
-	reverseIterator := txn.NewIterator(reverseOptions)
-	cursor := &Cursor{iterator: b.iterator(), reverseIterator: reverseIterator, txn: b.txn, prefix: b.prefix, dbTransaction: b.dbTransaction}
-	return cursor
-}
-
-// Bucket returns a nested bucket which is created from the passed key
-func (b *Bucket) bucket(key []byte, errorIfExists bool) (*Bucket, error) {
-	if len(key) == 0 {
-		//Empty Key
-		return nil, errors.E(errors.Invalid, "key is empty")
-	}
-	keyPrefix, err := addPrefix(b.prefix, key)
+// bucket returns the nested bucket name, creating it if it does not exist.
+func (b *Bucket) bucket(name []byte, errorIfExists bool) (*Bucket, error) {
+	item, err := b.entry(name)
 	if err != nil {
 		return nil, err
 	}
-	copiedKey := make([]byte, len(keyPrefix))
-	copy(copiedKey, keyPrefix)
-	item, err := b.txn.Get(copiedKey)
-	if err != nil {
-		//Key Not Found
-		err = b.txn.SetWithMeta(copiedKey, insertPrefixLength([]byte{}, len(b.prefix)), metaBucket)
-		if err != nil {
-			return nil, convertErr(err)
+	if item != nil {
+		if item.UserMeta() != metaBucket {
+			return nil, errors.E(errors.Invalid, "key is not associated with a bucket")
 		}
-		bucket := &Bucket{txn: b.txn, prefix: copiedKey, dbTransaction: b.dbTransaction}
-		b.buckets = append(b.buckets, bucket)
-		return bucket, nil
-	}
-
-	if item.UserMeta() == metaBucket {
 		if errorIfExists {
 			return nil, errors.E(errors.Exist, "bucket already exists")
 		}
-
-		bucket := &Bucket{txn: b.txn, prefix: copiedKey, dbTransaction: b.dbTransaction}
-		b.buckets = append(b.buckets, bucket)
-		return bucket, nil
+		return &Bucket{prefix: childPrefix(b.prefix, name), dbTransaction: b.dbTransaction}, nil
 	}
-
-	return nil, errors.E(errors.Invalid, "key is not associated with a bucket")
-}
-
-// RetrieveBucket retrieves a bucket with the give key
-// returns nil if the bucket does not exist or given key
-// does not point to a bucket.
-func (b *Bucket) retrieveBucket(key []byte) *Bucket {
-	if len(key) == 0 {
-		return nil
-	}
-
-	k, err := addPrefix(b.prefix, key)
-	if err != nil {
-		return nil
+	if !b.dbTransaction.writable {
+		return nil, errors.E(errors.Invalid, "cannot create bucket in a read-only transaction")
 	}
-	copiedKey := make([]byte, len(k))
-	copy(copiedKey, k)
-	item, err := b.txn.Get(copiedKey)
+	k, _ := dbKey(b.prefix, name)
+	err = b.txn().SetWithMeta(k, []byte{}, metaBucket)
 	if err != nil {
-		//Bucket Not Found
-		return nil
+		return nil, convertErr(err)
 	}
+	return &Bucket{prefix: childPrefix(b.prefix, name), dbTransaction: b.dbTransaction}, nil
+}
 
-	if item.UserMeta() == metaBucket {
-		//Retrieve bucket
-		bucket := &Bucket{txn: b.txn, prefix: copiedKey, dbTransaction: b.dbTransaction}
-		b.buckets = append(b.buckets, bucket)
-		return bucket
+// retrieveBucket returns the nested bucket name, or nil if the bucket does not
+// exist or name records a value.
+func (b *Bucket) retrieveBucket(name []byte) *Bucket {
+	item, err := b.entry(name)
+	if err != nil || item == nil || item.UserMeta() != metaBucket {
+		return nil
 	}
-
-	//Key is not associated with a bucket
-	return nil
+	return &Bucket{prefix: childPrefix(b.prefix, name), dbTransaction: b.dbTransaction}
 }
 
-// DropBucket deletes a bucket and all it's data
-// from the database. Return nil if bucket does
-// not exist, transaction is not writable or given
-// key does not point to a bucket
-func (b *Bucket) dropBucket(key []byte) error {
+// dropBucket deletes the nested bucket name and everything nested in it.
+func (b *Bucket) dropBucket(name []byte) error {
 	if !b.dbTransaction.writable {
 		return errors.E(errors.Invalid, "cannot delete nested bucket in a read-only transaction")
 	}
-
-	prefix, err := addPrefix(b.prefix, key)
+	item, err := b.entry(name)
 	if err != nil {
 		return err
 	}
-	item, err := b.txn.Get(prefix)
-	if err != nil {
-		return convertErr(err)
+	if item == nil {
+		return errors.E(errors.NotExist, "bucket does not exist")
 	}
-
 	if item.UserMeta() != metaBucket {
 		return errors.E(errors.Invalid, "key is not associated with a bucket")
 	}
-	b.txn.Delete(item.Key()[:])
-	txn := b.dbTransaction.db.NewTransaction(false)
-	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	child := &Bucket{prefix: childPrefix(b.prefix, name), dbTransaction: b.dbTransaction}
+	if err := child.clear(); err != nil {
+		return err
+	}
+	return convertErr(b.txn().Delete(item.KeyCopy(nil)))
+}
 
-	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-		item = it.Item()
-		val, err := item.Value()
-		if err != nil {
-			continue
+// clear deletes every key of the bucket and every nested bucket.
+func (b *Bucket) clear() error {
+	var nested [][]byte
+	err := b.forEach(func(k, v []byte) error {
+		if v == nil {
+			nested = append(nested, append([]byte{}, k...))
 		}
-		prefixLength := int(val[0])
-		if bytes.Equal(item.Key()[:prefixLength], b.prefix) {
-			b.txn.Delete(item.Key()[:])
+		dk, _ := dbKey(b.prefix, k)
+		return convertErr(b.txn().Delete(dk))
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range nested {
+		child := &Bucket{prefix: childPrefix(b.prefix, name), dbTransaction: b.dbTransaction}
+		if err := child.clear(); err != nil {
+			return err
 		}
 	}
-	it.Close()
-	txn.Discard()
 	return nil
 }
 
 func (b *Bucket) get(key []byte) []byte {
-	if len(key) == 0 {
+	item, err := b.entry(key)
+	if err != nil || item == nil || item.UserMeta() == metaBucket {
 		return nil
 	}
-	k, err := addPrefix(b.prefix, key)
+	val, err := item.Value()
 	if err != nil {
 		return nil
 	}
-	item, err := b.txn.Get(k)
+	val, err = b.open(item.Key(), val)
 	if err != nil {
-		//Not found
 		return nil
 	}
-	val, err := item.Value()
-	if err != nil {
-		return nil
-	}
-	return val[1:]
+	return val
 }
 
 func (b *Bucket) put(key []byte, value []byte) error {
-	if len(key) == 0 {
-		return errors.E(errors.Invalid, "key is empty")
-	} else if len(key) > maxKeySize {
-		return errors.E(errors.Invalid, "key is too large")
+	if !b.dbTransaction.writable {
+		return errors.E(errors.Invalid, "cannot put in a read-only transaction")
 	}
-	copiedKey := make([]byte, len(key))
-	copy(copiedKey, key[:])
-
-	k, err := addPrefix(b.prefix, copiedKey)
+	k, err := dbKey(b.prefix, key)
 	if err != nil {
 		return err
 	}
-	err = b.txn.Set(k, insertPrefixLength(value[:], len(b.prefix)))
+	item, err := b.txn().Get(k)
+	if err == nil && item.UserMeta() == metaBucket {
+		return errors.E(errors.Invalid, "key is associated with a bucket")
+	}
+	v, err := b.seal(k, value)
+	if err != nil {
+		return err
+	}
+	return b.txn().Set(k, v)
+}
 
-	return err
+// seal returns the value to store under the database key k, which is encrypted
+// if the database is encrypted.
+func (b *Bucket) seal(k, value []byte) ([]byte, error) {
+	if b.dbTransaction.aead == nil {
+		return append([]byte{}, value...), nil
+	}
+	return sealValue(b.dbTransaction.aead, k, value)
+}
+
+// open returns the value of a bucket from the value stored under the database
+// key k.
+func (b *Bucket) open(k, stored []byte) ([]byte, error) {
+	if b.dbTransaction.aead == nil {
+		return stored, nil
+	}
+	return openValue(b.dbTransaction.aead, k, stored)
 }
 
 func (b *Bucket) delete(key []byte) error {
+	if !b.dbTransaction.writable {
+		return errors.E(errors.Invalid, "cannot delete in a read-only transaction")
+	}
 	if len(key) == 0 {
 		return nil
 	}
-
-	k, err := addPrefix(b.prefix, key)
-	if err != nil {
+	item, err := b.entry(key)
+	if err != nil || item == nil {
 		return err
 	}
-	err = b.txn.Delete(k)
-	if err == badger.ErrKeyNotFound {
-		return nil
+	if item.UserMeta() == metaBucket {
+		return errors.E(errors.Invalid, "key is associated with a bucket")
 	}
-	return err
+	return b.txn().Delete(item.KeyCopy(nil))
 }
 
-func (b *Bucket) forEach(fn func(k, v []byte) error) error {
-	txn := b.dbTransaction.db.NewTransaction(false)
-	it := txn.NewIterator(badger.DefaultIteratorOptions)
-	defer func() {
-		it.Close()
-		txn.Discard()
-	}()
-	prefix := b.prefix
-	it.Rewind()
-	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+// readBatch reads up to iterBatchSize pairs of the bucket starting at the
+// database key start, which is included unless exclusive is set.  Reverse
+// reads move towards smaller keys.  The returned bool reports whether more
+// pairs may follow the batch.
+func (b *Bucket) readBatch(start []byte, exclusive, reverse bool) ([]pair, bool, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchSize = iterBatchSize
+	opts.Reverse = reverse
+	it := b.txn().NewIterator(opts)
+	defer it.Close()
+
+	var batch []pair
+	for it.Seek(start); it.Valid(); it.Next() {
 		item := it.Item()
-		k := item.Key()
-		if bytes.Equal(item.Key(), prefix) {
+		if !bytes.HasPrefix(item.Key(), b.prefix) {
+			// Reverse reads may start at a key of the next bucket.
+			if reverse && bytes.Equal(item.Key(), start) {
+				continue
+			}
+			break
+		}
+		if exclusive && bytes.Equal(item.Key(), start) {
 			continue
 		}
-		v, err := item.Value()
+		if len(batch) == iterBatchSize {
+			return batch, true, nil
+		}
+		p := pair{key: item.KeyCopy(nil)[len(b.prefix):]}
+		if item.UserMeta() != metaBucket {
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return nil, false, convertErr(err)
+			}
+			v, err = b.open(item.Key(), v)
+			if err != nil {
+				return nil, false, err
+			}
+			p.value = v
+		}
+		batch = append(batch, p)
+	}
+	return batch, false, nil
+}
+
+// forEach calls fn with every pair of the bucket.  No iterator is open while fn
+// runs, so fn may read and modify the database.
+func (b *Bucket) forEach(fn func(k, v []byte) error) error {
+	start := b.prefix
+	exclusive := false
+	for {
+		batch, more, err := b.readBatch(start, exclusive, false)
 		if err != nil {
-			return convertErr(err)
+			return err
 		}
-		prefixLength := int(v[0])
-		if bytes.Equal(item.Key()[:prefixLength], prefix) {
-			if item.UserMeta() == metaBucket {
-				if err := fn(k[prefixLength:], nil); err != nil {
-					return err
-				}
-			} else {
-				if err := fn(k[prefixLength:], v[1:]); err != nil {
-					return err
-				}
+		for _, p := range batch {
+			if err := fn(p.key, p.value); err != nil {
+				return err
 			}
 		}
+		if !more {
+			return nil
+		}
+		start, _ = dbKey(b.prefix, batch[len(batch)-1].key)
+		exclusive = true
 	}
-	return nil
+}
+
+// lastKey returns the database key that reverse reads of the bucket start at.
+// Prefixes begin with a depth below 0x80, so the end of a prefix always exists.
+func (b *Bucket) lastKey() []byte {
+	return prefixEnd(b.prefix)
+}
+
+// load replaces the batch of the cursor with pairs read from start and returns
+// the first of them.
+func (c *Cursor) load(start []byte, exclusive, reverse bool) (key, value []byte) {
+	batch, more, err := c.bucket.readBatch(start, exclusive, reverse)
+	if err != nil || batch == nil {
+		batch = []pair{}
+	}
+	c.batch, c.pos, c.reverse, c.more = batch, 0, reverse, more
+	return c.current()
+}
+
+func (c *Cursor) current() (key, value []byte) {
+	if c.pos >= len(c.batch) {
+		return nil, nil
+	}
+	p := c.batch[c.pos]
+	return p.key, p.value
+}
+
+// step moves the cursor one pair in the given direction.  An unpositioned
+// cursor moves to the first or last pair.
+func (c *Cursor) step(reverse bool) (key, value []byte) {
+	if c.batch == nil {
+		if reverse {
+			return c.load(c.bucket.lastKey(), false, true)
+		}
+		return c.load(c.bucket.prefix, false, false)
+	}
+	if c.pos >= len(c.batch) {
+		return nil, nil
+	}
+	ck := c.batch[c.pos].key
+	if c.reverse == reverse && c.pos+1 < len(c.batch) {
+		c.pos++
+		return c.current()
+	}
+	if c.reverse == reverse && !c.more {
+		c.pos = len(c.batch)
+		return nil, nil
+	}
+	start, _ := dbKey(c.bucket.prefix, ck)
+	return c.load(start, true, reverse)
 }
@@ -0,0 +1,242 @@
+// Copyright (c) 2018 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package badgerdb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/decred/dcrwallet/errors"
+	"github.com/dgraph-io/badger"
+	"github.com/dgraph-io/badger/protos"
+)
+
+const (
+	// copyVersion is the version of the format written by Copy.  Streams of
+	// other versions are not restored.
+	copyVersion = 2
+
+	// maxCopyEntrySize is the largest entry Restore accepts.  It bounds the
+	// memory allocated for a corrupted stream.
+	maxCopyEntrySize = 1 << 30
+)
+
+// copyMagic begins every stream written by Copy.
+var copyMagic = []byte("badgerdbcopy")
+
+// writeCopy writes every key of the database, including the keys recording
+// buckets, as seen by a single read-only transaction.  The stream begins with
+// copyMagic and the format version, followed by length-prefixed protobuf
+// encoded key/value pairs.  It ends with a trailer: a zero length, the number
+// of pairs and the SHA-256 hash of the pairs with their lengths, which readCopy
+// checks to detect truncated or corrupted streams.
+func writeCopy(bdb *badger.DB, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(copyMagic); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	if err := binary.Write(bw, binary.LittleEndian, uint32(copyVersion)); err != nil {
+		return errors.E(errors.IO, err)
+	}
+
+	h := sha256.New()
+	hw := io.MultiWriter(bw, h)
+	var count uint64
+	err := bdb.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			val, err := item.Value()
+			if err != nil {
+				return convertErr(err)
+			}
+			entry := &protos.KVPair{
+				Key:      item.Key(),
+				Value:    val,
+				UserMeta: []byte{item.UserMeta()},
+			}
+			buf, err := entry.Marshal()
+			if err != nil {
+				return errors.E(errors.Encoding, err)
+			}
+			if err := binary.Write(hw, binary.LittleEndian, uint64(len(buf))); err != nil {
+				return errors.E(errors.IO, err)
+			}
+			if _, err := hw.Write(buf); err != nil {
+				return errors.E(errors.IO, err)
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, uint64(0)); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	if err := binary.Write(bw, binary.LittleEndian, count); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	if _, err := bw.Write(h.Sum(nil)); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	if err := bw.Flush(); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
+
+// readCopy writes every key/value pair of a stream written by writeCopy to the
+// database.  The stream is rejected if its trailer is missing or does not match
+// the pairs read.
+func readCopy(bdb *badger.DB, r io.Reader) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(copyMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, copyMagic) {
+		return errors.E(errors.Encoding, "not a badgerdb copy")
+	}
+	var version uint32
+	if err := binary.Read(br, binary.LittleEndian, &version); err != nil {
+		return errors.E(errors.Encoding, err)
+	}
+	if version != copyVersion {
+		return errors.E(errors.Encoding, errors.Errorf("unsupported copy version %d", version))
+	}
+
+	h := sha256.New()
+	hr := io.TeeReader(br, h)
+	var count uint64
+	w := newBatchWriter(bdb)
+	defer w.discard()
+	for {
+		var size uint64
+		err := binary.Read(br, binary.LittleEndian, &size)
+		if err != nil {
+			return errors.E(errors.Encoding, errors.Errorf("truncated copy: %v", err))
+		}
+		if size == 0 {
+			if err := readCopyTrailer(br, count, h.Sum(nil)); err != nil {
+				return err
+			}
+			break
+		}
+		if size > maxCopyEntrySize {
+			return errors.E(errors.Encoding, "copy entry too large")
+		}
+		binary.Write(h, binary.LittleEndian, size)
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(hr, buf); err != nil {
+			return errors.E(errors.Encoding, errors.Errorf("truncated copy: %v", err))
+		}
+		count++
+		var entry protos.KVPair
+		if err := entry.Unmarshal(buf); err != nil {
+			return errors.E(errors.Encoding, err)
+		}
+		if len(entry.UserMeta) != 1 {
+			return errors.E(errors.Encoding, "copy entry is missing metadata")
+		}
+		if err := w.set(entry.Key, entry.Value, entry.UserMeta[0]); err != nil {
+			return err
+		}
+	}
+	return w.commit()
+}
+
+// readCopyTrailer reads the trailer of a copy following its zero length and
+// checks it against the number of pairs read and their hash.
+func readCopyTrailer(r io.Reader, count uint64, sum []byte) error {
+	var wantCount uint64
+	if err := binary.Read(r, binary.LittleEndian, &wantCount); err != nil {
+		return errors.E(errors.Encoding, errors.Errorf("truncated copy: %v", err))
+	}
+	wantSum := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, wantSum); err != nil {
+		return errors.E(errors.Encoding, errors.Errorf("truncated copy: %v", err))
+	}
+	if count != wantCount {
+		return errors.E(errors.Encoding, errors.Errorf("copy has %d entries, expected %d",
+			count, wantCount))
+	}
+	if !bytes.Equal(sum, wantSum) {
+		return errors.E(errors.Encoding, "copy checksum mismatch")
+	}
+	return nil
+}
+
+// batchWriter writes keys to a database in as few transactions as badger
+// allows, committing whenever a transaction becomes too big.  It is used to
+// fill new databases, where the writes need not be atomic.
+type batchWriter struct {
+	bdb *badger.DB
+	txn *badger.Txn
+}
+
+func newBatchWriter(bdb *badger.DB) *batchWriter {
+	return &batchWriter{bdb: bdb, txn: bdb.NewTransaction(true)}
+}
+
+func (w *batchWriter) set(key, value []byte, userMeta byte) error {
+	err := w.txn.SetWithMeta(key, value, userMeta)
+	if err == badger.ErrTxnTooBig {
+		// Commit what fits and continue in a new transaction.
+		if err := w.txn.Commit(nil); err != nil {
+			return convertErr(err)
+		}
+		w.txn = w.bdb.NewTransaction(true)
+		err = w.txn.SetWithMeta(key, value, userMeta)
+	}
+	return convertErr(err)
+}
+
+func (w *batchWriter) delete(key []byte) error {
+	err := w.txn.Delete(key)
+	if err == badger.ErrTxnTooBig {
+		if err := w.txn.Commit(nil); err != nil {
+			return convertErr(err)
+		}
+		w.txn = w.bdb.NewTransaction(true)
+		err = w.txn.Delete(key)
+	}
+	return convertErr(err)
+}
+
+func (w *batchWriter) commit() error {
+	return convertErr(w.txn.Commit(nil))
+}
+
+func (w *batchWriter) discard() {
+	w.txn.Discard()
+}
+
+// Restore creates a database at dbPath holding the contents of a copy written
+// by the Copy method of a badgerdb database.  dbPath must not exist.  On error
+// any partially restored database is removed.
+func Restore(dbPath string, r io.Reader) (err error) {
+	if fileExists(dbPath) {
+		return errors.E(errors.Exist, "database already exists")
+	}
+	walletDB, err := openDB(dbPath, true, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := walletDB.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.RemoveAll(dbPath)
+		}
+	}()
+
+	return readCopy(walletDB.bdb, r)
+}
@@ -0,0 +1,159 @@
+package badgerdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/decred/dcrwallet/wallet/walletdb"
+)
+
+// fillCopyTestDB writes the buckets and keys copied by the tests.  Values are
+// large enough for the copy to span several write transactions when restored.
+func fillCopyTestDB(t *testing.T, db walletdb.DB) {
+	err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		top, err := tx.CreateTopLevelBucket([]byte("top"))
+		if err != nil {
+			return err
+		}
+		nested, err := top.CreateBucket([]byte("nested"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprintf("key%03d", i))
+			if err := top.Put(key, bytes.Repeat([]byte{byte(i)}, 100)); err != nil {
+				return err
+			}
+			if err := nested.Put(key, []byte(fmt.Sprintf("nested%d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func dbContents(t *testing.T, db walletdb.DB) map[string]string {
+	contents := make(map[string]string)
+	err := walletdb.View(db, func(tx walletdb.ReadTx) error {
+		top := tx.ReadBucket([]byte("top"))
+		if top == nil {
+			return fmt.Errorf("missing top-level bucket")
+		}
+		err := top.ForEach(func(k, v []byte) error {
+			contents["top/"+string(k)] = string(v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		nested := top.NestedReadBucket([]byte("nested"))
+		if nested == nil {
+			return fmt.Errorf("missing nested bucket")
+		}
+		return nested.ForEach(func(k, v []byte) error {
+			contents["nested/"+string(k)] = string(v)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+// copyTestDB returns the copy of a filled database and its contents.
+func copyTestDB(t *testing.T, dir string) ([]byte, map[string]string) {
+	db, err := walletdb.Create(dbType, filepath.Join(dir, "source.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fillCopyTestDB(t, db)
+
+	var buf bytes.Buffer
+	if err := db.Copy(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), dbContents(t, db)
+}
+
+func TestCopyRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badgerdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stream, want := copyTestDB(t, dir)
+	dbPath := filepath.Join(dir, "restored.db")
+	if err := Restore(dbPath, bytes.NewReader(stream)); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	db, err := walletdb.Open(dbType, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	got := dbContents(t, db)
+	if len(got) != len(want) {
+		t.Fatalf("restored %d keys, want %d", len(got), len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("restored %q = %q, want %q", k, got[k], v)
+		}
+	}
+
+	if err := Restore(dbPath, bytes.NewReader(stream)); err == nil {
+		t.Errorf("Restore over an existing database succeeded")
+	}
+}
+
+func TestRestoreDamagedCopy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badgerdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stream, _ := copyTestDB(t, dir)
+	// The trailer is a zero length, an entry count and a SHA-256 hash.
+	trailerSize := 8 + 8 + 32
+	corrupt := append([]byte(nil), stream...)
+	corrupt[len(copyMagic)+4+8+2] ^= 0xff
+	oldVersion := append([]byte(nil), stream...)
+	binary.LittleEndian.PutUint32(oldVersion[len(copyMagic):], copyVersion-1)
+	newVersion := append([]byte(nil), stream...)
+	binary.LittleEndian.PutUint32(newVersion[len(copyMagic):], copyVersion+1)
+	tests := []struct {
+		name   string
+		stream []byte
+	}{
+		{"empty", nil},
+		{"header only", stream[:len(copyMagic)+4]},
+		{"mid entry", stream[:len(stream)/2]},
+		{"entry boundary", stream[:len(stream)-trailerSize]},
+		{"missing hash", stream[:len(stream)-32]},
+		{"short hash", stream[:len(stream)-1]},
+		{"corrupt entry", corrupt},
+		{"old version", oldVersion},
+		{"newer version", newVersion},
+	}
+	for i, test := range tests {
+		dbPath := filepath.Join(dir, fmt.Sprintf("restored%d.db", i))
+		if err := Restore(dbPath, bytes.NewReader(test.stream)); err == nil {
+			t.Errorf("%s: Restore succeeded", test.name)
+		}
+		if fileExists(dbPath) {
+			t.Errorf("%s: partially restored database was not removed", test.name)
+		}
+	}
+}
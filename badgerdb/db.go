@@ -6,15 +6,16 @@
 package badgerdb
 
 import (
-	"bytes"
+	"crypto/cipher"
 	"io"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/decred/dcrwallet/errors"
 	"github.com/decred/dcrwallet/wallet/walletdb"
 	"github.com/dgraph-io/badger"
-	"github.com/dgraph-io/badger/options"
 )
 
 // convertErr wraps a driver-specific error with an error code.
@@ -23,85 +24,65 @@ func convertErr(err error) error {
 		return nil
 	}
 	var kind errors.Kind
-	switch err {
+	switch cause(err) {
 	case badger.ErrValueLogSize, badger.ErrValueThreshold, badger.ErrTxnTooBig, badger.ErrReadOnlyTxn, badger.ErrDiscardedTxn, badger.ErrEmptyKey, badger.ErrThresholdZero,
-		badger.ErrRejected, badger.ErrInvalidRequest, badger.ErrManagedTxn, badger.ErrInvalidDump, badger.ErrZeroBandwidth, badger.ErrInvalidLoadingMode, badger.ErrWindowsNotSupported, badger.ErrReplayNeeded, badger.ErrTruncateNeeded:
+		badger.ErrRejected, badger.ErrInvalidRequest, badger.ErrManagedTxn, badger.ErrInvalidDump, badger.ErrZeroBandwidth, badger.ErrInvalidLoadingMode, badger.ErrWindowsNotSupported:
 		kind = errors.Invalid
 	case badger.ErrKeyNotFound:
 		kind = errors.NotExist
-	case badger.ErrConflict, badger.ErrRetry, badger.ErrNoRewrite:
+	case badger.ErrConflict, badger.ErrRetry, badger.ErrNoRewrite, badger.ErrReplayNeeded, badger.ErrTruncateNeeded:
 		kind = errors.IO
 	}
 	return errors.E(kind, err)
 }
 
+// cause returns the badger error that err wraps, if any.
+func cause(err error) error {
+	for {
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			return err
+		}
+		err = c.Cause()
+	}
+}
+
 // transaction represents a database transaction.  It can either by read-only or
 // read-write and implements the walletdb Tx interfaces.  The transaction
 // provides a root bucket against which all read and writes occur.
 type transaction struct {
 	badgerTx *badger.Txn
 	db       *badger.DB
-	buckets  []*Bucket
+	aead     cipher.AEAD
 	writable bool
 }
 
+func (tx *transaction) root() *Bucket {
+	return &Bucket{prefix: rootPrefix, dbTransaction: tx}
+}
+
 func (tx *transaction) ReadBucket(key []byte) walletdb.ReadBucket {
 	return tx.ReadWriteBucket(key)
 }
 
 func (tx *transaction) ReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
-	item, err := tx.badgerTx.Get(key)
-	if err != nil {
-		return nil
-	}
-	if item.UserMeta() != metaBucket {
+	bucket := tx.root().retrieveBucket(key)
+	if bucket == nil {
 		return nil
 	}
-	readWriteBucket := &Bucket{txn: tx.badgerTx, prefix: key, dbTransaction: tx}
-	tx.buckets = append(tx.buckets, readWriteBucket)
-	return readWriteBucket
+	return bucket
 }
 
 func (tx *transaction) CreateTopLevelBucket(key []byte) (walletdb.ReadWriteBucket, error) {
-	bucket, err := newBucket(tx.badgerTx, key, tx)
+	bucket, err := tx.root().bucket(key, false)
 	if err != nil {
 		return nil, err
 	}
-	tx.buckets = append(tx.buckets, bucket)
 	return bucket, nil
 }
 
 func (tx *transaction) DeleteTopLevelBucket(key []byte) error {
-	item, err := tx.badgerTx.Get(key)
-	if err != nil {
-		return convertErr(err)
-	}
-	if item.UserMeta() != metaBucket {
-		return errors.E(errors.Invalid)
-	}
-
-	tx.badgerTx.Delete(item.Key()[:])
-
-	it := tx.badgerTx.NewIterator(badger.DefaultIteratorOptions)
-	defer it.Close()
-	for it.Seek(key); it.ValidForPrefix(key); it.Next() {
-		item = it.Item()
-		val, err := item.Value()
-		if err != nil {
-			continue
-		}
-		prefixLength := int(val[0])
-		if bytes.Equal(item.Key()[:prefixLength], key) {
-			tx.badgerTx.Delete(item.Key()[:])
-		}
-	}
-	for i := range tx.buckets {
-		if bytes.Equal(tx.buckets[i].prefix, key) {
-			tx.buckets = append(tx.buckets[:i], tx.buckets[i+1:]...)
-			break
-		}
-	}
-	return nil
+	return tx.root().dropBucket(key)
 }
 
 // Commit commits all changes that have been made through the root bucket and
@@ -121,12 +102,8 @@ func (tx *transaction) Commit() error {
 //
 // This function is part of the walletdb.Tx interface implementation.
 func (tx *transaction) Rollback() error {
-	writeable := tx.writable
 	tx.badgerTx.Discard()
-	tx.badgerTx = tx.db.NewTransaction(writeable)
-	for _, b := range tx.buckets {
-		b.setTx(tx.badgerTx)
-	}
+	tx.badgerTx = tx.db.NewTransaction(tx.writable)
 	return nil
 }
 
@@ -138,24 +115,10 @@ var _ walletdb.ReadWriteBucket = (*Bucket)(nil)
 //
 // This function is part of the walletdb.ReadWriteBucket interface implementation.
 func (b *Bucket) NestedReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
-	copiedKey := make([]byte, len(key))
-	copy(copiedKey, key)
-	k, err := addPrefix(b.prefix, copiedKey)
-	if err != nil {
+	nestedBucket := b.retrieveBucket(key)
+	if nestedBucket == nil {
 		return nil
 	}
-	item, err := b.txn.Get(k)
-	if err != nil {
-		if err == badger.ErrKeyNotFound {
-			return nil
-		}
-		return nil
-	}
-	if item.UserMeta() != metaBucket {
-		return nil
-	}
-	nestedBucket := &Bucket{txn: b.txn, prefix: k, dbTransaction: b.dbTransaction}
-	b.dbTransaction.buckets = append(b.dbTransaction.buckets, nestedBucket)
 	return nestedBucket
 }
 
@@ -238,22 +201,6 @@ func (b *Bucket) Delete(key []byte) error {
 }
 
 func (b *Bucket) ReadCursor() walletdb.ReadCursor {
-
-	// If transaction is read-only, create a new transaction and return a new cursor
-	// This will be changed when the next version of badger gets released.
-	if !b.dbTransaction.writable {
-		txn := b.dbTransaction.db.NewTransaction(false)
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 100
-		it := txn.NewIterator(opts)
-		reverseOptions := badger.DefaultIteratorOptions
-		//Key-only iteration for faster search. Value gets fetched when item.Value() is called.
-		reverseOptions.PrefetchValues = false
-		reverseOptions.Reverse = true
-		txn = b.dbTransaction.db.NewTransaction(false)
-		reverseIterator := txn.NewIterator(reverseOptions)
-		return &Cursor{iterator: it, reverseIterator: reverseIterator, txn: txn, prefix: b.prefix, dbTransaction: b.dbTransaction}
-	}
 	return b.ReadWriteCursor()
 }
 
@@ -262,7 +209,7 @@ func (b *Bucket) ReadCursor() walletdb.ReadCursor {
 //
 // This function is part of the walletdb.Bucket interface implementation.
 func (b *Bucket) ReadWriteCursor() walletdb.ReadWriteCursor {
-	return b.badgerCursor()
+	return &Cursor{bucket: b}
 }
 
 // Delete removes the current key/value pair the cursor is at without
@@ -270,169 +217,42 @@ func (b *Bucket) ReadWriteCursor() walletdb.ReadWriteCursor {
 //
 // This function is part of the walletdb.Cursor interface implementation.
 func (c *Cursor) Delete() error {
-	if c.iterator.ValidForPrefix(c.prefix) {
-		item := c.iterator.Item()
-		if item.UserMeta() != metaBucket {
-			return c.txn.Delete(item.Key())
-		}
-
+	key, value := c.current()
+	if key == nil {
+		return nil
+	}
+	if value == nil {
 		return errors.E(errors.Invalid, "cursor points to a nested bucket")
 	}
-	return nil
+	return convertErr(c.bucket.delete(key))
 }
 
 // First positions the cursor at the first key/value pair and returns the pair.
 //
 // This function is part of the walletdb.Cursor interface implementation.
 func (c *Cursor) First() (key, value []byte) {
-	c.iterator.Rewind()
-	c.iterator.Seek(c.prefix)
-	if bytes.Equal(c.prefix, c.iterator.Item().Key()) {
-		c.iterator.Next()
-	}
-
-	if !c.iterator.ValidForPrefix(c.prefix) {
-		return nil, nil
-	}
-
-	item := c.iterator.Item()
-
-	val, err := item.ValueCopy(nil)
-	if err != nil {
-		return nil, nil
-	}
-
-	prefixLength := int(val[0])
-	if prefixLength == len(c.prefix) {
-		if bytes.Equal(item.Key()[:prefixLength], c.prefix) {
-			c.ck = item.KeyCopy(nil)
-			if item.UserMeta() == metaBucket {
-				return c.ck[prefixLength:], nil
-			}
-			return c.ck[prefixLength:], val[1:]
-		}
-	}
-
-	//No item found
-	return nil, nil
+	return c.load(c.bucket.prefix, false, false)
 }
 
 // Last positions the cursor at the last key/value pair and returns the pair.
 //
 // This function is part of the walletdb.Cursor interface implementation.
 func (c *Cursor) Last() (key, value []byte) {
-	var lastValidItem *badger.Item
-	c.iterator.Rewind()
-	for c.iterator.Seek(c.prefix); c.iterator.ValidForPrefix(c.prefix); c.iterator.Next() {
-		item := c.iterator.Item()
-		if bytes.Equal(c.prefix, item.Key()) {
-			continue
-		}
-		val, err := item.ValueCopy(nil)
-		if err != nil {
-			return nil, nil
-		}
-		prefixLength := int(val[0])
-		if bytes.Equal(c.ck[:prefixLength], c.prefix) {
-			lastValidItem = item
-		}
-	}
-	if lastValidItem != nil {
-		val, err := lastValidItem.ValueCopy(nil)
-		if err != nil {
-			return nil, nil
-		}
-		prefixLength := int(val[0])
-		c.ck = lastValidItem.KeyCopy(nil)
-		if lastValidItem.UserMeta() == metaBucket {
-			return c.ck[prefixLength:], nil
-		}
-		return c.ck[prefixLength:], val[1:]
-	}
-	return nil, nil
+	return c.load(c.bucket.lastKey(), false, true)
 }
 
 // Next moves the cursor one key/value pair forward and returns the new pair.
 //
 // This function is part of the walletdb.Cursor interface implementation.
 func (c *Cursor) Next() (key, value []byte) {
-	if c.ck == nil {
-		c.iterator.Seek(c.prefix)
-		if bytes.Equal(c.prefix, c.iterator.Item().Key()) {
-			c.iterator.Next()
-		}
-	} else {
-		c.iterator.Next()
-	}
-
-	if !c.iterator.ValidForPrefix(c.prefix) {
-		return nil, nil
-	}
-	item := c.iterator.Item()
-
-	val, err := item.ValueCopy(nil)
-	if err != nil {
-		return nil, nil
-	}
-
-	prefixLength := int(val[0])
-	if prefixLength == len(c.prefix) {
-		if bytes.Equal(item.Key()[:prefixLength], c.prefix) {
-			c.ck = item.KeyCopy(nil)
-			if item.UserMeta() == metaBucket {
-				return c.ck[prefixLength:], nil
-			}
-
-			return c.ck[prefixLength:], val[1:]
-		}
-	}
-
-	return nil, nil
+	return c.step(false)
 }
 
 // Prev moves the cursor one key/value pair backward and returns the new pair.
 //
 // This function is part of the walletdb.Cursor interface implementation.
 func (c *Cursor) Prev() (key, value []byte) {
-	if c.ck == nil {
-		c.reverseIterator.Seek(c.prefix)
-		if bytes.Equal(c.prefix, c.reverseIterator.Item().Key()) {
-			c.reverseIterator.Next()
-		}
-	} else {
-		// Next() is previous in reverse
-		c.reverseIterator.Seek(c.ck)
-		c.reverseIterator.Next()
-	}
-	if c.reverseIterator.Valid() {
-		c.iterator.Seek(c.reverseIterator.Item().Key())
-	}
-
-	if !c.reverseIterator.ValidForPrefix(c.prefix) {
-		return nil, nil
-	}
-
-	// Get the item from main iterator since item value is already fetched here.
-	item := c.reverseIterator.Item()
-
-	val, err := item.ValueCopy(nil)
-	if err != nil {
-		return nil, nil
-	}
-
-	prefixLength := int(val[0])
-	if prefixLength == len(c.prefix) {
-		if bytes.Equal(item.Key()[:prefixLength], c.prefix) {
-			c.ck = item.KeyCopy(nil)
-			if item.UserMeta() == metaBucket {
-				return c.ck[prefixLength:], nil
-			}
-			return c.ck[prefixLength:], val[1:]
-		}
-	}
-
-	//Item Not valid.
-	return nil, nil
+	return c.step(true)
 }
 
 // Seek positions the cursor at the passed seek key. If the key does not exist,
@@ -440,54 +260,46 @@ func (c *Cursor) Prev() (key, value []byte) {
 //
 // This function is part of the walletdb.Cursor interface implementation.
 func (c *Cursor) Seek(seek []byte) (key, value []byte) {
-	seekKey, err := addPrefix(c.prefix, seek)
-	if err != nil {
-		return nil, nil
-	}
-	c.iterator.Seek(seekKey)
-
-	if !c.iterator.ValidForPrefix(c.prefix) {
-		return nil, nil
-	}
-	item := c.iterator.Item()
-
-	val, err := item.ValueCopy(nil)
-	if err != nil {
-		return nil, nil
-	}
-
-	prefixLength := int(val[0])
-	if prefixLength == len(c.prefix) {
-		if bytes.Equal(item.Key()[:prefixLength], c.prefix) {
-			c.ck = item.KeyCopy(nil)
-			if item.UserMeta() == metaBucket {
-				return c.ck[prefixLength:], nil
-			}
-			return c.ck[prefixLength:], val[1:]
-		}
-	}
-
-	return nil, nil
+	start := append(append([]byte{}, c.bucket.prefix...), seek...)
+	return c.load(start, false, false)
 }
 
 // Close the cursor
 //
 // This function is part of the walletdb.Cursor interface implementation.
 func (c *Cursor) Close() {
-	c.iterator.Close()
+	c.batch = nil
 }
 
 // db represents a collection of namespaces which are persisted and implements
 // the walletdb.Db interface.  All database access is performed through
 // transactions which are obtained through the specific Namespace.
-type db badger.DB
+//
+// Each db runs its own value log garbage collection, which stops when the
+// database is closed.  aead is nil unless the database is encrypted.
+type db struct {
+	bdb          *badger.DB
+	aead         cipher.AEAD
+	readOnly     bool
+	path         string
+	discardRatio float64
+	quit         chan struct{}
+	gcDone       chan struct{}
+	closeOnce    sync.Once
+
+	// gcMu serializes value log garbage collection, which badger rejects
+	// while another collection is running.  lastGC holds the time.Time that
+	// the last collection ended.
+	gcMu   sync.Mutex
+	lastGC atomic.Value
+}
 
 // Enforce db implements the walletdb.Db interface.
 var _ walletdb.DB = (*db)(nil)
 
 func (db *db) beginTx(writable bool) (*transaction, error) {
-	tx := (*badger.DB)(db).NewTransaction(writable)
-	tran := &transaction{badgerTx: tx, writable: writable, db: (*badger.DB)(db)}
+	tx := db.bdb.NewTransaction(writable)
+	tran := &transaction{badgerTx: tx, writable: writable, db: db.bdb, aead: db.aead}
 	return tran, nil
 }
 
@@ -496,6 +308,9 @@ func (db *db) BeginReadTx() (walletdb.ReadTx, error) {
 }
 
 func (db *db) BeginReadWriteTx() (walletdb.ReadWriteTx, error) {
+	if db.readOnly {
+		return nil, errors.E(errors.Invalid, "database is read-only")
+	}
 	return db.beginTx(true)
 }
 
@@ -504,17 +319,70 @@ func (db *db) BeginReadWriteTx() (walletdb.ReadWriteTx, error) {
 //
 // This function is part of the walletdb.Db interface implementation.
 func (db *db) Copy(w io.Writer) error {
-	return errors.E(errors.Invalid, "method not implemented")
+	return writeCopy(db.bdb, w)
 }
 
 // Close cleanly shuts down the database and syncs all data.
 //
 // This function is part of the walletdb.Db interface implementation.
 func (db *db) Close() error {
-	if ticker != nil {
-		ticker.Stop()
+	err := errors.E(errors.Invalid, "database is closed")
+	db.closeOnce.Do(func() {
+		close(db.quit)
+		<-db.gcDone
+		db.gcMu.Lock()
+		defer db.gcMu.Unlock()
+		err = convertErr(db.bdb.Close())
+	})
+	return err
+}
+
+// runGC collects garbage in the value log every interval until the database is
+// closed.
+func (db *db) runGC(interval time.Duration) {
+	defer close(db.gcDone)
+	if interval < 0 {
+		<-db.quit
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-db.quit:
+			return
+		}
+		db.collectGarbage()
+	}
+}
+
+// collectGarbage rewrites value log files until no file has enough garbage to
+// be rewritten or the database is closed.
+func (db *db) collectGarbage() error {
+	if db.readOnly {
+		return errors.E(errors.Invalid, "database is read-only")
+	}
+	db.gcMu.Lock()
+	defer db.gcMu.Unlock()
+	defer func() { db.lastGC.Store(time.Now()) }()
+
+	// Each successful run rewrites a single value log file, so run again
+	// until nothing is left to collect.
+	for {
+		select {
+		case <-db.quit:
+			return errors.E(errors.Invalid, "database is closed")
+		default:
+		}
+		err := db.bdb.RunValueLogGC(db.discardRatio)
+		if err == badger.ErrNoRewrite {
+			return nil
+		}
+		if err != nil {
+			return convertErr(err)
+		}
 	}
-	return convertErr((*badger.DB)(db).Close())
 }
 
 // filesExists reports whether the named file or directory exists.
@@ -527,39 +395,62 @@ func fileExists(name string) bool {
 	return true
 }
 
-var ticker *time.Ticker
-
-// openDB opens the database at the provided path.
-func openDB(dbPath string, create bool) (walletdb.DB, error) {
+// openDB opens the database at the provided path.  Existing databases using an
+// older key encoding are upgraded.  Encrypted databases are opened with
+// opts.Passphrase, and created databases are encrypted if opts.Encrypt is set.
+// Read-only databases are not upgraded.
+func openDB(dbPath string, create bool, opts *Options) (*db, error) {
+	opts = opts.withDefaults()
+	if opts.ReadOnly && create {
+		return nil, errors.E(errors.Invalid, "read-only databases cannot be created")
+	}
+	if !opts.ReadOnly {
+		if err := recoverUpgrade(dbPath); err != nil {
+			return nil, err
+		}
+	}
 	if !create && !fileExists(dbPath) {
 		return nil, errors.E(errors.NotExist, "missing database file")
 	}
-	opts := badger.DefaultOptions
-	opts.Dir = dbPath
-	opts.ValueDir = dbPath
-	opts.ValueLogLoadingMode = options.FileIO
-	opts.TableLoadingMode = options.MemoryMap
-	opts.ValueLogFileSize = 209715200
-	opts.MaxTableSize = 40000000
-	opts.LevelOneSize = 209715200
-	opts.NumMemtables = 1
-	opts.NumCompactors = 1
-	opts.NumLevelZeroTables = 1
-	opts.NumLevelZeroTablesStall = 2
-
-	badgerDb, err := badger.Open(opts)
-	if err == nil {
-		go func() {
-			ticker = time.NewTicker(20 * time.Second)
-			for range ticker.C {
-			again:
-				err := badgerDb.RunValueLogGC(0.7)
-				if err == nil {
-					goto again
-				}
-			}
-		}()
+
+	badgerDb, err := badger.Open(opts.badgerOptions(dbPath))
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	switch {
+	case opts.ReadOnly:
+		err = checkVersion(badgerDb)
+		if err != nil {
+			badgerDb.Close()
+		}
+	case !create:
+		badgerDb, err = upgradeDB(badgerDb, dbPath, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	aead, err := openEncryption(badgerDb, opts.Passphrase)
+	if err == nil && aead == nil && create && opts.Encrypt {
+		aead, err = createEncryption(badgerDb, opts.Passphrase)
+	}
+	if err != nil {
+		badgerDb.Close()
+		return nil, err
 	}
 
-	return (*db)(badgerDb), convertErr(err)
+	db := &db{
+		bdb:          badgerDb,
+		aead:         aead,
+		readOnly:     opts.ReadOnly,
+		path:         dbPath,
+		discardRatio: opts.GCDiscardRatio,
+		quit:         make(chan struct{}),
+		gcDone:       make(chan struct{}),
+	}
+	gcInterval := opts.GCInterval
+	if opts.ReadOnly {
+		gcInterval = -1
+	}
+	go db.runGC(gcInterval)
+	return db, nil
 }
@@ -16,42 +16,64 @@ const (
 	dbType = "badgerdb"
 )
 
-// parseArgs parses the arguments from the walletdb Open/Create methods.
-func parseArgs(funcName string, args ...interface{}) (string, error) {
-	if len(args) != 1 {
-		return "", errors.Errorf("invalid arguments to %s.%s -- "+
-			"expected database path", dbType, funcName)
+// parseArgs parses the arguments from the walletdb Open/Create methods.  The
+// database path may be followed by *Options.
+func parseArgs(funcName string, args ...interface{}) (string, *Options, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return "", nil, errors.Errorf("invalid arguments to %s.%s -- "+
+			"expected database path and optional options", dbType, funcName)
 	}
 
 	dbPath, ok := args[0].(string)
 	if !ok {
-		return "", errors.Errorf("first argument to %s.%s is invalid -- "+
+		return "", nil, errors.Errorf("first argument to %s.%s is invalid -- "+
 			"expected database path string", dbType, funcName)
 	}
 
-	return dbPath, nil
+	var opts *Options
+	if len(args) == 2 {
+		opts, ok = args[1].(*Options)
+		if !ok {
+			return "", nil, errors.Errorf("second argument to %s.%s is invalid -- "+
+				"expected *badgerdb.Options", dbType, funcName)
+		}
+	}
+
+	return dbPath, opts, nil
 }
 
 // openDBDriver is the callback provided during driver registration that opens
 // an existing database for use.
 func openDBDriver(args ...interface{}) (walletdb.DB, error) {
-	dbPath, err := parseArgs("Open", args...)
+	dbPath, opts, err := parseArgs("Open", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return openDB(dbPath, false)
+	walletDB, err := openDB(dbPath, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	return walletDB, nil
 }
 
 // createDBDriver is the callback provided during driver registration that
 // creates, initializes, and opens a database for use.
 func createDBDriver(args ...interface{}) (walletdb.DB, error) {
-	dbPath, err := parseArgs("Create", args...)
+	dbPath, opts, err := parseArgs("Create", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return openDB(dbPath, true)
+	walletDB, err := openDB(dbPath, true, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeVersion(walletDB.bdb); err != nil {
+		walletDB.Close()
+		return nil, err
+	}
+	return walletDB, nil
 }
 
 func init() {
@@ -0,0 +1,21 @@
+package badgerdb_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/raedahgroup/mobilewallet/badgerdb"
+	"github.com/raedahgroup/mobilewallet/walletdbtest"
+)
+
+func TestInterface(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badgerdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	walletdbtest.TestInterface(t, "badgerdb", filepath.Join(dir, "wallet.db"))
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2018 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package badgerdb
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet/walletdb"
+	"github.com/dgraph-io/badger"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted databases protect the value of every key with XChaCha20-Poly1305
+// under a random database key, using the database key of the value as
+// additional data so values cannot be moved between keys.  Keys themselves are
+// stored in plain form, as buckets and cursors depend on their order.
+//
+// The database key is recorded under encryptionKey wrapped by a key derived
+// from a passphrase with scrypt.  Changing the passphrase only rewraps the
+// database key.  While a change is in progress the database key is wrapped by
+// both the old and the new passphrase, so a database can always be opened with
+// one of them.  Values are only encrypted under a new database key, or a
+// plaintext database encrypted, by copying them into a new encrypted database
+// with walletdb, which a crash cannot leave half converted.
+
+const (
+	// Key derivation parameters for database passphrases.
+	dbScryptN = 1 << 15
+	dbScryptR = 8
+	dbScryptP = 1
+
+	dbKeySize  = chacha20poly1305.KeySize
+	dbSaltSize = 16
+	dbTagSize  = 16 // Poly1305 authenticator
+
+	// wrappedKeySize is the size of a salt, nonce and sealed database key.
+	wrappedKeySize = dbSaltSize + chacha20poly1305.NonceSizeX + dbKeySize + dbTagSize
+)
+
+// encryptionKey records the wrapped database keys of an encrypted database.
+// Keys beginning with a zero byte are reserved for the driver.
+var encryptionKey = []byte("\x00encryption")
+
+func wrappingKey(passphrase, salt []byte) (cipher.AEAD, error) {
+	k, err := scrypt.Key(passphrase, salt, dbScryptN, dbScryptR, dbScryptP, dbKeySize)
+	if err != nil {
+		return nil, errors.E(errors.Crypto, err)
+	}
+	defer zero(k)
+	aead, err := chacha20poly1305.NewX(k)
+	if err != nil {
+		return nil, errors.E(errors.Crypto, err)
+	}
+	return aead, nil
+}
+
+// wrapKey seals the database key with a key derived from passphrase.
+func wrapKey(key, passphrase []byte) ([]byte, error) {
+	wrapped := make([]byte, dbSaltSize+chacha20poly1305.NonceSizeX, wrappedKeySize)
+	if _, err := rand.Read(wrapped); err != nil {
+		return nil, errors.E(errors.Crypto, err)
+	}
+	aead, err := wrappingKey(passphrase, wrapped[:dbSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(wrapped, wrapped[dbSaltSize:], key, nil), nil
+}
+
+// unwrapKey opens a database key sealed by wrapKey.  It returns nil if the key
+// was not wrapped with passphrase.
+func unwrapKey(wrapped, passphrase []byte) ([]byte, error) {
+	aead, err := wrappingKey(passphrase, wrapped[:dbSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	nonce := wrapped[dbSaltSize : dbSaltSize+chacha20poly1305.NonceSizeX]
+	key, err := aead.Open(nil, nonce, wrapped[len(nonce)+dbSaltSize:], nil)
+	if err != nil {
+		return nil, nil
+	}
+	return key, nil
+}
+
+// readWrappedKeys returns the wrapped database keys of the database, or nil if
+// the database is not encrypted.
+func readWrappedKeys(bdb *badger.DB) ([][]byte, error) {
+	var keys [][]byte
+	err := bdb.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(encryptionKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if len(v) == 0 || len(v)%wrappedKeySize != 0 {
+			return errors.E(errors.Encoding, "invalid database encryption record")
+		}
+		for len(v) > 0 {
+			keys = append(keys, v[:wrappedKeySize])
+			v = v[wrappedKeySize:]
+		}
+		return nil
+	})
+	return keys, convertErr(err)
+}
+
+func writeWrappedKeys(bdb *badger.DB, keys [][]byte) error {
+	return convertErr(bdb.Update(func(txn *badger.Txn) error {
+		return txn.Set(encryptionKey, bytes.Join(keys, nil))
+	}))
+}
+
+// findKey returns the database key and the index of the wrapped key that
+// passphrase opens.
+func findKey(keys [][]byte, passphrase []byte) ([]byte, int, error) {
+	if len(passphrase) == 0 {
+		return nil, 0, errors.E(errors.Passphrase, "database is encrypted")
+	}
+	for i, wrapped := range keys {
+		key, err := unwrapKey(wrapped, passphrase)
+		if err != nil {
+			return nil, 0, err
+		}
+		if key != nil {
+			return key, i, nil
+		}
+	}
+	return nil, 0, errors.E(errors.Passphrase, "invalid database passphrase")
+}
+
+// createEncryption generates and records the key of a new encrypted database.
+func createEncryption(bdb *badger.DB, passphrase []byte) (cipher.AEAD, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.E(errors.Invalid, "encrypted databases require a passphrase")
+	}
+	key := make([]byte, dbKeySize)
+	defer zero(key)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.E(errors.Crypto, err)
+	}
+	wrapped, err := wrapKey(key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeWrappedKeys(bdb, [][]byte{wrapped}); err != nil {
+		return nil, err
+	}
+	return valueCipher(key)
+}
+
+// openEncryption unwraps the key of an encrypted database.  It returns nil if
+// the database is not encrypted.
+func openEncryption(bdb *badger.DB, passphrase []byte) (cipher.AEAD, error) {
+	keys, err := readWrappedKeys(bdb)
+	if err != nil || keys == nil {
+		return nil, err
+	}
+	key, _, err := findKey(keys, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+	return valueCipher(key)
+}
+
+func valueCipher(key []byte) (cipher.AEAD, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, errors.E(errors.Crypto, err)
+	}
+	return aead, nil
+}
+
+// sealValue encrypts the value stored under the database key k.  The nonce
+// precedes the sealed value.
+func sealValue(aead cipher.AEAD, k, value []byte) ([]byte, error) {
+	sealed := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(sealed); err != nil {
+		return nil, errors.E(errors.Crypto, err)
+	}
+	return aead.Seal(sealed, sealed, value, k), nil
+}
+
+// openValue decrypts a value sealed by sealValue for the database key k.
+func openValue(aead cipher.AEAD, k, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.E(errors.Crypto, "encrypted value is truncated")
+	}
+	nonce := sealed[:aead.NonceSize()]
+	value, err := aead.Open(nil, nonce, sealed[len(nonce):], k)
+	if err != nil {
+		return nil, errors.E(errors.Crypto, "encrypted value failed authentication")
+	}
+	return value, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// IsEncrypted returns whether a database opened with the badgerdb driver
+// encrypts its values.
+func IsEncrypted(walletDB walletdb.DB) (bool, error) {
+	db, err := badgerDB(walletDB)
+	if err != nil {
+		return false, err
+	}
+	return db.aead != nil, nil
+}
+
+// ChangePassphrase wraps the key of an encrypted database with newPass in
+// addition to oldPass, so the database can be opened with either passphrase.
+// CommitPassphrase must be called once the change is complete to remove the
+// other passphrase.  The database key is unchanged, so values remain readable
+// by anyone who learned it with the old passphrase until they are copied into a
+// new database.
+func ChangePassphrase(walletDB walletdb.DB, oldPass, newPass []byte) error {
+	db, err := badgerDB(walletDB)
+	if err != nil {
+		return err
+	}
+	if db.aead == nil {
+		return errors.E(errors.Invalid, "database is not encrypted")
+	}
+	if len(newPass) == 0 {
+		return errors.E(errors.Invalid, "encrypted databases require a passphrase")
+	}
+	keys, err := readWrappedKeys(db.bdb)
+	if err != nil {
+		return err
+	}
+	key, i, err := findKey(keys, oldPass)
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+	wrapped, err := wrapKey(key, newPass)
+	if err != nil {
+		return err
+	}
+	return writeWrappedKeys(db.bdb, [][]byte{keys[i], wrapped})
+}
+
+// CommitPassphrase removes every passphrase of an encrypted database other than
+// pass, completing or reverting a ChangePassphrase.
+func CommitPassphrase(walletDB walletdb.DB, pass []byte) error {
+	db, err := badgerDB(walletDB)
+	if err != nil {
+		return err
+	}
+	if db.aead == nil {
+		return errors.E(errors.Invalid, "database is not encrypted")
+	}
+	keys, err := readWrappedKeys(db.bdb)
+	if err != nil {
+		return err
+	}
+	key, i, err := findKey(keys, pass)
+	if err != nil {
+		return err
+	}
+	zero(key)
+	if len(keys) == 1 {
+		return nil
+	}
+	return writeWrappedKeys(db.bdb, [][]byte{keys[i]})
+}
@@ -0,0 +1,246 @@
+package badgerdb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet/walletdb"
+	"github.com/dgraph-io/badger"
+)
+
+func TestSealOpenValue(t *testing.T) {
+	key := make([]byte, dbKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	aead, err := valueCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, value := []byte("key"), []byte("value")
+	sealed, err := sealValue(aead, k, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := sealValue(aead, k, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Errorf("sealing a value twice gave the same result")
+	}
+	opened, err := openValue(aead, k, sealed)
+	if err != nil {
+		t.Fatalf("openValue: %v", err)
+	}
+	if !bytes.Equal(opened, value) {
+		t.Errorf("opened %q, want %q", opened, value)
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	tests := []struct {
+		name   string
+		k      []byte
+		sealed []byte
+	}{
+		{"other key", []byte("other"), sealed},
+		{"tampered", k, tampered},
+		{"truncated", k, sealed[:len(sealed)-1]},
+		{"nonce only", k, sealed[:aead.NonceSize()]},
+		{"short nonce", k, sealed[:aead.NonceSize()-1]},
+	}
+	for _, test := range tests {
+		_, err := openValue(aead, test.k, test.sealed)
+		if !errors.Is(errors.Crypto, err) {
+			t.Errorf("%s: openValue returned %v, want a crypto error", test.name, err)
+		}
+	}
+}
+
+// createEncryptedTestDB creates an encrypted database at dbPath filled by
+// fillCopyTestDB and returns its contents.
+func createEncryptedTestDB(t *testing.T, dbPath string, passphrase []byte) map[string]string {
+	db, err := walletdb.Create(dbType, dbPath, &Options{Encrypt: true, Passphrase: passphrase})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	encrypted, err := IsEncrypted(db)
+	if err != nil || !encrypted {
+		t.Fatalf("created database is not encrypted (%v)", err)
+	}
+	fillCopyTestDB(t, db)
+	return dbContents(t, db)
+}
+
+func openEncryptedTestDB(dbPath string, passphrase []byte) (walletdb.DB, error) {
+	return walletdb.Open(dbType, dbPath, &Options{Passphrase: passphrase})
+}
+
+// checkEncryptedTestDB opens the database at dbPath with passphrase and checks
+// that it holds want.
+func checkEncryptedTestDB(t *testing.T, dbPath string, passphrase []byte, want map[string]string) {
+	db, err := openEncryptedTestDB(dbPath, passphrase)
+	if err != nil {
+		t.Fatalf("opening with %q: %v", passphrase, err)
+	}
+	defer db.Close()
+	got := dbContents(t, db)
+	if len(got) != len(want) {
+		t.Fatalf("opened %d keys, want %d", len(got), len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%q = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func checkPassphraseRefused(t *testing.T, dbPath string, passphrase []byte) {
+	db, err := openEncryptedTestDB(dbPath, passphrase)
+	if err == nil {
+		db.Close()
+		t.Fatalf("database opened with %q", passphrase)
+	}
+	if !errors.Is(errors.Passphrase, err) {
+		t.Errorf("opening with %q returned %v, want a passphrase error", passphrase, err)
+	}
+}
+
+func TestEncryptedDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badgerdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "encrypted.db")
+	pass := []byte("passphrase")
+	want := createEncryptedTestDB(t, dbPath, pass)
+	checkEncryptedTestDB(t, dbPath, pass, want)
+	checkPassphraseRefused(t, dbPath, []byte("wrong"))
+	checkPassphraseRefused(t, dbPath, nil)
+
+	// No value is stored in plain form.
+	bdb, err := badger.Open((&Options{}).withDefaults().badgerOptions(dbPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+	err = bdb.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			v, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			for _, plain := range want {
+				if len(plain) > 0 && bytes.Contains(v, []byte(plain)) {
+					t.Errorf("value of %q is stored in plain form", it.Item().Key())
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlaintextDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badgerdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "plain.db")
+	db, err := walletdb.Create(dbType, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fillCopyTestDB(t, db)
+	want := dbContents(t, db)
+	if encrypted, err := IsEncrypted(db); err != nil || encrypted {
+		t.Errorf("plaintext database is encrypted (%v)", err)
+	}
+	if err := ChangePassphrase(db, nil, []byte("new")); !errors.Is(errors.Invalid, err) {
+		t.Errorf("ChangePassphrase of a plaintext database returned %v", err)
+	}
+	db.Close()
+
+	// The passphrase is ignored.
+	checkEncryptedTestDB(t, dbPath, []byte("any"), want)
+}
+
+func TestChangePassphrase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badgerdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "encrypted.db")
+	oldPass, newPass, otherPass := []byte("old"), []byte("new"), []byte("other")
+	want := createEncryptedTestDB(t, dbPath, oldPass)
+
+	change := func(from, to []byte) error {
+		db, err := openEncryptedTestDB(dbPath, from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		return ChangePassphrase(db, from, to)
+	}
+	commit := func(open, pass []byte) {
+		db, err := openEncryptedTestDB(dbPath, open)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if err := CommitPassphrase(db, pass); err != nil {
+			t.Fatalf("CommitPassphrase: %v", err)
+		}
+	}
+
+	// While a change is in progress both passphrases open the database.
+	if err := change(oldPass, newPass); err != nil {
+		t.Fatalf("ChangePassphrase: %v", err)
+	}
+	checkEncryptedTestDB(t, dbPath, oldPass, want)
+	checkEncryptedTestDB(t, dbPath, newPass, want)
+	commit(oldPass, newPass)
+	checkEncryptedTestDB(t, dbPath, newPass, want)
+	checkPassphraseRefused(t, dbPath, oldPass)
+
+	// A reverted change keeps the current passphrase only.
+	if err := change(newPass, otherPass); err != nil {
+		t.Fatalf("ChangePassphrase: %v", err)
+	}
+	commit(otherPass, newPass)
+	checkEncryptedTestDB(t, dbPath, newPass, want)
+	checkPassphraseRefused(t, dbPath, otherPass)
+
+	db, err := openEncryptedTestDB(dbPath, newPass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := ChangePassphrase(db, oldPass, otherPass); !errors.Is(errors.Passphrase, err) {
+		t.Errorf("ChangePassphrase with a wrong passphrase returned %v", err)
+	}
+	if err := ChangePassphrase(db, newPass, nil); !errors.Is(errors.Invalid, err) {
+		t.Errorf("ChangePassphrase to an empty passphrase returned %v", err)
+	}
+	if err := CommitPassphrase(db, otherPass); !errors.Is(errors.Passphrase, err) {
+		t.Errorf("CommitPassphrase with a wrong passphrase returned %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2018 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package badgerdb
+
+import (
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/dgraph-io/badger/options"
+)
+
+// Options tunes a badgerdb database.  A *Options may be passed to
+// walletdb.Create and walletdb.Open after the database path.  Zero fields take
+// the value from DefaultOptions.
+//
+// MaxTableSize also bounds the size of a single transaction to roughly 15% of
+// its value, so it should not be lowered far below the default.
+type Options struct {
+	ValueLogFileSize        int64
+	MaxTableSize            int64
+	LevelOneSize            int64
+	NumMemtables            int
+	NumCompactors           int
+	NumLevelZeroTables      int
+	NumLevelZeroTablesStall int
+
+	// Loading modes are only taken from Options when SetLoadingModes is
+	// true, as the zero mode is a valid mode.
+	SetLoadingModes     bool
+	TableLoadingMode    options.FileLoadingMode
+	ValueLogLoadingMode options.FileLoadingMode
+
+	// GCInterval is the time between value log garbage collections.  A
+	// negative interval disables garbage collection.  GCDiscardRatio is the
+	// fraction of a value log file that must be discardable for it to be
+	// rewritten.
+	GCInterval     time.Duration
+	GCDiscardRatio float64
+
+	// Encrypt causes a created database to encrypt its values with a key
+	// protected by Passphrase.  Opening an encrypted database requires a
+	// passphrase it was encrypted with, and Passphrase is ignored when
+	// opening a database that is not encrypted.
+	Encrypt    bool
+	Passphrase []byte
+
+	// ReadOnly opens a database without write access.  Write transactions
+	// are refused and value log garbage collection does not run.  The
+	// database must have been closed cleanly and may be shared with other
+	// read-only opens, but not with a process writing to it.
+	ReadOnly bool
+}
+
+// DefaultOptions returns the options used when none are given.  They suit most
+// phones.
+func DefaultOptions() *Options {
+	return &Options{
+		ValueLogFileSize:        209715200,
+		MaxTableSize:            40000000,
+		LevelOneSize:            209715200,
+		NumMemtables:            1,
+		NumCompactors:           1,
+		NumLevelZeroTables:      1,
+		NumLevelZeroTablesStall: 2,
+		SetLoadingModes:         true,
+		TableLoadingMode:        options.MemoryMap,
+		ValueLogLoadingMode:     options.FileIO,
+		GCInterval:              20 * time.Second,
+		GCDiscardRatio:          0.7,
+	}
+}
+
+// LowMemoryOptions returns options for memory-constrained devices.  Tables are
+// read from disk rather than memory-mapped, value log files are smaller, and
+// garbage collection runs less often.
+func LowMemoryOptions() *Options {
+	o := DefaultOptions()
+	o.ValueLogFileSize = 67108864
+	o.LevelOneSize = 67108864
+	o.TableLoadingMode = options.FileIO
+	o.GCInterval = time.Minute
+	return o
+}
+
+// FastOptions returns options that trade memory for speed, which suit devices
+// with plenty of memory and wallets with many transactions.
+func FastOptions() *Options {
+	o := DefaultOptions()
+	o.ValueLogFileSize = 1<<30 - 1
+	o.MaxTableSize = 64 << 20
+	o.LevelOneSize = 256 << 20
+	o.NumMemtables = 5
+	o.NumCompactors = 3
+	o.NumLevelZeroTables = 5
+	o.NumLevelZeroTablesStall = 10
+	o.ValueLogLoadingMode = options.MemoryMap
+	o.GCInterval = 5 * time.Minute
+	o.GCDiscardRatio = 0.5
+	return o
+}
+
+// withDefaults returns a copy of o with zero fields set from DefaultOptions.
+func (o *Options) withDefaults() *Options {
+	d := DefaultOptions()
+	if o == nil {
+		return d
+	}
+	r := *o
+	if r.ValueLogFileSize == 0 {
+		r.ValueLogFileSize = d.ValueLogFileSize
+	}
+	if r.MaxTableSize == 0 {
+		r.MaxTableSize = d.MaxTableSize
+	}
+	if r.LevelOneSize == 0 {
+		r.LevelOneSize = d.LevelOneSize
+	}
+	if r.NumMemtables == 0 {
+		r.NumMemtables = d.NumMemtables
+	}
+	if r.NumCompactors == 0 {
+		r.NumCompactors = d.NumCompactors
+	}
+	if r.NumLevelZeroTables == 0 {
+		r.NumLevelZeroTables = d.NumLevelZeroTables
+	}
+	if r.NumLevelZeroTablesStall == 0 {
+		r.NumLevelZeroTablesStall = d.NumLevelZeroTablesStall
+	}
+	if !r.SetLoadingModes {
+		r.SetLoadingModes = true
+		r.TableLoadingMode = d.TableLoadingMode
+		r.ValueLogLoadingMode = d.ValueLogLoadingMode
+	}
+	if r.GCInterval == 0 {
+		r.GCInterval = d.GCInterval
+	}
+	if r.GCDiscardRatio == 0 {
+		r.GCDiscardRatio = d.GCDiscardRatio
+	}
+	return &r
+}
+
+// badgerOptions returns the badger options for the database at dbPath.
+func (o *Options) badgerOptions(dbPath string) badger.Options {
+	opts := badger.DefaultOptions
+	opts.Dir = dbPath
+	opts.ValueDir = dbPath
+	opts.ValueLogLoadingMode = o.ValueLogLoadingMode
+	opts.TableLoadingMode = o.TableLoadingMode
+	opts.ValueLogFileSize = o.ValueLogFileSize
+	opts.MaxTableSize = o.MaxTableSize
+	opts.LevelOneSize = o.LevelOneSize
+	opts.NumMemtables = o.NumMemtables
+	opts.NumCompactors = o.NumCompactors
+	opts.NumLevelZeroTables = o.NumLevelZeroTables
+	opts.NumLevelZeroTablesStall = o.NumLevelZeroTablesStall
+	opts.ReadOnly = o.ReadOnly
+	return opts
+}
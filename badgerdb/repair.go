@@ -0,0 +1,295 @@
+// Copyright (c) 2018 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package badgerdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/decred/dcrwallet/errors"
+	"github.com/dgraph-io/badger"
+	"github.com/dgraph-io/badger/options"
+)
+
+// RepairReport describes what Repair found in a database and what it changed.
+type RepairReport struct {
+	// Truncated is set when the value log ended with a torn write, which was
+	// truncated.  Transactions committed after the torn write are lost.
+	// BackupPath holds a copy of the database files taken before truncating
+	// or removing orphaned keys.
+	Truncated  bool
+	BackupPath string
+
+	// Replayed is set when the database was not closed cleanly and its
+	// value log was replayed, which recovers every committed transaction.
+	// Only read-only opens require this to be done first.
+	Replayed bool
+
+	// Buckets and Keys count the buckets and keys that were found.
+	Buckets int
+	Keys    int
+
+	// OrphanedKeys counts keys of buckets that no longer exist, which were
+	// removed.  UnparsableKeys counts keys that are not encoded as keys of a
+	// bucket, and CorruptValues counts values that could not be read or
+	// failed authentication, which are both kept.
+	OrphanedKeys   int
+	UnparsableKeys int
+	CorruptValues  int
+}
+
+// IsRepairNeeded returns whether err, returned when opening a database, means
+// the database was not closed cleanly and must be repaired with Repair before
+// it can be opened.  This is the case when the value log ends with a torn
+// write, or when a database that was not closed cleanly is opened read-only
+// and its value log must first be replayed.
+func IsRepairNeeded(err error) bool {
+	for {
+		e, ok := err.(*errors.Error)
+		if !ok {
+			break
+		}
+		err = e.Err
+	}
+	err = cause(err)
+	return err == badger.ErrTruncateNeeded || err == badger.ErrReplayNeeded
+}
+
+// Repair opens the database at dbPath, which must not be open, and checks that
+// every key belongs to an existing bucket and that every value can be read.
+// If the value log ends with a torn write, as left by a crash during a commit,
+// the database files are first copied to backupPath and the torn write is
+// truncated.  Keys of buckets that no longer exist are removed, after copying
+// the database files to backupPath if that was not done already.  The
+// database is opened with write access, which replays the value log of a
+// database that was not closed cleanly.  opts must hold the passphrase of an
+// encrypted database.
+func Repair(dbPath, backupPath string, opts *Options) (*RepairReport, error) {
+	if err := recoverUpgrade(dbPath); err != nil {
+		return nil, err
+	}
+	if !fileExists(dbPath) {
+		return nil, errors.E(errors.NotExist, "missing database file")
+	}
+
+	opts = opts.withDefaults()
+	// badger only truncates value log files that are not memory-mapped.
+	badgerOpts := opts.badgerOptions(dbPath)
+	badgerOpts.ValueLogLoadingMode = options.FileIO
+
+	// A read-only open fails without changing anything if the value log must
+	// be replayed, which the read-write open below does.
+	report := new(RepairReport)
+	probeOpts := badgerOpts
+	probeOpts.ReadOnly = true
+	if bdb, err := badger.Open(probeOpts); err == nil {
+		bdb.Close()
+	} else if cause(err) == badger.ErrReplayNeeded {
+		report.Replayed = true
+	}
+
+	badgerOpts.ReadOnly = false
+	bdb, err := badger.Open(badgerOpts)
+	if cause(err) == badger.ErrTruncateNeeded {
+		if err := copyFiles(dbPath, backupPath); err != nil {
+			return nil, err
+		}
+		report.Truncated = true
+		report.BackupPath = backupPath
+		badgerOpts.Truncate = true
+		bdb, err = badger.Open(badgerOpts)
+	}
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	bdb, err = upgradeDB(bdb, dbPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if report.Replayed || report.Truncated {
+		// badger only records how far the value log was replayed when a
+		// write follows, so read-only opens would otherwise replay again.
+		if err := writeVersion(bdb); err != nil {
+			bdb.Close()
+			return nil, err
+		}
+	}
+	orphans, err := checkBuckets(bdb, opts.Passphrase, report)
+	closeErr := bdb.Close()
+	if err == nil {
+		err = convertErr(closeErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(orphans) == 0 {
+		return report, nil
+	}
+
+	// The backup taken before truncating holds the orphaned keys too.
+	if !report.Truncated {
+		if err := copyFiles(dbPath, backupPath); err != nil {
+			return nil, err
+		}
+		report.BackupPath = backupPath
+	}
+	if err := deleteKeys(badgerOpts, orphans); err != nil {
+		return nil, err
+	}
+	report.OrphanedKeys = len(orphans)
+	return report, nil
+}
+
+// checkBuckets counts the buckets, keys, unparsable keys and corrupt values of
+// the database into report and returns the keys that do not belong to an
+// existing bucket.
+func checkBuckets(bdb *badger.DB, passphrase []byte, report *RepairReport) ([][]byte, error) {
+	aead, err := openEncryption(bdb, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bucket records sort before the keys of the bucket, as the depth that
+	// begins the keys of a bucket is greater than that of its record.
+	buckets := map[string]bool{string(rootPrefix): true}
+	var orphans [][]byte
+	err = bdb.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			k := item.Key()
+			if k[0] == 0 {
+				// Reserved for the driver.
+				continue
+			}
+			prefix, name, ok := splitKey(k)
+			if !ok {
+				report.UnparsableKeys++
+				continue
+			}
+			isBucket := item.UserMeta() == metaBucket
+			if !buckets[string(prefix)] || (!isBucket && bytes.Equal(prefix, rootPrefix)) {
+				orphans = append(orphans, item.KeyCopy(nil))
+				continue
+			}
+			if isBucket {
+				report.Buckets++
+				buckets[string(childPrefix(prefix, name))] = true
+				continue
+			}
+			report.Keys++
+			v, err := item.Value()
+			if err == nil && aead != nil {
+				_, err = openValue(aead, k, v)
+			}
+			if err != nil {
+				report.CorruptValues++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	return orphans, nil
+}
+
+// deleteKeys opens the database with badgerOpts and removes keys from it.
+func deleteKeys(badgerOpts badger.Options, keys [][]byte) (err error) {
+	bdb, err := badger.Open(badgerOpts)
+	if err != nil {
+		return convertErr(err)
+	}
+	defer func() {
+		closeErr := bdb.Close()
+		if err == nil {
+			err = convertErr(closeErr)
+		}
+	}()
+
+	w := newBatchWriter(bdb)
+	defer w.discard()
+	for _, k := range keys {
+		if err := w.delete(k); err != nil {
+			return err
+		}
+	}
+	return w.commit()
+}
+
+// splitKey splits a database key into the prefix of its bucket and its key in
+// the bucket.  The bool is false if the key is not encoded as described in
+// bucket.go.
+func splitKey(k []byte) (prefix, key []byte, ok bool) {
+	depth, n := binary.Uvarint(k)
+	if n <= 0 || depth == 0 {
+		return nil, nil, false
+	}
+	for i := uint64(1); i < depth; i++ {
+		l, m := binary.Uvarint(k[n:])
+		if m <= 0 || l > uint64(len(k)-n-m) {
+			return nil, nil, false
+		}
+		n += m + int(l)
+	}
+	if n == len(k) {
+		return nil, nil, false
+	}
+	return k[:n], k[n:], true
+}
+
+// copyFiles copies the files of the database directory src into a new
+// directory dst.
+func copyFiles(src, dst string) error {
+	if fileExists(dst) {
+		return errors.E(errors.Exist, "backup already exists")
+	}
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	infos, err := ioutil.ReadDir(src)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || info.Name() == "LOCK" {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, info.Name()), filepath.Join(dst, info.Name())); err != nil {
+			os.RemoveAll(dst)
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
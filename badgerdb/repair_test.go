@@ -0,0 +1,242 @@
+package badgerdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/decred/dcrwallet/wallet/walletdb"
+	"github.com/dgraph-io/badger"
+)
+
+// writeRepairTestDB creates a database at dbPath holding n keys, each written
+// in its own transaction, and returns it open.
+func writeRepairTestDB(t *testing.T, dbPath string, n int) walletdb.DB {
+	db, err := walletdb.Create(dbType, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+			b, err := tx.CreateTopLevelBucket([]byte("bucket"))
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func checkRepairTestDB(t *testing.T, db walletdb.DB, n int) {
+	err := walletdb.View(db, func(tx walletdb.ReadTx) error {
+		b := tx.ReadBucket([]byte("bucket"))
+		if b == nil {
+			return fmt.Errorf("missing bucket")
+		}
+		for i := 0; i < n; i++ {
+			if b.Get([]byte(fmt.Sprintf("key%d", i))) == nil {
+				return fmt.Errorf("missing key%d", i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// crashCopy copies the files of an open database, as they would be found
+// after the process was killed.
+func crashCopy(t *testing.T, src, dst string) {
+	if err := copyFiles(src, dst); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRepairTornWrite simulates a crash in the middle of writing a commit to
+// the value log.
+func TestRepairTornWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badgerdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "wallet.db")
+	db := writeRepairTestDB(t, dbPath, 10)
+	db.Close()
+
+	vlogs, err := filepath.Glob(filepath.Join(dbPath, "*.vlog"))
+	if err != nil || len(vlogs) == 0 {
+		t.Fatalf("no value log files: %v", err)
+	}
+	f, err := os.OpenFile(vlogs[len(vlogs)-1], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A header and part of an entry that was never completed.
+	if _, err := f.Write([]byte{0, 0, 0, 5, 0, 0, 0, 9, 0, 0, 0, 0, 0, 0, 0, 1, 0, 'k'}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	_, err = walletdb.Open(dbType, dbPath)
+	if !IsRepairNeeded(err) {
+		t.Fatalf("opening a torn database returned %v", err)
+	}
+
+	backupPath := filepath.Join(dir, "backup")
+	report, err := Repair(dbPath, backupPath, nil)
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if !report.Truncated || report.BackupPath != backupPath || !fileExists(backupPath) {
+		t.Errorf("torn write was not truncated with a backup: %+v", report)
+	}
+	if report.Keys != 10 || report.CorruptValues != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	db, err = walletdb.Open(dbType, dbPath)
+	if err != nil {
+		t.Fatalf("opening the repaired database: %v", err)
+	}
+	defer db.Close()
+	checkRepairTestDB(t, db, 10)
+}
+
+// TestRepairReplay simulates a crash after commits that were written to the
+// value log but not yet flushed, which read-only opens cannot recover.
+func TestRepairReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badgerdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcPath := filepath.Join(dir, "source.db")
+	src := writeRepairTestDB(t, srcPath, 10)
+	defer src.Close()
+	dbPath := filepath.Join(dir, "wallet.db")
+	crashCopy(t, srcPath, dbPath)
+
+	_, err = walletdb.Open(dbType, dbPath, &Options{ReadOnly: true})
+	if !IsRepairNeeded(err) {
+		t.Fatalf("read-only open of an unclean database returned %v", err)
+	}
+
+	report, err := Repair(dbPath, filepath.Join(dir, "backup"), nil)
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if !report.Replayed || report.Truncated || report.Keys != 10 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	db, err := walletdb.Open(dbType, dbPath, &Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("read-only open of the repaired database: %v", err)
+	}
+	defer db.Close()
+	checkRepairTestDB(t, db, 10)
+}
+
+// rawKeys sets keys in the closed database at dbPath without the driver when
+// set is true, and otherwise returns which of them the database holds.
+func rawKeys(t *testing.T, dbPath string, keys [][]byte, set bool) []bool {
+	bdb, err := badger.Open((&Options{}).withDefaults().badgerOptions(dbPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+	found := make([]bool, len(keys))
+	if set {
+		err = bdb.Update(func(txn *badger.Txn) error {
+			for _, k := range keys {
+				if err := txn.Set(k, []byte("value")); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	} else {
+		err = bdb.View(func(txn *badger.Txn) error {
+			for i, k := range keys {
+				_, err := txn.Get(k)
+				if err != nil && err != badger.ErrKeyNotFound {
+					return err
+				}
+				found[i] = err == nil
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+// TestRepairOrphanedKeys checks that keys of buckets that no longer exist are
+// removed after backing up the database, and that keys that cannot be parsed
+// are reported and kept.
+func TestRepairOrphanedKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badgerdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "wallet.db")
+	db := writeRepairTestDB(t, dbPath, 10)
+	db.Close()
+
+	orphan, err := dbKey(childPrefix(rootPrefix, []byte("removed")), []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A depth of two without the names of the buckets.
+	unparsable := []byte{2}
+	keys := [][]byte{orphan, unparsable}
+	rawKeys(t, dbPath, keys, true)
+
+	backupPath := filepath.Join(dir, "backup")
+	report, err := Repair(dbPath, backupPath, nil)
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if report.OrphanedKeys != 1 || report.UnparsableKeys != 1 || report.Keys != 10 || report.Truncated {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.BackupPath != backupPath {
+		t.Fatalf("orphaned keys were removed without a backup: %+v", report)
+	}
+	if found := rawKeys(t, dbPath, keys, false); found[0] || !found[1] {
+		t.Errorf("repaired database holds orphaned key: %v, unparsable key: %v", found[0], found[1])
+	}
+	if found := rawKeys(t, backupPath, keys, false); !found[0] || !found[1] {
+		t.Errorf("backup holds orphaned key: %v, unparsable key: %v", found[0], found[1])
+	}
+
+	db, err = walletdb.Open(dbType, dbPath)
+	if err != nil {
+		t.Fatalf("opening the repaired database: %v", err)
+	}
+	checkRepairTestDB(t, db, 10)
+	db.Close()
+
+	// Nothing is removed or backed up again.
+	report, err = Repair(dbPath, filepath.Join(dir, "backup2"), nil)
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if report.OrphanedKeys != 0 || report.UnparsableKeys != 1 || report.BackupPath != "" {
+		t.Errorf("unexpected report of a repaired database %+v", report)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package badgerdb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet/walletdb"
+)
+
+// Stats describes the files of a badgerdb database.
+type Stats struct {
+	// LSMSize and ValueLogSize are the sizes in bytes of the LSM tree
+	// tables and of the value log files.
+	LSMSize      int64
+	ValueLogSize int64
+
+	// LastGC is when value log garbage collection last ran, or the zero
+	// time if it has not run since the database was opened.
+	LastGC time.Time
+}
+
+func badgerDB(walletDB walletdb.DB) (*db, error) {
+	db, ok := walletDB.(*db)
+	if !ok {
+		return nil, errors.E(errors.Invalid, "not a badgerdb database")
+	}
+	return db, nil
+}
+
+// DatabaseStats returns the sizes of the files of a database opened with the
+// badgerdb driver and when its value log was last collected.
+func DatabaseStats(walletDB walletdb.DB) (*Stats, error) {
+	db, err := badgerDB(walletDB)
+	if err != nil {
+		return nil, err
+	}
+
+	// badger only refreshes the sizes it reports once a minute, so the
+	// files are measured here instead.
+	stats := new(Stats)
+	err = filepath.Walk(db.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasSuffix(path, ".sst"):
+			stats.LSMSize += info.Size()
+		case strings.HasSuffix(path, ".vlog"):
+			stats.ValueLogSize += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+
+	stats.LastGC, _ = db.lastGC.Load().(time.Time)
+	return stats, nil
+}
+
+// CompactDatabase runs value log garbage collection on a database opened with
+// the badgerdb driver until no value log file has enough garbage to be
+// rewritten.  It waits for any collection that is already running.
+func CompactDatabase(walletDB walletdb.DB) error {
+	db, err := badgerDB(walletDB)
+	if err != nil {
+		return err
+	}
+	return db.collectGarbage()
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2018 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package badgerdb
+
+import (
+	"encoding/binary"
+	"os"
+
+	"github.com/decred/dcrwallet/errors"
+	"github.com/dgraph-io/badger"
+)
+
+const (
+	// keyEncodingVersion is the version of the key encoding described in
+	// bucket.go.  Databases written before the version was recorded use
+	// version 0, in which the keys of a bucket were appended to its prefix
+	// without delimiting and values began with the length of the prefix.
+	keyEncodingVersion = 1
+
+	// upgradeSuffix and legacySuffix name the directories used while a
+	// database is upgraded.  The upgraded database is written beside the
+	// original, and the original is kept with legacySuffix until the upgraded
+	// database has replaced it.
+	upgradeSuffix = ".upgrade"
+	legacySuffix  = ".v0"
+)
+
+// versionKey records the key encoding version.  Keys beginning with a zero byte
+// are reserved for the driver.
+var versionKey = []byte("\x00version")
+
+func writeVersion(bdb *badger.DB) error {
+	v := make([]byte, 4)
+	binary.LittleEndian.PutUint32(v, keyEncodingVersion)
+	return convertErr(bdb.Update(func(txn *badger.Txn) error {
+		return txn.Set(versionKey, v)
+	}))
+}
+
+// readVersion returns the key encoding version of the database.  The bool is
+// false if no version is recorded.
+func readVersion(bdb *badger.DB) (uint32, bool, error) {
+	var version uint32
+	var ok bool
+	err := bdb.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(versionKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		v, err := item.Value()
+		if err != nil {
+			return err
+		}
+		if len(v) != 4 {
+			return errors.E(errors.Encoding, "invalid key encoding version")
+		}
+		version, ok = binary.LittleEndian.Uint32(v), true
+		return nil
+	})
+	return version, ok, convertErr(err)
+}
+
+// checkVersion errors unless the database uses the current key encoding.  It is
+// used for databases that cannot be upgraded.
+func checkVersion(bdb *badger.DB) error {
+	version, ok, err := readVersion(bdb)
+	if err != nil {
+		return err
+	}
+	if !ok || version != keyEncodingVersion {
+		return errors.E(errors.Invalid, "database must be upgraded before it "+
+			"can be opened read-only")
+	}
+	return nil
+}
+
+func isEmpty(bdb *badger.DB) (bool, error) {
+	empty := true
+	err := bdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		it.Rewind()
+		empty = !it.Valid()
+		return nil
+	})
+	return empty, convertErr(err)
+}
+
+// recoverUpgrade restores the original database if an upgrade was interrupted
+// after the original was moved aside but before the upgraded database replaced
+// it.
+func recoverUpgrade(dbPath string) error {
+	legacyPath := dbPath + legacySuffix
+	if fileExists(dbPath) || !fileExists(legacyPath) {
+		return nil
+	}
+	if err := os.Rename(legacyPath, dbPath); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
+
+// upgradeDB checks the key encoding version of an opened database and upgrades
+// databases using an older encoding.  The returned database replaces bdb,
+// which is closed if it was upgraded or on error.
+func upgradeDB(bdb *badger.DB, dbPath string, opts *Options) (*badger.DB, error) {
+	version, ok, err := readVersion(bdb)
+	if err != nil {
+		bdb.Close()
+		return nil, err
+	}
+	if ok {
+		if version > keyEncodingVersion {
+			bdb.Close()
+			return nil, errors.E(errors.Invalid, errors.Errorf("unknown key "+
+				"encoding version %d", version))
+		}
+		return bdb, nil
+	}
+	empty, err := isEmpty(bdb)
+	if err != nil {
+		bdb.Close()
+		return nil, err
+	}
+	if empty {
+		if err := writeVersion(bdb); err != nil {
+			bdb.Close()
+			return nil, err
+		}
+		return bdb, nil
+	}
+
+	// Write the upgraded database beside the original, then swap them.
+	upgradePath := dbPath + upgradeSuffix
+	legacyPath := dbPath + legacySuffix
+	if err := os.RemoveAll(upgradePath); err != nil {
+		bdb.Close()
+		return nil, errors.E(errors.IO, err)
+	}
+	upgraded, err := badger.Open(opts.badgerOptions(upgradePath))
+	if err != nil {
+		bdb.Close()
+		return nil, convertErr(err)
+	}
+	err = upgradeKeyEncodingV0(bdb, upgraded)
+	if err == nil {
+		err = writeVersion(upgraded)
+	}
+	closeErr := upgraded.Close()
+	if err == nil {
+		err = convertErr(closeErr)
+	}
+	if closeErr := bdb.Close(); err == nil {
+		err = convertErr(closeErr)
+	}
+	if err != nil {
+		os.RemoveAll(upgradePath)
+		return nil, err
+	}
+
+	if err := os.Rename(dbPath, legacyPath); err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+	if err := os.Rename(upgradePath, dbPath); err != nil {
+		os.Rename(legacyPath, dbPath)
+		return nil, errors.E(errors.IO, err)
+	}
+	os.RemoveAll(legacyPath)
+
+	bdb, err = badger.Open(opts.badgerOptions(dbPath))
+	return bdb, convertErr(err)
+}
+
+// upgradeKeyEncodingV0 writes every key of a version 0 database to dst using
+// the current key encoding.  In version 0, the value of every key begins with
+// the length of the prefix of the bucket holding it, except for top-level
+// buckets, which record their own length.  Prefixes sort before the keys they
+// begin, so every bucket is seen before its contents.
+func upgradeKeyEncodingV0(src, dst *badger.DB) error {
+	w := newBatchWriter(dst)
+	defer w.discard()
+
+	// prefixes maps the version 0 prefix of every bucket to its new prefix.
+	prefixes := make(map[string][]byte)
+	err := src.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return convertErr(err)
+			}
+			if len(v) == 0 {
+				return errors.E(errors.Encoding, errors.Errorf("key %x has no prefix length", key))
+			}
+			isBucket := item.UserMeta() == metaBucket
+
+			var parent []byte
+			var name []byte
+			prefixLen := int(v[0])
+			switch {
+			case isBucket && prefixLen == len(key):
+				parent, name = rootPrefix, key
+			case prefixLen < len(key):
+				var ok bool
+				parent, ok = prefixes[string(key[:prefixLen])]
+				if !ok {
+					return errors.E(errors.Encoding, errors.Errorf("key %x has no bucket", key))
+				}
+				name = key[prefixLen:]
+			default:
+				return errors.E(errors.Encoding, errors.Errorf("key %x has an invalid prefix length", key))
+			}
+
+			newKey, err := dbKey(parent, name)
+			if err != nil {
+				return err
+			}
+			if isBucket {
+				prefixes[string(key)] = childPrefix(parent, name)
+				err = w.set(newKey, []byte{}, metaBucket)
+			} else {
+				err = w.set(newKey, v[1:], 0)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return w.commit()
+}
@@ -0,0 +1,23 @@
+// Package bdb_test holds the conformance tests of the bolt database driver of
+// dcrwallet, which the badgerdb driver is held to as well.
+package bdb_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/decred/dcrwallet/wallet/drivers/bdb"
+	"github.com/raedahgroup/mobilewallet/walletdbtest"
+)
+
+func TestInterface(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	walletdbtest.TestInterface(t, "bdb", filepath.Join(dir, "wallet.db"))
+}
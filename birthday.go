@@ -0,0 +1,248 @@
+package mobilewallet
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet"
+	"github.com/decred/dcrwallet/wallet/walletdb"
+)
+
+var (
+	// birthdayKey records the WalletBirthday given when the wallet was
+	// created.
+	birthdayKey = []byte("birthday")
+
+	// birthdayStartKey records the height that the first sync started
+	// scanning from because of the birthday, followed by a byte that is set
+	// once the birthday has been found to be safe.
+	birthdayStartKey = []byte("birthdaystart")
+)
+
+// WalletBirthday is the time or block height before which a restored wallet
+// is known to have no transactions.  Timestamp is in seconds since the unix
+// epoch.  If Height is set it is used instead of Timestamp.
+type WalletBirthday struct {
+	Timestamp int64
+	Height    int32
+}
+
+func serializeBirthday(b *WalletBirthday) []byte {
+	v := make([]byte, 12)
+	binary.LittleEndian.PutUint64(v[0:8], uint64(b.Timestamp))
+	binary.LittleEndian.PutUint32(v[8:12], uint32(b.Height))
+	return v
+}
+
+func deserializeBirthday(v []byte) (*WalletBirthday, error) {
+	if len(v) != 12 {
+		return nil, errors.E(errors.Encoding, "invalid birthday")
+	}
+	return &WalletBirthday{
+		Timestamp: int64(binary.LittleEndian.Uint64(v[0:8])),
+		Height:    int32(binary.LittleEndian.Uint32(v[8:12])),
+	}, nil
+}
+
+// Birthday returns the birthday recorded when the wallet was created, or nil
+// if the wallet has none.
+func (lw *LibWallet) Birthday() (*WalletBirthday, error) {
+	v, err := lw.readMetadata(birthdayKey)
+	if err != nil || v == nil {
+		return nil, translateError(err)
+	}
+	birthday, err := deserializeBirthday(v)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return birthday, nil
+}
+
+// birthdayMargin is the number of blocks scanned before a birthday to allow
+// for clock skew and imprecise birthdays.
+func (lw *LibWallet) birthdayMargin() int32 {
+	return int32(24 * time.Hour / lw.activeNet.TargetTimePerBlock)
+}
+
+// birthdayStartHeight returns the main chain height that scanning should start
+// from for the birthday, or -1 if the wallet has not synced far enough yet to
+// know it.
+func (lw *LibWallet) birthdayStartHeight(b *WalletBirthday) (int32, error) {
+	_, tipHeight := lw.wallet.MainChainTip()
+
+	var height int32
+	if b.Height > 0 {
+		if b.Height > tipHeight {
+			return -1, nil
+		}
+		height = b.Height
+	} else {
+		tipInfo, err := lw.wallet.BlockInfo(wallet.NewBlockIdentifierFromHeight(tipHeight))
+		if err != nil {
+			return 0, err
+		}
+		if tipInfo.Timestamp < b.Timestamp {
+			return -1, nil
+		}
+
+		// Find the first block mined at or after the birthday.
+		var searchErr error
+		height = int32(sort.Search(int(tipHeight)+1, func(i int) bool {
+			info, err := lw.wallet.BlockInfo(wallet.NewBlockIdentifierFromHeight(int32(i)))
+			if err != nil {
+				searchErr = err
+				return true
+			}
+			return info.Timestamp >= b.Timestamp
+		}))
+		if searchErr != nil {
+			return 0, searchErr
+		}
+	}
+
+	height -= lw.birthdayMargin()
+	if height < 0 {
+		height = 0
+	}
+	return height, nil
+}
+
+// applyBirthday marks every block before the wallet birthday as processed so
+// that address discovery and the initial rescan start at the birthday instead
+// of the genesis block.  It only has an effect the first time the headers
+// reach the birthday.  It must be called after headers are fetched and before
+// address discovery begins.
+func (lw *LibWallet) applyBirthday() {
+	b, err := lw.Birthday()
+	if err != nil {
+		log.Errorf("Failed to read wallet birthday: %v", err)
+		return
+	}
+	if b == nil {
+		return
+	}
+	applied, err := lw.readMetadata(birthdayStartKey)
+	if err != nil || applied != nil {
+		return
+	}
+
+	startHeight, err := lw.birthdayStartHeight(b)
+	if err != nil {
+		log.Errorf("Failed to find wallet birthday block: %v", err)
+		return
+	}
+	if startHeight < 0 {
+		return
+	}
+
+	if startHeight > 0 {
+		info, err := lw.wallet.BlockInfo(wallet.NewBlockIdentifierFromHeight(startHeight - 1))
+		if err != nil {
+			log.Errorf("Failed to find wallet birthday block: %v", err)
+			return
+		}
+		db, err := lw.walletDB()
+		if err != nil {
+			return
+		}
+		err = walletdb.Update(db, func(dbtx walletdb.ReadWriteTx) error {
+			return lw.wallet.TxStore.UpdateProcessedTxsBlockMarker(dbtx, &info.Hash)
+		})
+		if err != nil {
+			log.Errorf("Failed to skip blocks before wallet birthday: %v", err)
+			return
+		}
+		log.Infof("Skipping blocks before wallet birthday at height %d", startHeight)
+	}
+
+	v := make([]byte, 5)
+	binary.LittleEndian.PutUint32(v, uint32(startHeight))
+	err = lw.writeMetadata(birthdayStartKey, v)
+	if err != nil {
+		log.Errorf("Failed to record wallet birthday: %v", err)
+	}
+}
+
+// birthdayScanStart returns the height that full rescans should start from.
+func (lw *LibWallet) birthdayScanStart() int32 {
+	v, err := lw.readMetadata(birthdayStartKey)
+	if err != nil || len(v) != 5 {
+		return 0
+	}
+	return int32(binary.LittleEndian.Uint32(v))
+}
+
+// verifyBirthday checks that the birthday applied by applyBirthday was not too
+// recent.  Wallet transactions mined right after the scan start suggest that
+// older transactions exist, in which case the birthday is discarded and the
+// wallet is rediscovered and rescanned from the genesis block.
+func (lw *LibWallet) verifyBirthday() {
+	v, err := lw.readMetadata(birthdayStartKey)
+	if err != nil || len(v) != 5 || v[4] != 0 {
+		return
+	}
+	startHeight := int32(binary.LittleEndian.Uint32(v))
+	if startHeight == 0 {
+		return
+	}
+
+	var tooRecent bool
+	rangeFn := func(block *wallet.Block) (bool, error) {
+		tooRecent = len(block.Transactions) > 0
+		return tooRecent, nil
+	}
+	err = lw.wallet.GetTransactions(rangeFn,
+		wallet.NewBlockIdentifierFromHeight(startHeight),
+		wallet.NewBlockIdentifierFromHeight(startHeight+lw.birthdayMargin()))
+	if err != nil {
+		log.Errorf("Failed to verify wallet birthday: %v", err)
+		return
+	}
+
+	if !tooRecent {
+		v[4] = 1
+		err = lw.writeMetadata(birthdayStartKey, v)
+		if err != nil {
+			log.Errorf("Failed to record wallet birthday: %v", err)
+		}
+		return
+	}
+
+	log.Warnf("Wallet birthday is too recent, rescanning from the genesis block")
+	netBackend, err := lw.wallet.NetworkBackend()
+	if err != nil {
+		return
+	}
+	err = lw.writeMetadata(birthdayStartKey, make([]byte, 5))
+	if err != nil {
+		log.Errorf("Failed to discard wallet birthday: %v", err)
+		return
+	}
+
+	go func() {
+		ctx := contextWithShutdownCancel(context.Background())
+		for _, syncResponse := range lw.syncResponses {
+			syncResponse.OnDiscoveredAddresses(START)
+		}
+		err := lw.wallet.DiscoverActiveAddresses(ctx, netBackend, lw.activeNet.GenesisHash, false)
+		if err != nil {
+			log.Errorf("Failed to discover addresses before wallet birthday: %v", err)
+			return
+		}
+		for _, syncResponse := range lw.syncResponses {
+			syncResponse.OnDiscoveredAddresses(FINISH)
+		}
+		err = lw.wallet.LoadActiveDataFilters(ctx, netBackend, true)
+		if err != nil {
+			log.Errorf("Failed to load data filters: %v", err)
+			return
+		}
+		err = lw.RescanBlocks()
+		if err != nil {
+			log.Errorf("Failed to rescan before wallet birthday: %v", err)
+		}
+	}()
+}
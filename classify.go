@@ -0,0 +1,178 @@
+package mobilewallet
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/decred/dcrwallet/wallet"
+)
+
+// Transaction directions, reported in Transaction.Direction.
+const (
+	TxDirectionSent int32 = iota
+	TxDirectionReceived
+	TxDirectionTransferred
+)
+
+// txClassification describes how a transaction changed the wallet's balance.
+type txClassification struct {
+	direction int32
+	// amount is the amount sent, received or transferred, not including
+	// the fee.
+	amount int64
+	// fee is the transaction fee, which is only known when every input
+	// was spent by the wallet.
+	fee int64
+	// accountAmounts is the net change of the balance of each account the
+	// transaction spends from or pays to, sorted by account.
+	accountAmounts []AccountAmount
+	// counterparties are the addresses of the outputs paying outside the
+	// wallet.
+	counterparties []string
+}
+
+// classifyTransaction classifies a regular or stake transaction of the wallet.
+//
+// Transactions spending nothing of the wallet are received.  Transactions
+// spending from the wallet and paying nothing outside of it are transfers,
+// which includes the purchase of tickets the wallet votes with and
+// revocations.  Otherwise the net change of the balance decides: votes and
+// payments receiving more than they spend are received, and the rest are
+// sent.
+func classifyTransaction(summary *wallet.TransactionSummary, params *chaincfg.Params) (*txClassification, error) {
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(summary.Transaction)); err != nil {
+		return nil, err
+	}
+
+	c := &txClassification{
+		fee:            int64(summary.Fee),
+		counterparties: make([]string, 0),
+	}
+	accountAmounts := make(map[uint32]int64)
+	debitedAccounts := make(map[uint32]bool)
+	var debits, credits, nonChange int64
+	for _, debit := range summary.MyInputs {
+		debits += int64(debit.PreviousAmount)
+		accountAmounts[debit.PreviousAccount] -= int64(debit.PreviousAmount)
+		debitedAccounts[debit.PreviousAccount] = true
+	}
+	credited := make(map[uint32]bool)
+	for _, credit := range summary.MyOutputs {
+		credits += int64(credit.Amount)
+		accountAmounts[credit.Account] += int64(credit.Amount)
+		credited[credit.Index] = true
+		if !credit.Internal || !debitedAccounts[credit.Account] {
+			nonChange += int64(credit.Amount)
+		}
+	}
+
+	var foreign int64
+	seen := make(map[string]bool)
+	for i, out := range tx.TxOut {
+		if credited[uint32(i)] || out.Value == 0 {
+			continue
+		}
+		foreign += out.Value
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(out.Version, out.PkScript, params)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			encoded := addr.EncodeAddress()
+			if !seen[encoded] {
+				seen[encoded] = true
+				c.counterparties = append(c.counterparties, encoded)
+			}
+		}
+	}
+
+	net := credits - debits
+	switch {
+	case len(summary.MyInputs) == 0:
+		c.direction = TxDirectionReceived
+		c.amount = credits
+	case foreign == 0 && net <= 0:
+		c.direction = TxDirectionTransferred
+		switch {
+		case summary.Type == wallet.TransactionTypeTicketPurchase:
+			c.amount = tx.TxOut[0].Value
+		case nonChange != 0:
+			c.amount = nonChange
+		default:
+			c.amount = credits
+		}
+	case net > 0:
+		c.direction = TxDirectionReceived
+		c.amount = net
+	default:
+		c.direction = TxDirectionSent
+		c.amount = -net - c.fee
+	}
+
+	c.accountAmounts = make([]AccountAmount, 0, len(accountAmounts))
+	for account, amount := range accountAmounts {
+		c.accountAmounts = append(c.accountAmounts, AccountAmount{
+			Account: int32(account),
+			Amount:  amount,
+		})
+	}
+	sort.Slice(c.accountAmounts, func(i, j int) bool {
+		return c.accountAmounts[i].Account < c.accountAmounts[j].Account
+	})
+	return c, nil
+}
+
+// transactionFromSummary returns the Transaction of a summary of a wallet
+// transaction mined at height, or -1 if it is unmined.
+func (lw *LibWallet) transactionFromSummary(summary *wallet.TransactionSummary, height int32) (*Transaction, error) {
+	c, err := classifyTransaction(summary, lw.wallet.ChainParams())
+	if err != nil {
+		return nil, err
+	}
+
+	credits := make([]TransactionCredit, len(summary.MyOutputs))
+	for index, credit := range summary.MyOutputs {
+		var address string
+		if credit.Address != nil {
+			address = credit.Address.String()
+		}
+		credits[index] = TransactionCredit{
+			Index:    int32(credit.Index),
+			Account:  int32(credit.Account),
+			Internal: credit.Internal,
+			Amount:   int64(credit.Amount),
+			Address:  address}
+	}
+	debits := make([]TransactionDebit, len(summary.MyInputs))
+	for index, debit := range summary.MyInputs {
+		debits[index] = TransactionDebit{
+			Index:           int32(debit.Index),
+			PreviousAccount: int32(debit.PreviousAccount),
+			PreviousAmount:  int64(debit.PreviousAmount),
+			AccountName:     lw.accountName(int32(debit.PreviousAccount))}
+	}
+	for i := range c.accountAmounts {
+		c.accountAmounts[i].AccountName = lw.accountName(c.accountAmounts[i].Account)
+	}
+
+	transaction := &Transaction{
+		Fee:            c.fee,
+		Hash:           summary.Hash.String(),
+		Raw:            fmt.Sprintf("%02x", summary.Transaction[:]),
+		Timestamp:      summary.Timestamp,
+		Type:           transactionType(summary.Type),
+		Credits:        &credits,
+		Amount:         c.amount,
+		Height:         height,
+		Direction:      c.direction,
+		Debits:         &debits,
+		AccountAmounts: c.accountAmounts,
+		Counterparties: c.counterparties}
+	lw.applyTransfer(transaction)
+	return transaction, nil
+}
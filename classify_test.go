@@ -0,0 +1,210 @@
+package mobilewallet
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/dcrec"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/decred/dcrwallet/wallet"
+)
+
+var classifyTestParams = &chaincfg.TestNet3Params
+
+// classifyTestAddress returns the address paid by output script id of the
+// test transactions.
+func classifyTestAddress(id byte) string {
+	addr, err := dcrutil.NewAddressPubKeyHash(bytes.Repeat([]byte{id}, 20),
+		classifyTestParams, dcrec.STEcdsaSecp256k1)
+	if err != nil {
+		panic(err)
+	}
+	return addr.EncodeAddress()
+}
+
+// classifyTestTx returns a serialized transaction with inputs inputs and an
+// output for each value.  Output i pays to classifyTestAddress(i+1), and
+// outputs with a zero value carry data instead.
+func classifyTestTx(inputs int, values ...int64) []byte {
+	tx := wire.NewMsgTx()
+	for i := 0; i < inputs; i++ {
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: uint32(i)}, 0, nil))
+	}
+	for i, v := range values {
+		var script []byte
+		if v == 0 {
+			script, _ = txscript.GenerateProvablyPruneableOut([]byte{byte(i)})
+		} else {
+			addr, _ := dcrutil.DecodeAddress(classifyTestAddress(byte(i + 1)))
+			script, _ = txscript.PayToAddrScript(addr)
+		}
+		tx.AddTxOut(wire.NewTxOut(v, script))
+	}
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func debit(account uint32, amount int64) wallet.TransactionSummaryInput {
+	return wallet.TransactionSummaryInput{
+		PreviousAccount: account,
+		PreviousAmount:  dcrutil.Amount(amount),
+	}
+}
+
+func credit(index, account uint32, internal bool, amount int64) wallet.TransactionSummaryOutput {
+	return wallet.TransactionSummaryOutput{
+		Index:    index,
+		Account:  account,
+		Internal: internal,
+		Amount:   dcrutil.Amount(amount),
+	}
+}
+
+func TestClassifyTransaction(t *testing.T) {
+	tests := []struct {
+		name           string
+		summary        wallet.TransactionSummary
+		direction      int32
+		amount         int64
+		fee            int64
+		accountAmounts []AccountAmount
+		counterparties []string
+	}{{
+		name: "received",
+		summary: wallet.TransactionSummary{
+			Transaction: classifyTestTx(1, 100, 50),
+			MyOutputs:   []wallet.TransactionSummaryOutput{credit(1, 0, false, 50)},
+		},
+		direction:      TxDirectionReceived,
+		amount:         50,
+		accountAmounts: []AccountAmount{{Account: 0, Amount: 50}},
+		counterparties: []string{classifyTestAddress(1)},
+	}, {
+		name: "sent with change",
+		summary: wallet.TransactionSummary{
+			Transaction: classifyTestTx(1, 70, 29),
+			Fee:         1,
+			MyInputs:    []wallet.TransactionSummaryInput{debit(0, 100)},
+			MyOutputs:   []wallet.TransactionSummaryOutput{credit(1, 0, true, 29)},
+		},
+		direction:      TxDirectionSent,
+		amount:         70,
+		fee:            1,
+		accountAmounts: []AccountAmount{{Account: 0, Amount: -71}},
+		counterparties: []string{classifyTestAddress(1)},
+	}, {
+		// Another party funded most of the transaction, and the wallet
+		// receives more than it spent.
+		name: "mixed payment",
+		summary: wallet.TransactionSummary{
+			Transaction: classifyTestTx(2, 70, 129),
+			MyInputs:    []wallet.TransactionSummaryInput{debit(0, 100)},
+			MyOutputs:   []wallet.TransactionSummaryOutput{credit(1, 0, false, 129)},
+		},
+		direction:      TxDirectionReceived,
+		amount:         29,
+		accountAmounts: []AccountAmount{{Account: 0, Amount: 29}},
+		counterparties: []string{classifyTestAddress(1)},
+	}, {
+		name: "self-transfer between accounts",
+		summary: wallet.TransactionSummary{
+			Transaction: classifyTestTx(1, 70, 29),
+			Fee:         1,
+			MyInputs:    []wallet.TransactionSummaryInput{debit(0, 100)},
+			MyOutputs: []wallet.TransactionSummaryOutput{
+				credit(0, 1, true, 70),
+				credit(1, 0, true, 29),
+			},
+		},
+		direction:      TxDirectionTransferred,
+		amount:         70,
+		fee:            1,
+		accountAmounts: []AccountAmount{{Account: 0, Amount: -71}, {Account: 1, Amount: 70}},
+		counterparties: []string{},
+	}, {
+		name: "ticket purchase",
+		summary: wallet.TransactionSummary{
+			Type:        wallet.TransactionTypeTicketPurchase,
+			Transaction: classifyTestTx(1, 99, 0, 0),
+			Fee:         1,
+			MyInputs:    []wallet.TransactionSummaryInput{debit(0, 100)},
+			MyOutputs:   []wallet.TransactionSummaryOutput{credit(0, 0, true, 99)},
+		},
+		direction:      TxDirectionTransferred,
+		amount:         99,
+		fee:            1,
+		accountAmounts: []AccountAmount{{Account: 0, Amount: -1}},
+		counterparties: []string{},
+	}, {
+		// The stakebase input does not belong to the wallet, so the fee
+		// is unknown.
+		name: "vote",
+		summary: wallet.TransactionSummary{
+			Type:        wallet.TransactionTypeVote,
+			Transaction: classifyTestTx(2, 0, 0, 105),
+			MyInputs:    []wallet.TransactionSummaryInput{debit(0, 100)},
+			MyOutputs:   []wallet.TransactionSummaryOutput{credit(2, 0, false, 105)},
+		},
+		direction:      TxDirectionReceived,
+		amount:         5,
+		accountAmounts: []AccountAmount{{Account: 0, Amount: 5}},
+		counterparties: []string{},
+	}, {
+		name: "revocation",
+		summary: wallet.TransactionSummary{
+			Type:        wallet.TransactionTypeRevocation,
+			Transaction: classifyTestTx(1, 99),
+			Fee:         1,
+			MyInputs:    []wallet.TransactionSummaryInput{debit(0, 100)},
+			MyOutputs:   []wallet.TransactionSummaryOutput{credit(0, 0, false, 99)},
+		},
+		direction:      TxDirectionTransferred,
+		amount:         99,
+		fee:            1,
+		accountAmounts: []AccountAmount{{Account: 0, Amount: -1}},
+		counterparties: []string{},
+	}, {
+		// Only one of two inputs belongs to the wallet, so the fee is
+		// unknown and the amount sent includes the wallet's share of it.
+		name: "partial inputs, fee unknown",
+		summary: wallet.TransactionSummary{
+			Transaction: classifyTestTx(2, 90, 9),
+			MyInputs:    []wallet.TransactionSummaryInput{debit(0, 60)},
+			MyOutputs:   []wallet.TransactionSummaryOutput{credit(1, 0, true, 9)},
+		},
+		direction:      TxDirectionSent,
+		amount:         51,
+		accountAmounts: []AccountAmount{{Account: 0, Amount: -51}},
+		counterparties: []string{classifyTestAddress(1)},
+	}}
+
+	for _, test := range tests {
+		c, err := classifyTransaction(&test.summary, classifyTestParams)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if c.direction != test.direction {
+			t.Errorf("%s: direction %d, want %d", test.name, c.direction, test.direction)
+		}
+		if c.amount != test.amount {
+			t.Errorf("%s: amount %d, want %d", test.name, c.amount, test.amount)
+		}
+		if c.fee != test.fee {
+			t.Errorf("%s: fee %d, want %d", test.name, c.fee, test.fee)
+		}
+		if !reflect.DeepEqual(c.accountAmounts, test.accountAmounts) {
+			t.Errorf("%s: account amounts %v, want %v", test.name, c.accountAmounts, test.accountAmounts)
+		}
+		if !reflect.DeepEqual(c.counterparties, test.counterparties) {
+			t.Errorf("%s: counterparties %v, want %v", test.name, c.counterparties, test.counterparties)
+		}
+	}
+}
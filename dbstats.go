@@ -0,0 +1,188 @@
+package mobilewallet
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet/walletdb"
+	"github.com/raedahgroup/mobilewallet/badgerdb"
+)
+
+// lastCompactionKey records the unix time that CompactDatabase last finished.
+var lastCompactionKey = []byte("lastcompaction")
+
+// BucketStats counts the keys and nested buckets of a top-level bucket of the
+// wallet database.
+type BucketStats struct {
+	Name    string
+	Keys    int
+	Buckets int
+}
+
+// DatabaseStats describes the wallet database.  Sizes are in bytes and times
+// are in seconds since the unix epoch, or zero if unknown.  Encrypted, LSMSize,
+// ValueLogSize and LastGC are only reported by the badgerdb driver, whose value
+// log is collected in the background while the database is open.
+type DatabaseStats struct {
+	Driver         string
+	Encrypted      bool
+	DiskSize       int64
+	LSMSize        int64
+	ValueLogSize   int64
+	Buckets        []BucketStats
+	LastGC         int64
+	LastCompaction int64
+}
+
+// DatabaseStats returns the JSON encoded DatabaseStats of the loaded wallet's
+// database.
+func (lw *LibWallet) DatabaseStats() (string, error) {
+	db, err := lw.walletDB()
+	if err != nil {
+		return "", translateError(err)
+	}
+
+	stats := &DatabaseStats{Driver: lw.dbDriver}
+	stats.DiskSize, err = diskSize(filepath.Join(lw.loader.DbDirPath(), walletDbName))
+	if err != nil {
+		return "", translateError(err)
+	}
+	if lw.dbDriver == "badgerdb" {
+		badgerStats, err := badgerdb.DatabaseStats(db)
+		if err != nil {
+			return "", translateError(err)
+		}
+		stats.Encrypted, err = badgerdb.IsEncrypted(db)
+		if err != nil {
+			return "", translateError(err)
+		}
+		stats.LSMSize = badgerStats.LSMSize
+		stats.ValueLogSize = badgerStats.ValueLogSize
+		if !badgerStats.LastGC.IsZero() {
+			stats.LastGC = badgerStats.LastGC.Unix()
+		}
+	}
+
+	err = walletdb.View(db, func(tx walletdb.ReadTx) error {
+		for _, key := range walletTopLevelBuckets {
+			b := tx.ReadBucket(key)
+			if b == nil {
+				continue
+			}
+			bs := BucketStats{Name: string(key)}
+			if err := countBucket(&bs, b); err != nil {
+				return err
+			}
+			stats.Buckets = append(stats.Buckets, bs)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", translateError(err)
+	}
+
+	lastCompaction, err := getMetadata(db, lastCompactionKey)
+	if err != nil {
+		return "", translateError(err)
+	}
+	if len(lastCompaction) == 8 {
+		stats.LastCompaction = int64(binary.LittleEndian.Uint64(lastCompaction))
+	}
+
+	result, err := json.Marshal(stats)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+// CompactDatabase reclaims space left unused in the wallet database by deleted
+// and overwritten data.  badgerdb databases have their value log collected in
+// place.  bdb databases never shrink, so they are rewritten into a new file,
+// which closes any loaded wallet; it must be opened again with OpenWallet.
+//
+// Compaction is slow and is meant to run while the wallet is idle.  It fails
+// with ErrFailedPrecondition while the wallet is syncing or rescanning.
+func (lw *LibWallet) CompactDatabase() error {
+	if w, ok := lw.loader.LoadedWallet(); ok {
+		if _, err := w.NetworkBackend(); err == nil || lw.IsRescanning() || lw.loader.ReadOnly() {
+			return newWalletError(ErrFailedPrecondition)
+		}
+	}
+
+	dbPath := filepath.Join(lw.loader.DbDirPath(), walletDbName)
+	before, err := diskSize(dbPath)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if lw.dbDriver == "badgerdb" {
+		db, err := lw.walletDB()
+		if err != nil {
+			return translateError(err)
+		}
+		if err := badgerdb.CompactDatabase(db); err != nil {
+			return translateError(err)
+		}
+		if err := lw.writeMetadata(lastCompactionKey, serializeCompactionTime()); err != nil {
+			return translateError(err)
+		}
+	} else {
+		_, err := lw.rewriteDatabase(lw.dbDriver, nil, false, func(dst walletdb.DB) error {
+			return putMetadata(dst, lastCompactionKey, serializeCompactionTime())
+		})
+		if err != nil {
+			return translateError(err)
+		}
+	}
+
+	after, err := diskSize(dbPath)
+	if err != nil {
+		return translateError(err)
+	}
+	log.Infof("Compacted %s wallet database from %d to %d bytes", lw.dbDriver, before, after)
+	return nil
+}
+
+func serializeCompactionTime() []byte {
+	v := make([]byte, 8)
+	binary.LittleEndian.PutUint64(v, uint64(time.Now().Unix()))
+	return v
+}
+
+// countBucket adds the keys and nested buckets of b to bs.
+func countBucket(bs *BucketStats, b walletdb.ReadBucket) error {
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			if nested := b.NestedReadBucket(k); nested != nil {
+				bs.Buckets++
+				return countBucket(bs, nested)
+			}
+		}
+		bs.Keys++
+		return nil
+	})
+}
+
+// diskSize returns the total size of the file or directory at path.
+func diskSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.E(errors.IO, err)
+	}
+	return size, nil
+}
@@ -0,0 +1,33 @@
+package mobilewallet
+
+import (
+	"github.com/decred/dcrwallet/wallet"
+)
+
+// EncryptDatabase copies the values of the badgerdb wallet database into a new
+// database that encrypts them under a new random key protected by pubPass,
+// which then replaces the original.  A plaintext database becomes encrypted,
+// and an encrypted database, which pubPass must open, has its values
+// re-encrypted.  An empty pubPass selects the default public passphrase.
+// ChangePublicPassphrase only protects the existing key with the
+// new passphrase, so this should follow it if the old passphrase may have
+// exposed the key.  Any loaded wallet is closed first and must be opened again
+// with OpenWallet.
+func (lw *LibWallet) EncryptDatabase(pubPass []byte) error {
+	if lw.dbDriver != "badgerdb" {
+		return newWalletError(ErrFailedPrecondition)
+	}
+	if len(pubPass) == 0 {
+		pubPass = []byte(wallet.InsecurePubPassphrase)
+	}
+	if lw.loader.ReadOnly() {
+		return newWalletError(ErrFailedPrecondition)
+	}
+
+	summary, err := lw.rewriteDatabase(lw.dbDriver, pubPass, true, nil)
+	if err != nil {
+		return translateError(err)
+	}
+	log.Infof("Encrypted %d keys of the wallet database under a new key", summary.keys)
+	return nil
+}
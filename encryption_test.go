@@ -0,0 +1,112 @@
+package mobilewallet
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/decred/dcrwallet/wallet"
+	"github.com/dgraph-io/badger"
+	"github.com/raedahgroup/mobilewallet/badgerdb"
+)
+
+// badgerEncryptionKey is the key of the wrapped database keys of an encrypted
+// badgerdb database.
+var badgerEncryptionKey = []byte("\x00encryption")
+
+// rawBadgerValue reads or, if value is not nil, writes the raw value of key in
+// the closed badgerdb database at dbPath.
+func rawBadgerValue(t *testing.T, dbPath string, key, value []byte) []byte {
+	opts := badger.DefaultOptions
+	opts.Dir = dbPath
+	opts.ValueDir = dbPath
+	bdb, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+	if value != nil {
+		err = bdb.Update(func(txn *badger.Txn) error {
+			return txn.Set(key, value)
+		})
+	} else {
+		err = bdb.View(func(txn *badger.Txn) error {
+			item, err := txn.Get(key)
+			if err != nil {
+				return err
+			}
+			value, err = item.ValueCopy(nil)
+			return err
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestEncryptDatabase(t *testing.T) {
+	lw, dir := newTestWallet(t, "badgerdb")
+	defer os.RemoveAll(dir)
+
+	key, value := []byte("encrypttest"), []byte("kept")
+	if err := lw.writeMetadata(key, value); err != nil {
+		t.Fatal(err)
+	}
+	address, err := lw.CurrentAddress(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(lw.loader.DbDirPath(), walletDbName)
+	pubPass := []byte(wallet.InsecurePubPassphrase)
+
+	// checkWallet reopens the wallet and checks that it is encrypted and
+	// kept its contents.
+	checkWallet := func(step string) {
+		if err := lw.OpenWallet(pubPass); err != nil {
+			t.Fatalf("%s: opening wallet: %v", step, err)
+		}
+		defer lw.CloseWallet()
+		db, _ := lw.loader.WalletDB()
+		if encrypted, err := badgerdb.IsEncrypted(db); err != nil || !encrypted {
+			t.Errorf("%s: database is not encrypted (%v)", step, err)
+		}
+		if v, err := lw.readMetadata(key); err != nil || !bytes.Equal(v, value) {
+			t.Errorf("%s: metadata is %q (%v), want %q", step, v, err, value)
+		}
+		if got, err := lw.CurrentAddress(0); err != nil || got != address {
+			t.Errorf("%s: current address is %s (%v), want %s", step, got, err, address)
+		}
+	}
+
+	if err := lw.EncryptDatabase(nil); err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+	checkWallet("encrypted")
+	oldKeys := rawBadgerValue(t, dbPath, badgerEncryptionKey, nil)
+
+	if err := lw.EncryptDatabase(nil); err != nil {
+		t.Fatalf("re-encrypting: %v", err)
+	}
+	checkWallet("re-encrypted")
+	checkNoReplacementFiles(t, lw, "")
+
+	// Values are encrypted under a new database key, which the old wrapped
+	// key does not open.
+	newKeys := rawBadgerValue(t, dbPath, badgerEncryptionKey, nil)
+	rawBadgerValue(t, dbPath, badgerEncryptionKey, oldKeys)
+	if err := lw.OpenWallet(pubPass); err == nil {
+		lw.CloseWallet()
+		t.Errorf("re-encrypted wallet opened with the old database key")
+	}
+	rawBadgerValue(t, dbPath, badgerEncryptionKey, newKeys)
+	checkWallet("restored key")
+
+	bdbWallet, bdbDir := newTestWallet(t, "bdb")
+	defer os.RemoveAll(bdbDir)
+	defer bdbWallet.CloseWallet()
+	if err := bdbWallet.EncryptDatabase(nil); err == nil {
+		t.Errorf("bdb database was encrypted")
+	}
+}
@@ -2,6 +2,8 @@ module github.com/raedahgroup/mobilewallet
 
 require (
 	github.com/AndreasBriese/bbloom v0.0.0-20180913140656-343706a395b7 // indirect
+	github.com/boltdb/bolt v1.3.1
+	github.com/btcsuite/go-socks v0.0.0-20170105172521-4720035b7bfd
 	github.com/decred/dcrd/addrmgr v1.0.2
 	github.com/decred/dcrd/blockchain/stake v1.1.0
 	github.com/decred/dcrd/chaincfg v1.2.0
@@ -10,6 +12,7 @@ require (
 	github.com/decred/dcrd/dcrec v0.0.0-20181212181811-1a370d38d671
 	github.com/decred/dcrd/dcrjson v1.1.0
 	github.com/decred/dcrd/dcrutil v1.2.0
+	github.com/decred/dcrd/gcs v1.0.2
 	github.com/decred/dcrd/hdkeychain v1.1.1
 	github.com/decred/dcrd/rpcclient v1.1.0
 	github.com/decred/dcrd/txscript v1.0.2
@@ -30,4 +33,5 @@ require (
 	github.com/pkg/errors v0.8.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.2.2 // indirect
+	golang.org/x/crypto v0.0.0-20181203042331-505ab145d0a9
 )
@@ -0,0 +1,75 @@
+package mobilewallet
+
+import (
+	"strconv"
+
+	"github.com/decred/dcrwallet/wallet/udb"
+)
+
+// hiddenAccountPrefix begins the metadata keys marking hidden accounts, which
+// are followed by the decimal account number.
+const hiddenAccountPrefix = "hiddenaccount:"
+
+func hiddenAccountKey(account uint32) []byte {
+	return []byte(hiddenAccountPrefix + strconv.FormatUint(uint64(account), 10))
+}
+
+// HideAccount hides an account from GetAccounts, for example to archive an
+// account that is no longer used.  Accounts cannot be deleted, so a hidden
+// account is still synced, and its balance and addresses remain available.
+// The default account cannot be hidden.
+func (lw *LibWallet) HideAccount(account int32) error {
+	return translateError(lw.setAccountHidden(account, true))
+}
+
+// UnhideAccount shows an account hidden by HideAccount in GetAccounts again.
+func (lw *LibWallet) UnhideAccount(account int32) error {
+	return translateError(lw.setAccountHidden(account, false))
+}
+
+// IsAccountHidden returns whether an account was hidden by HideAccount.
+func (lw *LibWallet) IsAccountHidden(account int32) (bool, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return false, newWalletError(ErrWalletNotLoaded)
+	}
+	hidden, err := lw.accountHidden(uint32(account))
+	if err != nil {
+		return false, translateError(err)
+	}
+	return hidden, nil
+}
+
+func (lw *LibWallet) setAccountHidden(account int32, hidden bool) error {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return newWalletError(ErrWalletNotLoaded)
+	}
+	if account < 0 || uint32(account) == udb.DefaultAccountNum {
+		return newWalletError(ErrInvalid)
+	}
+	if _, err := lw.wallet.AccountName(uint32(account)); err != nil {
+		log.Error(err)
+		return translateError(err)
+	}
+
+	key := hiddenAccountKey(uint32(account))
+	var err error
+	if hidden {
+		err = lw.writeMetadata(key, []byte{1})
+	} else {
+		err = lw.deleteMetadata(key)
+	}
+	if err != nil {
+		log.Error(err)
+		return translateError(err)
+	}
+	return nil
+}
+
+// accountHidden returns whether an account is marked hidden.
+func (lw *LibWallet) accountHidden(account uint32) (bool, error) {
+	v, err := lw.readMetadata(hiddenAccountKey(account))
+	if err != nil {
+		return false, err
+	}
+	return len(v) != 0, nil
+}
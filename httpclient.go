@@ -14,9 +14,14 @@ import (
 )
 
 // newHTTPClient returns a new HTTP client that is configured according to the
-//  TLS settings in the associated connection configuration.
-func newHTTPClient(cert string) (*http.Client, error) {
+// proxy and TLS settings in the associated connection configuration.
+func newHTTPClient(cert string, proxy *proxyConfig) (*http.Client, error) {
+	// Set dial function if there is a proxy configured.
 	var dial func(network, addr string) (net.Conn, error)
+	if proxy != nil {
+		dial = proxy.dialer().Dial
+	}
+
 	// Configure TLS
 	var tlsConfig *tls.Config
 	pool := x509.NewCertPool()
@@ -43,7 +48,7 @@ func newHTTPClient(cert string) (*http.Client, error) {
 // to the server described in the passed config struct.  It also attempts to
 // unmarshal the response as a JSON-RPC response and returns either the result
 // field or the error field depending on whether or not there is an error.
-func sendPostRequest(marshalledJSON []byte, rpcServer string, username string, password string, cert string) ([]byte, error) {
+func sendPostRequest(marshalledJSON []byte, rpcServer string, username string, password string, cert string, proxy *proxyConfig) ([]byte, error) {
 	// Generate a request to the configured RPC server.
 	protocol := "https"
 	url := protocol + "://" + rpcServer
@@ -60,7 +65,7 @@ func sendPostRequest(marshalledJSON []byte, rpcServer string, username string, p
 
 	// Create the new HTTP client that is configured according to the user-
 	// specified options and submit the request.
-	httpClient, err := newHTTPClient(cert)
+	httpClient, err := newHTTPClient(cert, proxy)
 	if err != nil {
 		return nil, err
 	}
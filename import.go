@@ -0,0 +1,209 @@
+package mobilewallet
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"github.com/decred/dcrd/dcrutil"
+)
+
+// pendingImportRescanKey records the height that blocks must be rescanned from
+// for keys and scripts imported since the last completed import rescan.
+var pendingImportRescanKey = []byte("pendingimportrescan")
+
+// ImportResult is the result of ImportPrivateKey and ImportScript.  The key or
+// script has been imported even if its rescan did not start.  RescanHeight is
+// the height that blocks are rescanned from.  RescanPending is set when the
+// rescan could not be started now, in which case it starts the next time the
+// wallet is synced, and RescanError holds the code of the error that prevented
+// it from starting, or is empty if the wallet was not syncing.
+type ImportResult struct {
+	Address       string
+	RescanHeight  int32
+	RescanPending bool
+	RescanError   string
+}
+
+// ImportPrivateKey imports a WIF encoded private key into the imported account.
+// The blocks from height rescanFrom are rescanned for transactions of the key,
+// with progress reported through the registered sync responses, as described
+// by the returned ImportResult.  rescanFrom should be the height of the key's
+// first transaction, or 0 if it is unknown.
+func (lw *LibWallet) ImportPrivateKey(privPass []byte, wif string, rescanFrom int32) (*ImportResult, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
+	key, err := dcrutil.DecodeWIF(wif)
+	if err != nil || !key.IsForNet(lw.wallet.ChainParams()) {
+		return nil, newWalletError(ErrInvalid)
+	}
+	if _, tipHeight := lw.wallet.MainChainTip(); rescanFrom < 0 || rescanFrom > tipHeight {
+		return nil, newWalletError(ErrInvalid)
+	}
+
+	var address string
+	err = lw.withUnlockedWallet(privPass, func() error {
+		var err error
+		address, err = lw.wallet.ImportPrivateKey(key)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, translateError(err)
+	}
+
+	return lw.rescanImported(address, rescanFrom), nil
+}
+
+// ImportScript imports a hex encoded redeem script, such as a multisig script
+// shared by co-signers, into the imported account.  Blocks from the wallet
+// birthday are rescanned for transactions of the script's P2SH address as
+// described for ImportPrivateKey.
+func (lw *LibWallet) ImportScript(privPass []byte, scriptHex string) (*ImportResult, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
+	script, err := hex.DecodeString(scriptHex)
+	if err != nil || len(script) == 0 {
+		return nil, newWalletError(ErrInvalid)
+	}
+	addr, err := dcrutil.NewAddressScriptHash(script, lw.wallet.ChainParams())
+	if err != nil {
+		return nil, newWalletError(ErrInvalid)
+	}
+
+	err = lw.withUnlockedWallet(privPass, func() error {
+		return lw.wallet.ImportScript(script)
+	})
+	if err != nil {
+		log.Error(err)
+		return nil, translateError(err)
+	}
+
+	return lw.rescanImported(addr.EncodeAddress(), lw.birthdayScanStart()), nil
+}
+
+// withUnlockedWallet calls fn with the wallet unlocked by privPass.  A wallet
+// that was locked is locked again afterwards, while a wallet that was already
+// unlocked is left unlocked until its own lock timeout.  privPass is cleared.
+func (lw *LibWallet) withUnlockedWallet(privPass []byte, fn func() error) error {
+	defer func() {
+		for i := range privPass {
+			privPass[i] = 0
+		}
+	}()
+
+	// Read-only wallets are not started and never serve unlock requests.
+	if lw.loader.ReadOnly() {
+		return newWalletError(ErrFailedPrecondition)
+	}
+
+	// Unlocking again would replace the lock timeout of the unlocked wallet.
+	if !lw.wallet.Locked() {
+		return fn()
+	}
+
+	lock := make(chan time.Time, 1)
+	err := lw.wallet.Unlock(privPass, lock)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		lock <- time.Time{}
+	}()
+	return fn()
+}
+
+// rescanImported records that blocks must be rescanned from startHeight for
+// transactions of the newly imported address and starts the rescan if the
+// wallet is syncing.
+func (lw *LibWallet) rescanImported(address string, startHeight int32) *ImportResult {
+	result := &ImportResult{
+		Address:       address,
+		RescanHeight:  startHeight,
+		RescanPending: true,
+	}
+
+	height, err := lw.addPendingImportRescan(startHeight)
+	if err != nil {
+		// The rescan is still started below, but is not retried.
+		log.Errorf("Failed to record rescan of imported address: %v", err)
+		result.RescanError = translateError(err).Error()
+	} else {
+		result.RescanHeight = height
+	}
+
+	if _, err := lw.wallet.NetworkBackend(); err != nil {
+		log.Infof("Imported address will be rescanned from block %d once synced", result.RescanHeight)
+		return result
+	}
+	if err := lw.rescanWithSyncResponses(result.RescanHeight, lw.finishPendingImportRescan(result.RescanHeight)); err != nil {
+		log.Errorf("Failed to rescan imported address: %v", err)
+		result.RescanError = translateError(err).Error()
+		return result
+	}
+	result.RescanPending = false
+	result.RescanError = ""
+	return result
+}
+
+// addPendingImportRescan records that blocks must be rescanned from
+// startHeight, unless a rescan from a lower height is already recorded, and
+// returns the recorded height.
+func (lw *LibWallet) addPendingImportRescan(startHeight int32) (int32, error) {
+	if height, ok, err := lw.pendingImportRescan(); err != nil {
+		return 0, err
+	} else if ok && height <= startHeight {
+		return height, nil
+	}
+	v := make([]byte, 4)
+	binary.LittleEndian.PutUint32(v, uint32(startHeight))
+	if err := lw.writeMetadata(pendingImportRescanKey, v); err != nil {
+		return 0, err
+	}
+	return startHeight, nil
+}
+
+// pendingImportRescan returns the height recorded by addPendingImportRescan.
+// The bool is false if no rescan is pending.
+func (lw *LibWallet) pendingImportRescan() (int32, bool, error) {
+	v, err := lw.readMetadata(pendingImportRescanKey)
+	if err != nil || len(v) != 4 {
+		return 0, false, err
+	}
+	return int32(binary.LittleEndian.Uint32(v)), true, nil
+}
+
+// finishPendingImportRescan returns the function that forgets the pending
+// rescan from startHeight once it has finished.  A rescan recorded from a
+// lower height while it was running is kept.
+func (lw *LibWallet) finishPendingImportRescan(startHeight int32) func() {
+	return func() {
+		height, ok, err := lw.pendingImportRescan()
+		if err == nil && ok && height == startHeight {
+			err = lw.deleteMetadata(pendingImportRescanKey)
+		}
+		if err != nil {
+			log.Errorf("Failed to record rescan of imported addresses: %v", err)
+		}
+	}
+}
+
+// rescanPendingImports starts the rescan recorded for addresses imported while
+// the wallet was not syncing or whose rescan did not finish.  It is called
+// when the wallet is synced.
+func (lw *LibWallet) rescanPendingImports() {
+	height, ok, err := lw.pendingImportRescan()
+	if err != nil {
+		log.Errorf("Failed to read pending rescan of imported addresses: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	log.Infof("Rescanning from block %d for imported addresses", height)
+	if err := lw.rescanWithSyncResponses(height, lw.finishPendingImportRescan(height)); err != nil {
+		log.Errorf("Failed to rescan imported addresses: %v", err)
+	}
+}
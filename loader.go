@@ -5,6 +5,9 @@
 package mobilewallet
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
@@ -16,7 +19,9 @@ import (
 	"github.com/decred/dcrwallet/ticketbuyer"
 	"github.com/decred/dcrwallet/wallet"
 	_ "github.com/decred/dcrwallet/wallet/drivers/bdb" // driver loaded during init
-	_ "github.com/raedahgroup/mobilewallet/badgerdb"   // initialize badger driver
+	"github.com/decred/dcrwallet/wallet/walletdb"
+	"github.com/raedahgroup/mobilewallet/badgerdb"
+	_ "github.com/raedahgroup/mobilewallet/readonlybdb" // driver loaded during init
 )
 
 const (
@@ -38,7 +43,12 @@ type Loader struct {
 	dbDirPath   string
 	wallet      *wallet.Wallet
 	db          wallet.DB
+	driverDB    walletdb.DB
 	dbDriver    string
+	badgerOpts  *badgerdb.Options
+	encryptDB   bool
+	pubPass     []byte
+	readOnly    bool
 
 	purchaseManager *ticketbuyer.PurchaseManager
 	ntfnClient      wallet.MainTipChangedNotificationsClient
@@ -84,15 +94,71 @@ func (l *Loader) SetDatabaseDriver(driver string) {
 	l.dbDriver = driver
 }
 
+// SetBadgerOptions sets the options used to create and open badgerdb
+// databases.  nil selects badgerdb.DefaultOptions.
+func (l *Loader) SetBadgerOptions(opts *badgerdb.Options) {
+	l.mu.Lock()
+	l.badgerOpts = opts
+	l.mu.Unlock()
+}
+
+// SetDatabaseEncryption sets whether badgerdb databases created by the loader
+// encrypt their values with a key protected by the public passphrase.
+// Encrypted databases are opened whether or not this is set.
+func (l *Loader) SetDatabaseEncryption(encrypt bool) {
+	l.mu.Lock()
+	l.encryptDB = encrypt
+	l.mu.Unlock()
+}
+
+// dbArgs returns the walletdb arguments for the database at dbPath using the
+// given driver.  pubPass encrypts created badgerdb databases and opens
+// encrypted ones.  A nil pubPass selects the public passphrase of the loaded
+// wallet.
+func (l *Loader) dbArgs(driver, dbPath string, pubPass []byte) []interface{} {
+	if driver != "badgerdb" {
+		return []interface{}{dbPath}
+	}
+	opts := new(badgerdb.Options)
+	if l.badgerOpts != nil {
+		*opts = *l.badgerOpts
+	}
+	if pubPass == nil {
+		pubPass = l.pubPass
+	}
+	opts.Encrypt = l.encryptDB
+	opts.Passphrase = pubPass
+	return []interface{}{dbPath, opts}
+}
+
+// readOnlyDbArgs returns the driver and walletdb arguments that open the
+// database at dbPath without write access.
+func (l *Loader) readOnlyDbArgs(dbPath string, pubPass []byte) (string, []interface{}, error) {
+	switch l.dbDriver {
+	case "badgerdb":
+		args := l.dbArgs(l.dbDriver, dbPath, pubPass)
+		args[1].(*badgerdb.Options).ReadOnly = true
+		return l.dbDriver, args, nil
+	case "bdb":
+		return "readonlybdb", []interface{}{dbPath}, nil
+	default:
+		return "", nil, errors.E(errors.Invalid, errors.Errorf("database driver %q "+
+			"cannot be opened read-only", l.dbDriver))
+	}
+}
+
 // onLoaded executes each added callback and prevents loader from loading any
-// additional wallets.  Requires mutex to be locked.
-func (l *Loader) onLoaded(w *wallet.Wallet, db wallet.DB) {
+// additional wallets.  The public passphrase is kept until the wallet is
+// unloaded.  Requires mutex to be locked.
+func (l *Loader) onLoaded(w *wallet.Wallet, db wallet.DB, driverDB walletdb.DB, pubPass []byte) {
 	for _, fn := range l.callbacks {
 		fn(w)
 	}
 
 	l.wallet = w
 	l.db = db
+	l.driverDB = driverDB
+	l.pubPass = append([]byte{}, pubPass...)
 	l.callbacks = nil // not needed anymore
 }
 
@@ -162,7 +228,7 @@ func (l *Loader) CreateWatchingOnlyWallet(extendedPubKey string, pubPass []byte)
 	if err != nil {
 		return nil, errors.E(op, err)
 	}
-	db, err := wallet.CreateDB(l.dbDriver, dbPath)
+	db, driverDB, err := openDB(true, l.dbDriver, l.dbArgs(l.dbDriver, dbPath, pubPass)...)
 	if err != nil {
 		return nil, errors.E(op, err)
 	}
@@ -197,7 +263,7 @@ func (l *Loader) CreateWatchingOnlyWallet(extendedPubKey string, pubPass []byte)
 	}
 	w.Start()
 
-	l.onLoaded(w, db)
+	l.onLoaded(w, db, driverDB, pubPass)
 	return w, nil
 }
 
@@ -253,7 +319,7 @@ func (l *Loader) CreateNewWallet(pubPassphrase, privPassphrase, seed []byte) (w
 	if err != nil {
 		return nil, errors.E(op, err)
 	}
-	db, err := wallet.CreateDB(l.dbDriver, dbPath)
+	db, driverDB, err := openDB(true, l.dbDriver, l.dbArgs(l.dbDriver, dbPath, pubPassphrase)...)
 	if err != nil {
 		return nil, errors.E(op, err)
 	}
@@ -288,7 +354,7 @@ func (l *Loader) CreateNewWallet(pubPassphrase, privPassphrase, seed []byte) (w
 	}
 	w.Start()
 
-	l.onLoaded(w, db)
+	l.onLoaded(w, db, driverDB, pubPassphrase)
 	return w, nil
 }
 
@@ -309,7 +375,7 @@ func (l *Loader) OpenExistingWallet(pubPassphrase []byte) (w *wallet.Wallet, rer
 	// Open the database using the boltdb backend.
 	dbPath := filepath.Join(l.dbDirPath, walletDbName)
 	l.mu.Unlock()
-	db, err := wallet.OpenDB(l.dbDriver, dbPath)
+	db, driverDB, err := openDB(false, l.dbDriver, l.dbArgs(l.dbDriver, dbPath, pubPassphrase)...)
 	l.mu.Lock()
 
 	if err != nil {
@@ -349,15 +415,248 @@ func (l *Loader) OpenExistingWallet(pubPassphrase []byte) (w *wallet.Wallet, rer
 	}
 
 	w.Start()
-	l.onLoaded(w, db)
+	l.onLoaded(w, db, driverDB, pubPassphrase)
 	return w, nil
 }
 
+// OpenReadOnlyWallet opens the wallet database at dbPath, or the loader's wallet
+// database if dbPath is empty, without write access.  Every write transaction
+// fails, and the wallet is not started, so it does not sync, buy tickets or
+// otherwise write to the database.  The database must not be in use by a
+// process writing to it, but a snapshot written by WriteSnapshot may be opened
+// while the wallet it was taken from is in use.
+func (l *Loader) OpenReadOnlyWallet(dbPath string, pubPassphrase []byte) (w *wallet.Wallet, rerr error) {
+	const op errors.Op = "loader.OpenReadOnlyWallet"
+
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	if l.wallet != nil {
+		return nil, errors.E(op, errors.Exist, "wallet already opened")
+	}
+
+	if dbPath == "" {
+		dbPath = filepath.Join(l.dbDirPath, walletDbName)
+	}
+	driver, args, err := l.readOnlyDbArgs(dbPath, pubPassphrase)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	db, driverDB, err := openDB(false, driver, args...)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer func() {
+		if rerr != nil {
+			db.Close()
+		}
+	}()
+
+	so := l.stakeOptions
+	cfg := &wallet.Config{
+		DB:                  db,
+		PubPassphrase:       pubPassphrase,
+		VotingEnabled:       so.VotingEnabled,
+		AddressReuse:        so.AddressReuse,
+		VotingAddress:       so.VotingAddress,
+		PoolAddress:         so.PoolAddress,
+		PoolFees:            so.PoolFees,
+		TicketFee:           so.TicketFee,
+		GapLimit:            l.gapLimit,
+		AccountGapLimit:     l.accountGapLimit,
+		StakePoolColdExtKey: so.StakePoolColdExtKey,
+		AllowHighFees:       l.allowHighFees,
+		RelayFee:            l.relayFee,
+		Params:              l.chainParams,
+	}
+	w, err = wallet.Open(cfg)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	l.readOnly = true
+	l.onLoaded(w, db, driverDB, pubPassphrase)
+	return w, nil
+}
+
+// ReadOnly returns whether the loaded wallet was opened with
+// OpenReadOnlyWallet.
+func (l *Loader) ReadOnly() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.wallet != nil && l.readOnly
+}
+
+// WriteSnapshot writes a consistent copy of the loaded wallet's database to a
+// new database at dbPath, which can be opened with OpenReadOnlyWallet while the
+// wallet remains in use.
+func (l *Loader) WriteSnapshot(dbPath string) (err error) {
+	const op errors.Op = "loader.WriteSnapshot"
+
+	walletDB, ok := l.WalletDB()
+	if !ok {
+		return errors.E(op, errors.Invalid, "wallet is unopened")
+	}
+	exists, err := fileExists(dbPath)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if exists {
+		return errors.E(op, errors.Exist, "snapshot already exists")
+	}
+
+	if l.dbDriver == "badgerdb" {
+		// Stream the copy into a new database.
+		r, w := io.Pipe()
+		copied := make(chan error, 1)
+		go func() {
+			err := walletDB.Copy(w)
+			w.CloseWithError(err)
+			copied <- err
+		}()
+		err = badgerdb.Restore(dbPath, r)
+		r.CloseWithError(io.ErrClosedPipe)
+		if copyErr := <-copied; err == nil {
+			err = copyErr
+		}
+		if err != nil {
+			return errors.E(op, err)
+		}
+		return nil
+	}
+
+	f, err := os.OpenFile(dbPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	defer func() {
+		closeErr := f.Close()
+		if err == nil && closeErr != nil {
+			err = errors.E(op, closeErr)
+		}
+		if err != nil {
+			os.Remove(dbPath)
+		}
+	}()
+	if err := walletDB.Copy(f); err != nil {
+		return errors.E(op, err)
+	}
+	if err := f.Sync(); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
 // DbDirPath returns the Loader's database directory path
 func (l *Loader) DbDirPath() string {
 	return l.dbDirPath
 }
 
+// WalletDB returns the database of the loaded wallet, if any, and a bool for
+// whether the wallet has been loaded or not.  The database is the driver's own
+// value, so drivers can recognize it.
+func (l *Loader) WalletDB() (walletdb.DB, bool) {
+	l.mu.Lock()
+	db := l.driverDB
+	l.mu.Unlock()
+	return db, db != nil
+}
+
+// recordingDbType is a walletdb driver that opens or creates a database with
+// the driver named by its first argument and the remaining arguments after
+// the second, and passes the database to the func(walletdb.DB) given as the
+// second argument.  The wallet.DB returned by wallet.OpenDB and wallet.CreateDB
+// hides the driver's database, which openDB uses this driver to keep.
+const recordingDbType = "mobilewallet-recording"
+
+func init() {
+	recording := func(open func(string, ...interface{}) (walletdb.DB, error)) func(...interface{}) (walletdb.DB, error) {
+		return func(args ...interface{}) (walletdb.DB, error) {
+			if len(args) < 2 {
+				return nil, errors.E(errors.Invalid, "missing recording driver arguments")
+			}
+			driver, ok := args[0].(string)
+			record, ok2 := args[1].(func(walletdb.DB))
+			if !ok || !ok2 {
+				return nil, errors.E(errors.Invalid, "invalid recording driver arguments")
+			}
+			db, err := open(driver, args[2:]...)
+			if err != nil {
+				return nil, err
+			}
+			record(db)
+			return db, nil
+		}
+	}
+	err := walletdb.RegisterDriver(walletdb.Driver{
+		DbType: recordingDbType,
+		Create: recording(walletdb.Create),
+		Open:   recording(walletdb.Open),
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// openDB opens, or creates if create is set, a wallet database with driver and
+// returns it along with the driver's own database it wraps.
+func openDB(create bool, driver string, args ...interface{}) (wallet.DB, walletdb.DB, error) {
+	var driverDB walletdb.DB
+	record := func(db walletdb.DB) {
+		driverDB = db
+	}
+	args = append([]interface{}{driver, record}, args...)
+	if create {
+		db, err := wallet.CreateDB(recordingDbType, args...)
+		return db, driverDB, err
+	}
+	db, err := wallet.OpenDB(recordingDbType, args...)
+	return db, driverDB, err
+}
+
+// ChangePublicPassphrase changes the public passphrase of the loaded wallet.
+// The key of an encrypted badgerdb database is wrapped with the new passphrase
+// first, and the old passphrase keeps opening the database until the wallet's
+// passphrase has changed, so neither is lost if the change is interrupted.
+func (l *Loader) ChangePublicPassphrase(oldPass, newPass []byte) error {
+	const op errors.Op = "loader.ChangePublicPassphrase"
+
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	if l.wallet == nil {
+		return errors.E(op, errors.Invalid, "wallet is unopened")
+	}
+
+	var encryptedDB walletdb.DB
+	if l.dbDriver == "badgerdb" {
+		if encrypted, _ := badgerdb.IsEncrypted(l.driverDB); encrypted {
+			encryptedDB = l.driverDB
+		}
+	}
+	if encryptedDB != nil {
+		if err := badgerdb.ChangePassphrase(encryptedDB, oldPass, newPass); err != nil {
+			return errors.E(op, err)
+		}
+	}
+
+	err := l.wallet.ChangePublicPassphrase(oldPass, newPass)
+	kept := oldPass
+	if err == nil {
+		kept = newPass
+		l.pubPass = append([]byte{}, newPass...)
+	}
+	if encryptedDB != nil {
+		if commitErr := badgerdb.CommitPassphrase(encryptedDB, kept); err == nil {
+			err = commitErr
+		}
+	}
+	if err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
 // WalletExists returns whether a file exists at the loader's database path.
 // This may return an error for unexpected I/O failures.
 func (l *Loader) WalletExists() (bool, error) {
@@ -370,6 +669,188 @@ func (l *Loader) WalletExists() (bool, error) {
 	return exists, nil
 }
 
+// dbDriverFileName is the file in the database directory recording the driver
+// of a database written by ReplaceWalletDB.
+const dbDriverFileName = "wallet.driver"
+
+// ReplaceWalletDB replaces the wallet database with one of driver created by
+// write at the path it is given, which does not exist when write is called.
+// The existing database is only removed once write succeeds.  driver is
+// recorded in the database directory, where RecoverWalletDB finds it, and is
+// used by the loader from then on.  Returns with errors.Invalid if a wallet is
+// loaded.
+//
+// The new database and its driver record are written beside the database and
+// moved in place once complete, so that RecoverWalletDB can revert or finish
+// a replacement interrupted at any point.
+func (l *Loader) ReplaceWalletDB(driver string, write func(dbPath string) error) error {
+	const op errors.Op = "loader.ReplaceWalletDB"
+
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	if l.wallet != nil {
+		return errors.E(op, errors.Invalid, "wallet is loaded")
+	}
+	if err := os.MkdirAll(l.dbDirPath, 0700); err != nil {
+		return errors.E(op, err)
+	}
+
+	dbPath := filepath.Join(l.dbDirPath, walletDbName)
+	newPath := dbPath + ".new"
+	oldPath := dbPath + ".old"
+	driverPath := filepath.Join(l.dbDirPath, dbDriverFileName)
+	driverNewPath := driverPath + ".new"
+	discardNew := func() {
+		os.RemoveAll(newPath)
+		os.Remove(driverNewPath)
+	}
+	if err := os.RemoveAll(newPath); err != nil {
+		return errors.E(op, err)
+	}
+	if err := write(newPath); err != nil {
+		discardNew()
+		return errors.E(op, err)
+	}
+	// The driver record is complete before the database is moved, which
+	// marks the new database as complete.
+	if err := writeDatabaseDriver(driverNewPath, driver); err != nil {
+		discardNew()
+		return errors.E(op, err)
+	}
+
+	exists, err := fileExists(dbPath)
+	if err != nil {
+		discardNew()
+		return errors.E(op, err)
+	}
+	if exists {
+		os.RemoveAll(oldPath)
+		if err := os.Rename(dbPath, oldPath); err != nil {
+			discardNew()
+			return errors.E(op, err)
+		}
+	}
+	if err := os.Rename(newPath, dbPath); err != nil {
+		if exists {
+			os.Rename(oldPath, dbPath)
+		}
+		discardNew()
+		return errors.E(op, err)
+	}
+	l.dbDriver = driver
+	if err := os.Rename(driverNewPath, driverPath); err != nil {
+		// RecoverWalletDB finishes the replacement.
+		return errors.E(op, errors.IO, err)
+	}
+	if exists {
+		os.RemoveAll(oldPath)
+	}
+	return nil
+}
+
+// RecoverWalletDB reverts or finishes a ReplaceWalletDB interrupted by a crash
+// and returns the recorded database driver, or an empty string if no driver
+// was recorded.  A replacement interrupted before the new database was moved
+// in place is reverted, and one interrupted afterwards is finished.  It must
+// be called before the wallet is opened.
+func (l *Loader) RecoverWalletDB() (string, error) {
+	const op errors.Op = "loader.RecoverWalletDB"
+
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	dbPath := filepath.Join(l.dbDirPath, walletDbName)
+	newPath := dbPath + ".new"
+	oldPath := dbPath + ".old"
+	driverPath := filepath.Join(l.dbDirPath, dbDriverFileName)
+	driverNewPath := driverPath + ".new"
+
+	var exists [4]bool
+	for i, path := range []string{dbPath, oldPath, newPath, driverNewPath} {
+		var err error
+		exists[i], err = fileExists(path)
+		if err != nil {
+			return "", errors.E(op, err)
+		}
+	}
+	dbExists, oldExists, newExists, driverNewExists := exists[0], exists[1], exists[2], exists[3]
+
+	var err error
+	switch {
+	case !dbExists && oldExists:
+		// The original was moved aside but the new database was not
+		// moved in.
+		log.Infof("Restoring the wallet database replaced by an interrupted update")
+		os.RemoveAll(newPath)
+		os.Remove(driverNewPath)
+		err = os.Rename(oldPath, dbPath)
+	case newExists:
+		// The new database, which may be incomplete, was never moved
+		// in.
+		err = os.RemoveAll(newPath)
+		if err == nil {
+			err = os.Remove(driverNewPath)
+		}
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	case dbExists && driverNewExists:
+		// The new database was moved in but its driver was not
+		// recorded.
+		log.Infof("Finishing an interrupted update of the wallet database")
+		err = os.Rename(driverNewPath, driverPath)
+	}
+	if err != nil {
+		return "", errors.E(op, errors.IO, err)
+	}
+	if dbExists || oldExists {
+		if err := os.RemoveAll(oldPath); err != nil {
+			return "", errors.E(op, errors.IO, err)
+		}
+	}
+
+	driver, err := readDatabaseDriver(driverPath)
+	if err != nil {
+		return "", errors.E(op, err)
+	}
+	return driver, nil
+}
+
+// readDatabaseDriver returns the driver recorded at path by ReplaceWalletDB,
+// or an empty string if none was recorded.
+func readDatabaseDriver(path string) (string, error) {
+	driver, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.E(errors.IO, err)
+	}
+	return string(bytes.TrimSpace(driver)), nil
+}
+
+// writeDatabaseDriver records driver at path and syncs it to disk.
+func writeDatabaseDriver(path, driver string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	_, err = f.WriteString(driver + "\n")
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
+
 // LoadedWallet returns the loaded wallet, if any, and a bool for whether the
 // wallet has been loaded or not.  If true, the wallet pointer should be safe to
 // dereference.
@@ -403,8 +884,14 @@ func (l *Loader) UnloadWallet() error {
 		return errors.E(op, err)
 	}
 
+	for i := range l.pubPass {
+		l.pubPass[i] = 0
+	}
 	l.wallet = nil
 	l.db = nil
+	l.driverDB = nil
+	l.pubPass = nil
+	l.readOnly = false
 	return nil
 }
 
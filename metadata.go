@@ -0,0 +1,85 @@
+package mobilewallet
+
+import (
+	"github.com/decred/dcrwallet/wallet/walletdb"
+)
+
+// metadataBucketKey is the top-level wallet database bucket holding data
+// recorded by mobilewallet rather than dcrwallet.
+var metadataBucketKey = []byte("mobilewallet")
+
+func (lw *LibWallet) walletDB() (walletdb.DB, error) {
+	db, ok := lw.loader.WalletDB()
+	if !ok {
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
+	return db, nil
+}
+
+// readMetadata returns a copy of the metadata value recorded under key, or nil
+// if no value is recorded.
+func (lw *LibWallet) readMetadata(key []byte) ([]byte, error) {
+	db, err := lw.walletDB()
+	if err != nil {
+		return nil, err
+	}
+	return getMetadata(db, key)
+}
+
+// writeMetadata records value under key, creating the metadata bucket if it
+// does not exist yet.
+func (lw *LibWallet) writeMetadata(key, value []byte) error {
+	db, err := lw.walletDB()
+	if err != nil {
+		return err
+	}
+	return putMetadata(db, key, value)
+}
+
+// getMetadata is readMetadata for a database that may not belong to the loaded
+// wallet.
+func getMetadata(db walletdb.DB, key []byte) ([]byte, error) {
+	var value []byte
+	err := walletdb.View(db, func(tx walletdb.ReadTx) error {
+		b := tx.ReadBucket(metadataBucketKey)
+		if b == nil {
+			return nil
+		}
+		if v := b.Get(key); v != nil {
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// putMetadata is writeMetadata for a database that may not belong to the loaded
+// wallet.
+func putMetadata(db walletdb.DB, key, value []byte) error {
+	return walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		b := tx.ReadWriteBucket(metadataBucketKey)
+		if b == nil {
+			var err error
+			b, err = tx.CreateTopLevelBucket(metadataBucketKey)
+			if err != nil {
+				return err
+			}
+		}
+		return b.Put(key, value)
+	})
+}
+
+// deleteMetadata removes the metadata value recorded under key.
+func (lw *LibWallet) deleteMetadata(key []byte) error {
+	db, err := lw.walletDB()
+	if err != nil {
+		return err
+	}
+	return walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		b := tx.ReadWriteBucket(metadataBucketKey)
+		if b == nil {
+			return nil
+		}
+		return b.Delete(key)
+	})
+}
@@ -0,0 +1,321 @@
+package mobilewallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"path/filepath"
+
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet/walletdb"
+	"github.com/raedahgroup/mobilewallet/badgerdb"
+)
+
+// walletTopLevelBuckets lists every top-level bucket of a wallet database.
+// walletdb has no way to enumerate top-level buckets, so these are the buckets
+// created by dcrwallet followed by the bucket used for mobilewallet metadata.
+var walletTopLevelBuckets = [][]byte{
+	[]byte("waddrmgr"),
+	[]byte("wtxmgr"),
+	[]byte("wstakemgr"),
+	[]byte("meta"),
+	[]byte("agendaprefs"),
+	metadataBucketKey,
+}
+
+// dbSummary records the number of buckets and keys in a database along with a
+// hash of their contents, which must match between the source and destination
+// of a migration.
+type dbSummary struct {
+	buckets int
+	keys    int
+	hash    [sha256.Size]byte
+}
+
+// MigrateDatabase moves the wallet to the targetDriver database driver without
+// resyncing.  Every bucket and key of the current database is copied into a new
+// database created with targetDriver, the copy is verified against the
+// original, and the new database then atomically replaces the old one.  pubPass
+// opens an encrypted source database and encrypts a badgerdb target database
+// when database encryption is enabled.  Any loaded wallet is closed first and
+// must be opened again with OpenWallet.  targetDriver is recorded in the data
+// directory and used by InitLoader from then on, whatever driver NewLibWallet is
+// given.
+func (lw *LibWallet) MigrateDatabase(targetDriver string, pubPass []byte) error {
+	if targetDriver == lw.dbDriver {
+		return newWalletError(ErrInvalid)
+	}
+	found := false
+	for _, driver := range walletdb.SupportedDrivers() {
+		found = found || driver == targetDriver
+	}
+	if !found || targetDriver == "readonlybdb" || targetDriver == recordingDbType {
+		return translateError(errors.E(errors.Invalid, errors.Errorf("unknown database driver %q", targetDriver)))
+	}
+
+	summary, err := lw.rewriteDatabase(targetDriver, pubPass, false, nil)
+	if err != nil {
+		return translateError(err)
+	}
+	log.Infof("Migrated %d buckets and %d keys from %s to %s", summary.buckets,
+		summary.keys, lw.dbDriver, targetDriver)
+
+	lw.dbDriver = targetDriver
+	return nil
+}
+
+// rewriteDatabase copies the wallet database into a new database created with
+// driver, verifies the copy and replaces the original with it.  The original is
+// opened read-only.  pubPass opens an encrypted original and encrypts the copy,
+// which is a badgerdb database encrypted under a new key if encrypt is set, or
+// if database encryption is enabled.  finish, if not nil, is called with the
+// verified copy before it replaces the original.  Any loaded wallet is closed
+// first.
+func (lw *LibWallet) rewriteDatabase(driver string, pubPass []byte, encrypt bool, finish func(dst walletdb.DB) error) (*dbSummary, error) {
+	exists, err := lw.loader.WalletExists()
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, newWalletError(ErrNotExist)
+	}
+	if _, loaded := lw.loader.LoadedWallet(); loaded {
+		if err := lw.loader.UnloadWallet(); err != nil {
+			return nil, err
+		}
+	}
+
+	var summary *dbSummary
+	srcPath := filepath.Join(lw.loader.DbDirPath(), walletDbName)
+	srcDriver, srcArgs, err := lw.loader.readOnlyDbArgs(srcPath, pubPass)
+	if err != nil {
+		return nil, err
+	}
+	err = lw.loader.ReplaceWalletDB(driver, func(dbPath string) error {
+		src, err := walletdb.Open(srcDriver, srcArgs...)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		dstArgs := lw.loader.dbArgs(driver, dbPath, pubPass)
+		if encrypt {
+			dstArgs[1].(*badgerdb.Options).Encrypt = true
+		}
+		dst, err := walletdb.Create(driver, dstArgs...)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+
+		if err := copyDatabase(src, dst); err != nil {
+			return err
+		}
+		srcSummary, err := summarizeDatabase(src)
+		if err != nil {
+			return err
+		}
+		dstSummary, err := summarizeDatabase(dst)
+		if err != nil {
+			return err
+		}
+		if *srcSummary != *dstSummary {
+			return errors.E(errors.Bug, errors.Errorf("copied database does not "+
+				"match: copied %d buckets and %d keys, found %d buckets and %d keys",
+				srcSummary.buckets, srcSummary.keys, dstSummary.buckets, dstSummary.keys))
+		}
+		summary = dstSummary
+		if finish != nil {
+			return finish(dst)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// migrateBatchSize is the number of bytes written to the destination of a
+// migration before the transaction is committed.  Drivers such as badgerdb
+// limit the size of a single transaction.
+const migrateBatchSize = 1 << 20
+
+// batchWriter writes to a database in transactions of about migrateBatchSize
+// bytes.  Buckets are addressed by their path of keys from the top level, as
+// bucket handles do not outlive a transaction.
+type batchWriter struct {
+	db      walletdb.DB
+	tx      walletdb.ReadWriteTx
+	written int
+}
+
+// begin returns the current transaction, beginning one if there is none.
+func (w *batchWriter) begin() (walletdb.ReadWriteTx, error) {
+	if w.tx == nil {
+		tx, err := w.db.BeginReadWriteTx()
+		if err != nil {
+			return nil, err
+		}
+		w.tx = tx
+	}
+	return w.tx, nil
+}
+
+func (w *batchWriter) bucket(path [][]byte) (walletdb.ReadWriteBucket, error) {
+	tx, err := w.begin()
+	if err != nil {
+		return nil, err
+	}
+	b := tx.ReadWriteBucket(path[0])
+	for i := 1; b != nil && i < len(path); i++ {
+		b = b.NestedReadWriteBucket(path[i])
+	}
+	if b == nil {
+		return nil, errors.E(errors.Bug, "missing bucket in migrated database")
+	}
+	return b, nil
+}
+
+func (w *batchWriter) wrote(n int) error {
+	w.written += n
+	if w.written < migrateBatchSize {
+		return nil
+	}
+	return w.commit()
+}
+
+func (w *batchWriter) commit() error {
+	w.written = 0
+	if w.tx == nil {
+		return nil
+	}
+	tx := w.tx
+	w.tx = nil
+	return tx.Commit()
+}
+
+func (w *batchWriter) rollback() {
+	if w.tx != nil {
+		w.tx.Rollback()
+		w.tx = nil
+	}
+}
+
+// copyDatabase copies every top-level bucket of src into dst.  src is read
+// with a single transaction, and dst is written in batches.
+func copyDatabase(src, dst walletdb.DB) error {
+	w := &batchWriter{db: dst}
+	defer w.rollback()
+	err := walletdb.View(src, func(srcTx walletdb.ReadTx) error {
+		for _, key := range walletTopLevelBuckets {
+			srcBucket := srcTx.ReadBucket(key)
+			if srcBucket == nil {
+				continue
+			}
+			tx, err := w.begin()
+			if err != nil {
+				return err
+			}
+			if _, err := tx.CreateTopLevelBucket(key); err != nil {
+				return err
+			}
+			if err := copyBucket(srcBucket, w, [][]byte{key}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return w.commit()
+}
+
+// copyBucket recursively copies the keys and nested buckets of src into the
+// bucket at path.
+func copyBucket(src walletdb.ReadBucket, w *batchWriter, path [][]byte) error {
+	return src.ForEach(func(k, v []byte) error {
+		dst, err := w.bucket(path)
+		if err != nil {
+			return err
+		}
+		// Keys and values are only valid during the source transaction.
+		k = append([]byte{}, k...)
+		if v == nil {
+			if nested := src.NestedReadBucket(k); nested != nil {
+				if _, err := dst.CreateBucket(k); err != nil {
+					return err
+				}
+				return copyBucket(nested, w, append(path[:len(path):len(path)], k))
+			}
+		}
+		if err := dst.Put(k, append([]byte{}, v...)); err != nil {
+			return err
+		}
+		return w.wrote(len(k) + len(v))
+	})
+}
+
+// summarizeDatabase counts and hashes every top-level bucket of db.  Buckets
+// are hashed in key order, so the summary only depends on the contents and not
+// on the driver.
+func summarizeDatabase(db walletdb.DB) (*dbSummary, error) {
+	s := new(dbSummary)
+	h := sha256.New()
+	err := walletdb.View(db, func(tx walletdb.ReadTx) error {
+		for _, key := range walletTopLevelBuckets {
+			b := tx.ReadBucket(key)
+			if b == nil {
+				continue
+			}
+			writeHashRecord(h, 'b', key, nil)
+			if err := summarizeBucket(s, h, b); err != nil {
+				return err
+			}
+			writeHashRecord(h, 'e', nil, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	copy(s.hash[:], h.Sum(nil))
+	return s, nil
+}
+
+func summarizeBucket(s *dbSummary, h hash.Hash, b walletdb.ReadBucket) error {
+	s.buckets++
+	var prev []byte
+	return b.ForEach(func(k, v []byte) error {
+		if prev != nil && bytes.Compare(prev, k) >= 0 {
+			return errors.E(errors.Bug, "bucket keys are not ordered")
+		}
+		prev = append(prev[:0], k...)
+		if v == nil {
+			if nested := b.NestedReadBucket(k); nested != nil {
+				writeHashRecord(h, 'b', k, nil)
+				if err := summarizeBucket(s, h, nested); err != nil {
+					return err
+				}
+				writeHashRecord(h, 'e', nil, nil)
+				return nil
+			}
+		}
+		s.keys++
+		writeHashRecord(h, 'k', k, v)
+		return nil
+	})
+}
+
+// writeHashRecord writes a tagged, length-delimited record to h so that no two
+// different trees hash the same record stream.
+func writeHashRecord(h hash.Hash, tag byte, k, v []byte) {
+	var lens [8]byte
+	binary.LittleEndian.PutUint32(lens[0:4], uint32(len(k)))
+	binary.LittleEndian.PutUint32(lens[4:8], uint32(len(v)))
+	h.Write([]byte{tag})
+	h.Write(lens[:])
+	h.Write(k)
+	h.Write(v)
+}
@@ -0,0 +1,234 @@
+package mobilewallet
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/decred/dcrwallet/wallet"
+)
+
+// newTestWallet creates a testnet wallet using driver in a new directory, which
+// the caller removes.  The wallet is left open.
+func newTestWallet(t *testing.T, driver string) (*LibWallet, string) {
+	dir, err := ioutil.TempDir("", "mobilewallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lw := NewLibWallet(dir, driver, "testnet3")
+	lw.InitLoader()
+	seed, err := lw.GenerateSeed()
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	if err := lw.CreateWallet("private", seed, nil); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return lw, dir
+}
+
+// reopenTestWallet opens the wallet in dir with a new LibWallet created with
+// driver, as when the application is started again.
+func reopenTestWallet(t *testing.T, dir, driver string) *LibWallet {
+	lw := NewLibWallet(dir, driver, "testnet3")
+	lw.InitLoader()
+	if err := lw.OpenWallet([]byte(wallet.InsecurePubPassphrase)); err != nil {
+		t.Fatalf("opening wallet with the %s driver: %v", lw.dbDriver, err)
+	}
+	return lw
+}
+
+// checkNoReplacementFiles fails the test if a file written while replacing the
+// database of lw was left behind.
+func checkNoReplacementFiles(t *testing.T, lw *LibWallet, prefix string) {
+	dbDir := lw.loader.DbDirPath()
+	for _, name := range []string{walletDbName + ".old", walletDbName + ".new", dbDriverFileName + ".new"} {
+		if _, err := os.Stat(filepath.Join(dbDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s%s was left in the database directory", prefix, name)
+		}
+	}
+}
+
+func TestMigrateDatabaseRoundTrip(t *testing.T) {
+	lw, dir := newTestWallet(t, "bdb")
+	defer os.RemoveAll(dir)
+
+	key, value := []byte("migratetest"), []byte("kept")
+	if err := lw.writeMetadata(key, value); err != nil {
+		t.Fatal(err)
+	}
+	address, err := lw.CurrentAddress(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubPass := []byte(wallet.InsecurePubPassphrase)
+	for _, driver := range []string{"badgerdb", "bdb"} {
+		if err := lw.MigrateDatabase(driver, pubPass); err != nil {
+			t.Fatalf("migrating to %s: %v", driver, err)
+		}
+
+		// The recorded driver overrides the one the wallet is created
+		// with.
+		lw = reopenTestWallet(t, dir, "bdb")
+		if lw.dbDriver != driver {
+			t.Fatalf("reopened wallet uses the %s driver, want %s", lw.dbDriver, driver)
+		}
+		v, err := lw.readMetadata(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(v, value) {
+			t.Errorf("metadata after migrating to %s is %q, want %q", driver, v, value)
+		}
+		migratedAddress, err := lw.CurrentAddress(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if migratedAddress != address {
+			t.Errorf("current address after migrating to %s is %s, want %s",
+				driver, migratedAddress, address)
+		}
+		checkNoReplacementFiles(t, lw, "")
+	}
+	lw.CloseWallet()
+}
+
+// TestMigrateDatabaseInterrupted checks that a wallet whose database was being
+// replaced when the application stopped opens with the database and driver
+// from either before or after the replacement.
+func TestMigrateDatabaseInterrupted(t *testing.T) {
+	tests := []struct {
+		name string
+		// files lists the files left in the database directory by a
+		// migration from bdb to badgerdb stopped at some step.  Values
+		// are "bdb" and "badgerdb" for a copy of the database of that
+		// driver, or the contents of a file.
+		files      map[string]string
+		wantDriver string
+	}{{
+		name: "writing the new database",
+		files: map[string]string{
+			walletDbName:          "bdb",
+			walletDbName + ".new": "badgerdb",
+		},
+		wantDriver: "bdb",
+	}, {
+		name: "recording the new driver",
+		files: map[string]string{
+			walletDbName:              "bdb",
+			walletDbName + ".new":     "badgerdb",
+			dbDriverFileName + ".new": "badg",
+		},
+		wantDriver: "bdb",
+	}, {
+		name: "moving the old database aside",
+		files: map[string]string{
+			walletDbName + ".old":     "bdb",
+			walletDbName + ".new":     "badgerdb",
+			dbDriverFileName + ".new": "badgerdb\n",
+		},
+		wantDriver: "bdb",
+	}, {
+		name: "moving the new database in",
+		files: map[string]string{
+			walletDbName + ".old":     "bdb",
+			walletDbName:              "badgerdb",
+			dbDriverFileName + ".new": "badgerdb\n",
+		},
+		wantDriver: "badgerdb",
+	}, {
+		name: "removing the old database",
+		files: map[string]string{
+			walletDbName + ".old": "bdb",
+			walletDbName:          "badgerdb",
+			dbDriverFileName:      "badgerdb\n",
+		},
+		wantDriver: "badgerdb",
+	}}
+
+	// Keep a copy of the database of each driver.
+	lw, dir := newTestWallet(t, "bdb")
+	defer os.RemoveAll(dir)
+	address, err := lw.CurrentAddress(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lw.CloseWallet()
+	dbDir := lw.loader.DbDirPath()
+	dbPath := filepath.Join(dbDir, walletDbName)
+	copies := map[string]string{
+		"bdb":      filepath.Join(dir, "bdb.db"),
+		"badgerdb": filepath.Join(dir, "badger.db"),
+	}
+	copyPath(t, dbPath, copies["bdb"])
+	if err := lw.MigrateDatabase("badgerdb", []byte(wallet.InsecurePubPassphrase)); err != nil {
+		t.Fatal(err)
+	}
+	copyPath(t, dbPath, copies["badgerdb"])
+
+	for _, test := range tests {
+		if err := os.RemoveAll(dbDir); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(dbDir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		for name, contents := range test.files {
+			path := filepath.Join(dbDir, name)
+			if src, ok := copies[contents]; ok {
+				copyPath(t, src, path)
+			} else if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		lw := reopenTestWallet(t, dir, "bdb")
+		if lw.dbDriver != test.wantDriver {
+			t.Errorf("%s: wallet opened with the %s driver, want %s", test.name,
+				lw.dbDriver, test.wantDriver)
+		}
+		if got, err := lw.CurrentAddress(0); err != nil || got != address {
+			t.Errorf("%s: current address is %s (%v), want %s", test.name, got, err, address)
+		}
+		checkNoReplacementFiles(t, lw, test.name+": ")
+		lw.CloseWallet()
+	}
+}
+
+// copyPath copies the file or directory at src to dst.
+func copyPath(t *testing.T, src, dst string) {
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		_, err = io.Copy(out, in)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
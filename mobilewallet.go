@@ -8,7 +8,6 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"math"
 	"net"
 	"os"
 	"os/signal"
@@ -39,6 +38,7 @@ import (
 	"github.com/decred/dcrwallet/wallet/txrules"
 	walletseed "github.com/decred/dcrwallet/walletseed"
 	"github.com/decred/slog"
+	"github.com/raedahgroup/mobilewallet/badgerdb"
 )
 
 var shutdownRequestChannel = make(chan struct{})
@@ -58,7 +58,10 @@ type LibWallet struct {
 	mu            sync.Mutex
 	activeNet     *netparams.Params
 	syncResponses []SpvSyncResponse
-	rescannning   bool
+	rescanning    bool
+	cancelRescan  context.CancelFunc
+	proxy         *proxyConfig
+	received      receivedCache
 }
 
 func NewLibWallet(homeDir string, dbDriver string, netType string) *LibWallet {
@@ -109,7 +112,7 @@ func (lw *LibWallet) UnlockWallet(privPass []byte) error {
 
 	wallet, ok := lw.loader.LoadedWallet()
 	if !ok {
-		return fmt.Errorf("Wallet has not been loaded")
+		return newWalletError(ErrWalletNotLoaded)
 	}
 
 	defer func() {
@@ -119,7 +122,7 @@ func (lw *LibWallet) UnlockWallet(privPass []byte) error {
 	}()
 
 	err := wallet.Unlock(privPass, nil)
-	return err
+	return translateError(err)
 }
 
 func (lw *LibWallet) LockWallet() {
@@ -164,7 +167,7 @@ func (lw *LibWallet) ChangePublicPassphrase(oldPass []byte, newPass []byte) erro
 		newPass = []byte(wallet.InsecurePubPassphrase)
 	}
 
-	err := lw.wallet.ChangePublicPassphrase(oldPass, newPass)
+	err := lw.loader.ChangePublicPassphrase(oldPass, newPass)
 	if err != nil {
 		return translateError(err)
 	}
@@ -247,48 +250,103 @@ func (lw *LibWallet) InitLoader() {
 		VotingAddress: nil,
 		TicketFee:     10e8,
 	}
-	fmt.Println("Initizing Loader: ", lw.dataDir, "Db: ", lw.dbDriver)
 	l := NewLoader(lw.activeNet.Params, lw.dataDir, stakeOptions,
 		20, false, 10e5, wallet.DefaultAccountGapLimit)
+	// A database migrated by MigrateDatabase keeps its driver.
+	if driver, err := l.RecoverWalletDB(); err != nil {
+		log.Errorf("Failed to recover wallet database: %v", err)
+	} else if driver != "" && driver != lw.dbDriver {
+		log.Infof("Using the %s database driver the wallet was migrated to", driver)
+		lw.dbDriver = driver
+	}
+	fmt.Println("Initizing Loader: ", lw.dataDir, "Db: ", lw.dbDriver)
 	l.SetDatabaseDriver(lw.dbDriver)
 	lw.loader = l
 	go shutdownListener()
 }
 
-func (lw *LibWallet) CreateWallet(passphrase string, seedMnemonic string) error {
+// Database profiles accepted by SetDatabaseProfile.
+const (
+	DbProfileDefault   = "default"
+	DbProfileLowMemory = "low_memory"
+	DbProfileFast      = "fast"
+)
+
+// SetDatabaseProfile tunes the badgerdb database for memory-constrained devices
+// (DbProfileLowMemory) or for speed (DbProfileFast).  It has no effect on other
+// database drivers and must be called after InitLoader and before the wallet is
+// created or opened.
+func (lw *LibWallet) SetDatabaseProfile(profile string) error {
+	var opts *badgerdb.Options
+	switch profile {
+	case DbProfileDefault:
+		opts = badgerdb.DefaultOptions()
+	case DbProfileLowMemory:
+		opts = badgerdb.LowMemoryOptions()
+	case DbProfileFast:
+		opts = badgerdb.FastOptions()
+	default:
+		return newWalletError(ErrInvalid)
+	}
+	lw.loader.SetBadgerOptions(opts)
+	return nil
+}
+
+// SetDatabaseEncryption sets whether badgerdb wallet databases created by
+// CreateWallet or MigrateDatabase encrypt transaction history, addresses and
+// labels with a key protected by the public passphrase.  Database keys are not
+// encrypted.  The protection is only as strong as the public passphrase, which
+// can be changed with ChangePublicPassphrase.  It must be called after
+// InitLoader.
+func (lw *LibWallet) SetDatabaseEncryption(enabled bool) {
+	lw.loader.SetDatabaseEncryption(enabled)
+}
+
+// CreateWallet creates a wallet from seedMnemonic.  birthday is optional and
+// should be set when restoring a wallet whose first transaction is known to be
+// after a certain time or block, so that syncing can skip earlier blocks.
+func (lw *LibWallet) CreateWallet(passphrase string, seedMnemonic string, birthday *WalletBirthday) error {
 	log.Info("Creating Wallet")
 	if len(seedMnemonic) == 0 {
-		return errors.New(ErrEmptySeed)
+		return newWalletError(ErrEmptySeed)
 	}
 	pubPass := []byte(wallet.InsecurePubPassphrase)
 	privPass := []byte(passphrase)
 	seed, err := walletseed.DecodeUserInput(seedMnemonic)
 	if err != nil {
 		log.Error(err)
-		return err
+		return translateError(err)
 	}
 
 	w, err := lw.loader.CreateNewWallet(pubPass, privPass, seed)
 	if err != nil {
 		log.Error(err)
-		return err
+		return translateError(err)
 	}
 	lw.wallet = w
 
+	if birthday != nil {
+		err = lw.writeMetadata(birthdayKey, serializeBirthday(birthday))
+		if err != nil {
+			log.Error(err)
+			return translateError(err)
+		}
+	}
+
 	log.Info("Created Wallet")
 	return nil
 }
 
 func (lw *LibWallet) CloseWallet() error {
 	err := lw.loader.UnloadWallet()
-	return err
+	return translateError(err)
 }
 
 func (lw *LibWallet) GenerateSeed() (string, error) {
 	seed, err := hdkeychain.GenerateSeed(hdkeychain.RecommendedSeedLen)
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return "", translateError(err)
 	}
 
 	return walletseed.EncodeMnemonic(seed), nil
@@ -306,19 +364,102 @@ func (lw *LibWallet) AddSyncResponse(syncResponse SpvSyncResponse) {
 func (lw *LibWallet) SpvSync(peerAddresses string) error {
 	wallet, ok := lw.loader.LoadedWallet()
 	if !ok {
-		return errors.New(ErrWalletNotLoaded)
+		return newWalletError(ErrWalletNotLoaded)
+	}
+	if lw.loader.ReadOnly() {
+		return newWalletError(ErrFailedPrecondition)
+	}
+
+	// Peers are discovered by DNS seeding when none are specified, which
+	// cannot be routed through the proxy.
+	if lw.currentProxy() != nil && len(peerAddresses) == 0 {
+		return newWalletError(ErrProxyRequiresPeers)
+	}
+
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		lw.cancelSync = cancel
+		syncer, syncErr := lw.newSpvSyncer(ctx, wallet, peerAddresses)
+		if syncErr != nil {
+			lw.notifySyncError(SyncBackendSPV, syncErr.Code, syncErr)
+			return
+		}
+		syncer.SetNotifications(lw.spvNotifications(wallet))
+		wallet.SetNetworkBackend(syncer)
+		lw.loader.SetNetworkBackend(syncer)
+		err := syncer.Run(ctx)
+		if err != nil {
+			code := syncErrorCode(err)
+			switch code {
+			case SyncErrCanceled:
+				err = errors.Errorf("SPV synchronization canceled: %v", err)
+			case SyncErrDeadlineExceeded:
+				err = errors.Errorf("SPV synchronization deadline exceeded: %v", err)
+			}
+			lw.notifySyncError(SyncBackendSPV, code, err)
+		}
+	}()
+	return nil
+}
+
+// newSpvSyncer creates an SPV syncer for w that connects to the semicolon
+// separated peerAddresses, or to peers found by DNS seeding if none are given.
+// When a proxy is set, peers are reached through tunnels that are closed when
+// ctx is cancelled.
+func (lw *LibWallet) newSpvSyncer(ctx context.Context, w *wallet.Wallet, peerAddresses string) (*spv.Syncer, *SyncError) {
+	proxy := lw.currentProxy()
+	lookup := net.LookupIP
+	if proxy != nil {
+		lookup = proxy.lookup
 	}
 
 	addr := &net.TCPAddr{IP: net.ParseIP("::1"), Port: 0}
-	amgrDir := filepath.Join(lw.dataDir, lw.wallet.ChainParams().Name)
-	amgr := addrmgr.New(amgrDir, net.LookupIP) // TODO: be mindful of tor
-	lp := p2p.NewLocalPeer(wallet.ChainParams(), addr, amgr)
+	amgrDir := filepath.Join(lw.dataDir, w.ChainParams().Name)
+	amgr := addrmgr.New(amgrDir, lookup)
+	lp := p2p.NewLocalPeer(w.ChainParams(), addr, amgr)
+	syncer := spv.NewSyncer(w, lp)
 
-	ntfns := &spv.Notifications{
+	var spvConnect []string
+	if len(peerAddresses) > 0 {
+		spvConnect = strings.Split(peerAddresses, ";")
+	}
+	if proxy != nil && len(spvConnect) == 0 {
+		return nil, newSyncError(SyncBackendSPV, SyncErrNoPeers, newWalletError(ErrProxyRequiresPeers))
+	}
+	if len(spvConnect) > 0 {
+		spvConnects := make([]string, len(spvConnect))
+		for i := 0; i < len(spvConnect); i++ {
+			spvConnect, err := NormalizeAddress(spvConnect[i], lw.activeNet.Params.DefaultPort)
+			if err != nil {
+				return nil, newSyncError(SyncBackendSPV, SyncErrInvalidPeerAddress,
+					errors.Errorf("SPV Connect address invalid: %v", err))
+			}
+			if proxy != nil {
+				tunnel, err := newProxyTunnel(proxy, spvConnect)
+				if err != nil {
+					return nil, newSyncError(SyncBackendSPV, SyncErrNetworkUnreachable, err)
+				}
+				go tunnel.serve(ctx)
+				spvConnect = tunnel.Addr()
+			}
+			spvConnects[i] = spvConnect
+		}
+		syncer.SetPersistantPeers(spvConnects)
+	}
+	return syncer, nil
+}
+
+// spvNotifications returns the SPV syncer notifications that are forwarded to
+// the registered sync responses.
+func (lw *LibWallet) spvNotifications(wallet *wallet.Wallet) *spv.Notifications {
+	return &spv.Notifications{
 		Synced: func(sync bool) {
 			for _, syncResponse := range lw.syncResponses {
 				syncResponse.OnSynced(sync)
 			}
+			if sync {
+				lw.rescanPendingImports()
+			}
 		},
 		FetchHeadersStarted: func() {
 			for _, syncResponse := range lw.syncResponses {
@@ -331,6 +472,9 @@ func (lw *LibWallet) SpvSync(peerAddresses string) error {
 			}
 		},
 		FetchHeadersFinished: func() {
+			// Called before address discovery, which starts after any
+			// blocks skipped for the wallet birthday.
+			lw.applyBirthday()
 			for _, syncResponse := range lw.syncResponses {
 				syncResponse.OnFetchedHeaders(0, 0, FINISH)
 			}
@@ -378,6 +522,8 @@ func (lw *LibWallet) SpvSync(peerAddresses string) error {
 			for _, syncResponse := range lw.syncResponses {
 				syncResponse.OnRescan(0, FINISH)
 			}
+			lw.clearReceivedCache()
+			lw.verifyBirthday()
 		},
 		PeerDisconnected: func(peerCount int32, addr string) {
 			for _, syncResponse := range lw.syncResponses {
@@ -390,52 +536,6 @@ func (lw *LibWallet) SpvSync(peerAddresses string) error {
 			}
 		},
 	}
-	var spvConnect []string
-	if len(peerAddresses) > 0 {
-		spvConnect = strings.Split(peerAddresses, ";")
-	}
-	go func() {
-		syncer := spv.NewSyncer(wallet, lp)
-		syncer.SetNotifications(ntfns)
-		if len(spvConnect) > 0 {
-			spvConnects := make([]string, len(spvConnect))
-			for i := 0; i < len(spvConnect); i++ {
-				spvConnect, err := NormalizeAddress(spvConnect[i], lw.activeNet.Params.DefaultPort)
-				if err != nil {
-					for _, syncResponse := range lw.syncResponses {
-						syncResponse.OnSyncError(3, errors.E("SPV Connect address invalid: %v", err))
-					}
-					return
-				}
-				spvConnects[i] = spvConnect
-			}
-			syncer.SetPersistantPeers(spvConnects)
-		}
-		wallet.SetNetworkBackend(syncer)
-		lw.loader.SetNetworkBackend(syncer)
-		ctx, cancel := context.WithCancel(context.Background())
-		lw.cancelSync = cancel
-		err := syncer.Run(ctx)
-		if err != nil {
-			if err == context.Canceled {
-				for _, syncResponse := range lw.syncResponses {
-					syncResponse.OnSyncError(1, errors.E("SPV synchronization canceled: %v", err))
-				}
-
-				return
-			} else if err == context.DeadlineExceeded {
-				for _, syncResponse := range lw.syncResponses {
-					syncResponse.OnSyncError(2, errors.E("SPV synchronization deadline exceeded: %v", err))
-				}
-				return
-			}
-			for _, syncResponse := range lw.syncResponses {
-				syncResponse.OnSyncError(-1, err)
-			}
-			return
-		}
-	}()
-	return nil
 }
 
 func (lw *LibWallet) RpcSync(networkAddress string, username string, password string, cert []byte) error {
@@ -444,8 +544,8 @@ func (lw *LibWallet) RpcSync(networkAddress string, username string, password st
 	wallet, walletLoaded := lw.loader.LoadedWallet()
 	if walletLoaded {
 		_, err := wallet.NetworkBackend()
-		if err == nil {
-			return errors.New(ErrFailedPrecondition)
+		if err == nil || lw.loader.ReadOnly() {
+			return newWalletError(ErrFailedPrecondition)
 		}
 	}
 
@@ -458,23 +558,45 @@ func (lw *LibWallet) RpcSync(networkAddress string, username string, password st
 	if chainClient == nil {
 		networkAddress, err := NormalizeAddress(networkAddress, lw.activeNet.JSONRPCClientPort)
 		if err != nil {
-			return errors.New(ErrInvalidAddress)
+			return newWalletError(ErrInvalidAddress)
+		}
+		// The RPC client has no proxy setting that can be changed, so it
+		// connects through a tunnel that stays open while it is in use.
+		host := networkAddress
+		closeTunnel := func() {}
+		if proxy := lw.currentProxy(); proxy != nil {
+			tunnel, err := newProxyTunnel(proxy, networkAddress)
+			if err != nil {
+				lw.notifySyncError(SyncBackendRPC, SyncErrNetworkUnreachable, err)
+				return newWalletError(ErrUnavailable)
+			}
+			tunnelCtx, cancel := context.WithCancel(ctx)
+			go tunnel.serve(tunnelCtx)
+			host = tunnel.Addr()
+			closeTunnel = cancel
 		}
-		chainClient, err = chain.NewRPCClient(lw.activeNet.Params, networkAddress, username,
+
+		chainClient, err = chain.NewRPCClient(lw.activeNet.Params, host, username,
 			password, cert, len(cert) == 0)
 		if err != nil {
+			closeTunnel()
 			return translateError(err)
 		}
-
-		err = chainClient.Start(ctx, false)
+		err = lw.checkRPCServer(ctx, host, username, password, cert)
+		if err == nil {
+			err = chainClient.Start(ctx, false)
+		}
 		if err != nil {
-			if err == rpcclient.ErrInvalidAuth {
-				return errors.New(ErrInvalid)
+			closeTunnel()
+			code := syncErrorCode(err)
+			lw.notifySyncError(SyncBackendRPC, code, err)
+			switch code {
+			case SyncErrAuthFailure, SyncErrChainMismatch:
+				return newWalletError(ErrInvalid)
+			case SyncErrCanceled:
+				return newWalletError(ErrContextCanceled)
 			}
-			if errors.Match(errors.E(context.Canceled), err) {
-				return errors.New(ErrContextCanceled)
-			}
-			return errors.New(ErrUnavailable)
+			return newWalletError(ErrUnavailable)
 		}
 		lw.mu.Lock()
 		lw.rpcClient = chainClient
@@ -496,6 +618,9 @@ func (lw *LibWallet) RpcSync(networkAddress string, username string, password st
 			for _, syncResponse := range lw.syncResponses {
 				syncResponse.OnSynced(sync)
 			}
+			if sync {
+				lw.rescanPendingImports()
+			}
 		},
 		FetchMissingCFiltersStarted: func() {
 			for _, syncResponse := range lw.syncResponses {
@@ -555,6 +680,7 @@ func (lw *LibWallet) RpcSync(networkAddress string, username string, password st
 			for _, syncResponse := range lw.syncResponses {
 				syncResponse.OnRescan(0, FINISH)
 			}
+			lw.clearReceivedCache()
 		},
 	}
 	syncer := chain.NewRPCSyncer(wallet, chainClient)
@@ -566,28 +692,56 @@ func (lw *LibWallet) RpcSync(networkAddress string, username string, password st
 		// reconnect.
 		err := syncer.Run(ctx, true)
 		if err != nil {
-			if err == context.Canceled {
-				for _, syncResponse := range lw.syncResponses {
-					syncResponse.OnSyncError(1, errors.E("SPV synchronization canceled: %v", err))
-				}
-
-				return
-			} else if err == context.DeadlineExceeded {
-				for _, syncResponse := range lw.syncResponses {
-					syncResponse.OnSyncError(2, errors.E("SPV synchronization deadline exceeded: %v", err))
-				}
-
-				return
-			}
-			for _, syncResponse := range lw.syncResponses {
-				syncResponse.OnSyncError(-1, err)
+			code := syncErrorCode(err)
+			switch code {
+			case SyncErrCanceled:
+				err = errors.Errorf("RPC synchronization canceled: %v", err)
+			case SyncErrDeadlineExceeded:
+				err = errors.Errorf("RPC synchronization deadline exceeded: %v", err)
 			}
+			lw.notifySyncError(SyncBackendRPC, code, err)
 		}
 	}()
 
 	return nil
 }
 
+// checkRPCServer connects to the dcrd RPC server at host to check the
+// credentials and that the server is on the wallet's network before the chain
+// client is started, as the chain client does not report a server on another
+// network with an error that can be told apart from others.
+func (lw *LibWallet) checkRPCServer(ctx context.Context, host, user, pass string, cert []byte) error {
+	client, err := rpcclient.New(&rpcclient.ConnConfig{
+		Host:                 host,
+		Endpoint:             "ws",
+		User:                 user,
+		Pass:                 pass,
+		Certificates:         cert,
+		DisableAutoReconnect: true,
+		DisableConnectOnNew:  true,
+		DisableTLS:           len(cert) == 0,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		client.Shutdown()
+		client.WaitForShutdown()
+	}()
+
+	if err := client.Connect(ctx, false); err != nil {
+		return errors.E(errors.IO, err)
+	}
+	net, err := client.GetCurrentNet()
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	if net != lw.activeNet.Net {
+		return errChainMismatch
+	}
+	return nil
+}
+
 func (lw *LibWallet) DropSpvConnection() {
 	if lw.cancelSync != nil {
 		lw.cancelSync()
@@ -603,57 +757,188 @@ func done(ctx context.Context) bool {
 	}
 }
 
+// OpenWallet opens the existing wallet.  It fails with ErrRepairNeeded if the
+// database was left unopenable by a crash and must be repaired with
+// RepairDatabase.
 func (lw *LibWallet) OpenWallet(pubPass []byte) error {
 
 	w, err := lw.loader.OpenExistingWallet(pubPass)
 	if err != nil {
 		log.Error(err)
+		if badgerdb.IsRepairNeeded(err) {
+			return newWalletError(ErrRepairNeeded)
+		}
+		return translateError(err)
+	}
+	lw.wallet = w
+	return nil
+}
+
+// OpenReadOnlyWallet opens the wallet database at dbPath, or the wallet's own
+// database if dbPath is empty, without write access.  A read-only wallet can be
+// queried but cannot sync, create transactions or otherwise change the
+// database.  dbPath may be a snapshot written by WriteSnapshot, which can be
+// opened while another LibWallet is using the wallet it was taken from.
+func (lw *LibWallet) OpenReadOnlyWallet(dbPath string, pubPass []byte) error {
+	w, err := lw.loader.OpenReadOnlyWallet(dbPath, pubPass)
+	if err != nil {
+		log.Error(err)
+		if badgerdb.IsRepairNeeded(err) {
+			return newWalletError(ErrRepairNeeded)
+		}
 		return translateError(err)
 	}
 	lw.wallet = w
 	return nil
 }
 
+// WriteSnapshot writes a consistent copy of the loaded wallet's database to
+// dbPath, which must not exist.  The copy can be opened with
+// OpenReadOnlyWallet.
+func (lw *LibWallet) WriteSnapshot(dbPath string) error {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return newWalletError(ErrWalletNotLoaded)
+	}
+	if err := lw.loader.WriteSnapshot(dbPath); err != nil {
+		log.Error(err)
+		return translateError(err)
+	}
+	return nil
+}
+
+// RescanBlocks rescans the main chain from the genesis block, or from the
+// wallet birthday if the wallet has one, reporting progress through the
+// registered sync responses.
 func (lw *LibWallet) RescanBlocks() error {
+	return translateError(lw.rescanWithSyncResponses(lw.birthdayScanStart(), nil))
+}
+
+// rescanWithSyncResponses starts a rescan from startHeight that reports its
+// progress through the registered sync responses.  onFinish, if not nil, is
+// called once the rescan reaches the main chain tip.
+func (lw *LibWallet) rescanWithSyncResponses(startHeight int32, onFinish func()) error {
+	return lw.rescan(startHeight, func(p *wallet.RescanProgress, scanned, total, percentage int32) bool {
+		for _, response := range lw.syncResponses {
+			response.OnRescan(p.ScannedThrough, PROGRESS)
+		}
+		return true
+	}, func(height int32, cancelled bool, err error) {
+		if err != nil {
+			return
+		}
+		state := FINISH
+		if cancelled {
+			state = PROGRESS
+		}
+		for _, response := range lw.syncResponses {
+			response.OnRescan(height, state)
+		}
+		if !cancelled && onFinish != nil {
+			onFinish()
+		}
+	})
+}
+
+// RescanFromHeight rescans the main chain starting at the block with the given
+// height.  Progress is reported to response until the rescan completes, fails
+// or is cancelled with CancelRescan.  Only one rescan may run at a time.
+func (lw *LibWallet) RescanFromHeight(height int32, response BlockScanResponse) error {
+	err := lw.rescan(height, func(p *wallet.RescanProgress, scanned, total, percentage int32) bool {
+		return response.OnScan(p.ScannedThrough, scanned, total, percentage)
+	}, func(height int32, cancelled bool, err error) {
+		if err != nil {
+			response.OnError(err.Error())
+			return
+		}
+		response.OnEnd(height, cancelled)
+	})
+	return translateError(err)
+}
+
+// CancelRescan stops a rescan started with RescanBlocks or RescanFromHeight.
+// It does nothing if no rescan is running.
+func (lw *LibWallet) CancelRescan() {
+	lw.mu.Lock()
+	cancel := lw.cancelRescan
+	lw.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// IsRescanning returns whether a rescan started with RescanBlocks or
+// RescanFromHeight is running.
+func (lw *LibWallet) IsRescanning() bool {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.rescanning
+}
+
+// rescan runs a rescan from startHeight to the current main chain tip in the
+// background.  onProgress is called after each batch of scanned blocks and may
+// return false to cancel the rescan.  onEnd is called once with the last
+// scanned height when the rescan ends.
+func (lw *LibWallet) rescan(startHeight int32,
+	onProgress func(p *wallet.RescanProgress, scanned, total, percentage int32) bool,
+	onEnd func(height int32, cancelled bool, err error)) error {
+
 	netBackend, err := lw.wallet.NetworkBackend()
 	if err != nil {
-		return errors.E(ErrNotConnected)
+		return newWalletError(ErrNotConnected)
+	}
+
+	_, tipHeight := lw.wallet.MainChainTip()
+	if startHeight < 0 || startHeight > tipHeight {
+		return newWalletError(ErrInvalid)
 	}
 
-	if lw.rescannning {
-		return errors.E(ErrInvalid)
+	lw.mu.Lock()
+	if lw.rescanning {
+		lw.mu.Unlock()
+		return newWalletError(ErrInvalid)
 	}
+	ctx, cancel := context.WithCancel(contextWithShutdownCancel(context.Background()))
+	lw.rescanning = true
+	lw.cancelRescan = cancel
+	lw.mu.Unlock()
 
 	go func() {
 		defer func() {
-			lw.rescannning = false
+			cancel()
+			lw.mu.Lock()
+			lw.rescanning = false
+			lw.cancelRescan = nil
+			lw.mu.Unlock()
+			lw.clearReceivedCache()
 		}()
-		lw.rescannning = true
+
+		total := tipHeight - startHeight + 1
+		scannedThrough := startHeight - 1
 		progress := make(chan wallet.RescanProgress, 1)
-		ctx := contextWithShutdownCancel(context.Background())
-		var totalHeight int32
-		go lw.wallet.RescanProgressFromHeight(ctx, netBackend, 0, progress)
+		go lw.wallet.RescanProgressFromHeight(ctx, netBackend, startHeight, progress)
 		for p := range progress {
 			if p.Err != nil {
+				if ctx.Err() != nil {
+					// Cancelled, drain until the rescan closes
+					// the channel.
+					continue
+				}
 				log.Error(p.Err)
-
+				onEnd(scannedThrough, false, p.Err)
 				return
 			}
-			totalHeight += p.ScannedThrough
-			for _, response := range lw.syncResponses {
-				response.OnRescan(p.ScannedThrough, PROGRESS)
+			scannedThrough = p.ScannedThrough
+			scanned := scannedThrough - startHeight + 1
+			if scanned > total {
+				// The chain grew while rescanning.
+				total = scanned
 			}
-		}
-		select {
-		case <-ctx.Done():
-			for _, response := range lw.syncResponses {
-				response.OnRescan(totalHeight, PROGRESS)
-			}
-		default:
-			for _, response := range lw.syncResponses {
-				response.OnRescan(totalHeight, FINISH)
+			percentage := int32(int64(scanned) * 100 / int64(total))
+			if !onProgress(&p, scanned, total, percentage) {
+				cancel()
 			}
 		}
+		onEnd(scannedThrough, ctx.Err() != nil, nil)
 	}()
 
 	return nil
@@ -681,57 +966,12 @@ func (lw *LibWallet) TransactionNotification(listener TransactionListener) {
 		defer n.Done()
 		for {
 			v := <-n.C
-			for _, transaction := range v.UnminedTransactions {
-				var amount int64
-				var inputAmounts int64
-				var outputAmounts int64
-				tempCredits := make([]TransactionCredit, len(transaction.MyOutputs))
-				for index, credit := range transaction.MyOutputs {
-					outputAmounts += int64(credit.Amount)
-					tempCredits[index] = TransactionCredit{
-						Index:    int32(credit.Index),
-						Account:  int32(credit.Account),
-						Internal: credit.Internal,
-						Amount:   int64(credit.Amount),
-						Address:  credit.Address.String()}
-				}
-				tempDebits := make([]TransactionDebit, len(transaction.MyInputs))
-				for index, debit := range transaction.MyInputs {
-					inputAmounts += int64(debit.PreviousAmount)
-					tempDebits[index] = TransactionDebit{
-						Index:           int32(debit.Index),
-						PreviousAccount: int32(debit.PreviousAccount),
-						PreviousAmount:  int64(debit.PreviousAmount),
-						AccountName:     lw.AccountName(int32(debit.PreviousAccount))}
-				}
-				var direction int32
-				amountDifference := outputAmounts - inputAmounts
-				if amountDifference < 0 && (float64(transaction.Fee) == math.Abs(float64(amountDifference))) {
-					//Transfered
-					direction = 2
-					amount = int64(transaction.Fee)
-				} else if amountDifference > 0 {
-					//Received
-					direction = 1
-					amount = outputAmounts
-				} else {
-					//Sent
-					direction = 0
-					amount = inputAmounts
-					amount -= outputAmounts
-					amount -= int64(transaction.Fee)
+			for i := range v.UnminedTransactions {
+				tempTransaction, err := lw.transactionFromSummary(&v.UnminedTransactions[i], -1)
+				if err != nil {
+					log.Error(err)
+					continue
 				}
-				tempTransaction := Transaction{
-					Fee:       int64(transaction.Fee),
-					Hash:      fmt.Sprintf("%02x", reverse(transaction.Hash[:])),
-					Raw:       fmt.Sprintf("%02x", transaction.Transaction[:]),
-					Timestamp: transaction.Timestamp,
-					Type:      transactionType(transaction.Type),
-					Credits:   &tempCredits,
-					Amount:    amount,
-					Height:    -1,
-					Direction: direction,
-					Debits:    &tempDebits}
 				fmt.Println("New Transaction")
 				result, err := json.Marshal(tempTransaction)
 				if err != nil {
@@ -750,63 +990,36 @@ func (lw *LibWallet) TransactionNotification(listener TransactionListener) {
 	}()
 }
 
+// GetTransaction returns the JSON encoded Transaction of a wallet
+// transaction.
 func (lw *LibWallet) GetTransaction(txHash []byte) (string, error) {
+	transaction, err := lw.TransactionByHash(txHash)
+	if err != nil {
+		return "", translateError(err)
+	}
+	result, err := json.Marshal(transaction)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+// TransactionByHash returns a wallet transaction.
+func (lw *LibWallet) TransactionByHash(txHash []byte) (*Transaction, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
 	hash, err := chainhash.NewHash(txHash)
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return nil, translateError(err)
 	}
 
 	txSummary, _, blockHash, err := lw.wallet.TransactionSummary(hash)
 	if err != nil {
 		log.Error(err)
-		return "", err
-	}
-
-	var inputTotal int64
-	var outputTotal int64
-	var amount int64
-
-	credits := make([]TransactionCredit, len(txSummary.MyOutputs))
-	for index, credit := range txSummary.MyOutputs {
-		outputTotal += int64(credit.Amount)
-		credits[index] = TransactionCredit{
-			Index:    int32(credit.Index),
-			Account:  int32(credit.Account),
-			Internal: credit.Internal,
-			Amount:   int64(credit.Amount),
-			Address:  credit.Address.String()}
-	}
-
-	debits := make([]TransactionDebit, len(txSummary.MyInputs))
-	for index, debit := range txSummary.MyInputs {
-		inputTotal += int64(debit.PreviousAmount)
-		debits[index] = TransactionDebit{
-			Index:           int32(debit.Index),
-			PreviousAccount: int32(debit.PreviousAccount),
-			PreviousAmount:  int64(debit.PreviousAmount),
-			AccountName:     lw.AccountName(int32(debit.PreviousAccount))}
-	}
-
-	var direction int32
-	if txSummary.Type == wallet.TransactionTypeRegular {
-		amountDifference := outputTotal - inputTotal
-		if amountDifference < 0 && (float64(txSummary.Fee) == math.Abs(float64(amountDifference))) {
-			//Transfered
-			direction = 2
-			amount = int64(txSummary.Fee)
-		} else if amountDifference > 0 {
-			//Received
-			direction = 1
-			amount = outputTotal
-		} else {
-			//Sent
-			direction = 0
-			amount = inputTotal
-			amount -= outputTotal
-
-			amount -= int64(txSummary.Fee)
-		}
+		return nil, translateError(err)
 	}
 
 	var height int32 = -1
@@ -820,97 +1033,56 @@ func (lw *LibWallet) GetTransaction(txHash []byte) (string, error) {
 		}
 	}
 
-	transaction := Transaction{
-		Fee:       int64(txSummary.Fee),
-		Hash:      fmt.Sprintf("%02x", reverse(txSummary.Hash[:])),
-		Raw:       fmt.Sprintf("%02x", txSummary.Transaction[:]),
-		Timestamp: txSummary.Timestamp,
-		Type:      transactionType(txSummary.Type),
-		Credits:   &credits,
-		Amount:    amount,
-		Height:    height,
-		Direction: direction,
-		Debits:    &debits}
-
-	result, err := json.Marshal(transaction)
-
+	transaction, err := lw.transactionFromSummary(txSummary, height)
 	if err != nil {
-		return "", err
+		log.Error(err)
+		return nil, translateError(err)
 	}
-
-	return string(result), nil
+	return transaction, nil
 }
 
+// GetTransactions passes the JSON encoded transactions of the wallet to
+// response.  If they cannot be listed, ErrorOccurred is set and the error is
+// also returned.
 func (lw *LibWallet) GetTransactions(response GetTransactionsResponse) error {
+	onError := func(err error) error {
+		log.Error(err)
+		err = translateError(err)
+		result, _ := json.Marshal(getTransactionsResponse{ErrorOccurred: true, ErrorMessage: err.(*WalletError).Message})
+		response.OnResult(string(result))
+		return err
+	}
+	list, err := lw.GetTransactionList()
+	if err != nil {
+		return onError(err)
+	}
+	result, err := json.Marshal(getTransactionsResponse{ErrorOccurred: false, Transactions: list.transactions})
+	if err != nil {
+		return onError(err)
+	}
+	response.OnResult(string(result))
+	return nil
+}
+
+// GetTransactionList returns the transactions of the wallet, oldest first.
+func (lw *LibWallet) GetTransactionList() (*TransactionList, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
 	ctx := contextWithShutdownCancel(context.Background())
 	var startBlock, endBlock *wallet.BlockIdentifier
 	transactions := make([]Transaction, 0)
 	rangeFn := func(block *wallet.Block) (bool, error) {
-		for _, transaction := range block.Transactions {
-			var inputAmounts int64
-			var outputAmounts int64
-			var amount int64
-			tempCredits := make([]TransactionCredit, len(transaction.MyOutputs))
-			for index, credit := range transaction.MyOutputs {
-				outputAmounts += int64(credit.Amount)
-				tempCredits[index] = TransactionCredit{
-					Index:    int32(credit.Index),
-					Account:  int32(credit.Account),
-					Internal: credit.Internal,
-					Amount:   int64(credit.Amount),
-					Address:  credit.Address.String()}
-			}
-			tempDebits := make([]TransactionDebit, len(transaction.MyInputs))
-			for index, debit := range transaction.MyInputs {
-				inputAmounts += int64(debit.PreviousAmount)
-				tempDebits[index] = TransactionDebit{
-					Index:           int32(debit.Index),
-					PreviousAccount: int32(debit.PreviousAccount),
-					PreviousAmount:  int64(debit.PreviousAmount),
-					AccountName:     lw.AccountName(int32(debit.PreviousAccount))}
-			}
-
-			var direction int32
-			if transaction.Type == wallet.TransactionTypeRegular {
-				amountDifference := outputAmounts - inputAmounts
-				if amountDifference < 0 && (float64(transaction.Fee) == math.Abs(float64(amountDifference))) {
-					//Transfered
-					direction = 2
-					amount = int64(transaction.Fee)
-				} else if amountDifference > 0 {
-					//Received
-					direction = 1
-					for _, credit := range transaction.MyOutputs {
-						amount += int64(credit.Amount)
-					}
-				} else {
-					//Sent
-					direction = 0
-					for _, debit := range transaction.MyInputs {
-						amount += int64(debit.PreviousAmount)
-					}
-					for _, credit := range transaction.MyOutputs {
-						amount -= int64(credit.Amount)
-					}
-					amount -= int64(transaction.Fee)
-				}
-			}
-			var height int32 = -1
-			if block.Header != nil {
-				height = int32(block.Header.Height)
+		var height int32 = -1
+		if block.Header != nil {
+			height = int32(block.Header.Height)
+		}
+		for i := range block.Transactions {
+			tempTransaction, err := lw.transactionFromSummary(&block.Transactions[i], height)
+			if err != nil {
+				return true, err
 			}
-			tempTransaction := Transaction{
-				Fee:       int64(transaction.Fee),
-				Hash:      fmt.Sprintf("%02x", reverse(transaction.Hash[:])),
-				Raw:       fmt.Sprintf("%02x", transaction.Transaction[:]),
-				Timestamp: transaction.Timestamp,
-				Type:      transactionType(transaction.Type),
-				Credits:   &tempCredits,
-				Amount:    amount,
-				Height:    height,
-				Direction: direction,
-				Debits:    &tempDebits}
-			transactions = append(transactions, tempTransaction)
+			transactions = append(transactions, *tempTransaction)
 		}
 		select {
 		case <-ctx.Done():
@@ -920,28 +1092,48 @@ func (lw *LibWallet) GetTransactions(response GetTransactionsResponse) error {
 		}
 	}
 	err := lw.wallet.GetTransactions(rangeFn, startBlock, endBlock)
-	result, _ := json.Marshal(getTransactionsResponse{ErrorOccurred: false, Transactions: transactions})
-	response.OnResult(string(result))
-	return err
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &TransactionList{transactions: transactions}, nil
 }
 
+// DecodeTransaction returns the JSON encoded DecodedTransaction of a wallet
+// transaction.
 func (lw *LibWallet) DecodeTransaction(txHash []byte) (string, error) {
+	tx, err := lw.DecodeTransactionByHash(txHash)
+	if err != nil {
+		return "", translateError(err)
+	}
+	result, err := json.Marshal(tx)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+// DecodeTransactionByHash decodes a wallet transaction.
+func (lw *LibWallet) DecodeTransactionByHash(txHash []byte) (*DecodedTransaction, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
 	hash, err := chainhash.NewHash(txHash)
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return nil, translateError(err)
 	}
 	txSummary, _, _, err := lw.wallet.TransactionSummary(hash)
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return nil, translateError(err)
 	}
 	serializedTx := txSummary.Transaction
 	var mtx wire.MsgTx
 	err = mtx.Deserialize(bytes.NewReader(serializedTx))
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return nil, translateError(err)
 	}
 
 	var ssGenVersion uint32
@@ -965,8 +1157,7 @@ func (lw *LibWallet) DecodeTransaction(txHash []byte) (string, error) {
 		LastBlockValid: lastBlockValid,
 		VoteBits:       votebits,
 	}
-	result, _ := json.Marshal(tx)
-	return string(result), nil
+	return &tx, nil
 }
 
 func decodeTxInputs(mtx *wire.MsgTx) []DecodedInput {
@@ -1064,7 +1255,7 @@ func (lw *LibWallet) SpendableForAccount(account int32, requiredConfirmations in
 	bals, err := lw.wallet.CalculateAccountBalance(uint32(account), requiredConfirmations)
 	if err != nil {
 		log.Error(err)
-		return 0, err
+		return 0, translateError(err)
 	}
 	return int64(bals.Spendable), nil
 }
@@ -1086,12 +1277,12 @@ func makeTxChangeSource(destAddr string) (*txChangeSource, error) {
 	addr, err := dcrutil.DecodeAddress(destAddr)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, newWalletError(ErrInvalidAddress)
 	}
 	pkScript, err := txscript.PayToAddrScript(addr)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, newWalletError(ErrInvalidAddress)
 	}
 	changeSource := &txChangeSource{
 		script:  pkScript,
@@ -1105,12 +1296,12 @@ func (lw *LibWallet) ConstructTransaction(destAddr string, amount int64, srcAcco
 	addr, err := dcrutil.DecodeAddress(destAddr)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, newWalletError(ErrInvalidAddress)
 	}
 	pkScript, err := txscript.PayToAddrScript(addr)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, newWalletError(ErrInvalidAddress)
 	}
 	version := txscript.DefaultScriptVersion
 
@@ -1130,7 +1321,7 @@ func (lw *LibWallet) ConstructTransaction(destAddr string, amount int64, srcAcco
 		changeSource, err = makeTxChangeSource(destAddr)
 		if err != nil {
 			log.Error(err)
-			return nil, err
+			return nil, translateError(err)
 		}
 	}
 	feePerKb := txrules.DefaultRelayFeePerKb
@@ -1152,7 +1343,7 @@ func (lw *LibWallet) ConstructTransaction(destAddr string, amount int64, srcAcco
 	err = tx.Tx.Serialize(&txBuf)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	var totalOutput dcrutil.Amount
@@ -1170,26 +1361,41 @@ func (lw *LibWallet) ConstructTransaction(destAddr string, amount int64, srcAcco
 }
 
 func (lw *LibWallet) SendTransaction(privPass []byte, destAddr string, amount int64, srcAccount int32, requiredConfs int32, sendAll bool) ([]byte, error) {
-	n, err := lw.wallet.NetworkBackend()
+	// output destination
+	addr, err := dcrutil.DecodeAddress(destAddr)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		for i := range privPass {
+			privPass[i] = 0
+		}
+		return nil, newWalletError(ErrInvalidAddress)
 	}
+	txHash, _, err := lw.sendToAddress(privPass, addr, amount, srcAccount, requiredConfs, sendAll, nil)
+	return txHash, translateError(err)
+}
+
+// sendToAddress pays amount, or every spendable output if sendAll is set, from
+// srcAccount to addr.  It returns the hash of the published transaction and the
+// amount paid to addr.  beforePublish, if not nil, is called with the signed
+// transaction before it is published.  privPass is cleared.
+func (lw *LibWallet) sendToAddress(privPass []byte, addr dcrutil.Address, amount int64, srcAccount int32,
+	requiredConfs int32, sendAll bool, beforePublish func(tx *wire.MsgTx) error) ([]byte, int64, error) {
+
 	defer func() {
 		for i := range privPass {
 			privPass[i] = 0
 		}
 	}()
-	// output destination
-	addr, err := dcrutil.DecodeAddress(destAddr)
+	n, err := lw.wallet.NetworkBackend()
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, 0, err
 	}
+	destAddr := addr.EncodeAddress()
 	pkScript, err := txscript.PayToAddrScript(addr)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, 0, err
 	}
 
 	// pay output
@@ -1208,7 +1414,7 @@ func (lw *LibWallet) SendTransaction(privPass []byte, destAddr string, amount in
 		changeSource, err = makeTxChangeSource(destAddr)
 		if err != nil {
 			log.Error(err)
-			return nil, err
+			return nil, 0, err
 		}
 	}
 
@@ -1217,7 +1423,7 @@ func (lw *LibWallet) SendTransaction(privPass []byte, destAddr string, amount in
 		requiredConfs, algo, changeSource)
 	if err != nil {
 		log.Error(err)
-		return nil, translateError(err)
+		return nil, 0, translateError(err)
 	}
 
 	if unsignedTx.ChangeIndex >= 0 {
@@ -1229,7 +1435,7 @@ func (lw *LibWallet) SendTransaction(privPass []byte, destAddr string, amount in
 	err = unsignedTx.Tx.Serialize(&txBuf)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, 0, err
 	}
 
 	var tx wire.MsgTx
@@ -1237,7 +1443,7 @@ func (lw *LibWallet) SendTransaction(privPass []byte, destAddr string, amount in
 	if err != nil {
 		log.Error(err)
 		//Bytes do not represent a valid raw transaction
-		return nil, err
+		return nil, 0, err
 	}
 
 	lock := make(chan time.Time, 1)
@@ -1248,7 +1454,7 @@ func (lw *LibWallet) SendTransaction(privPass []byte, destAddr string, amount in
 	err = lw.wallet.Unlock(privPass, lock)
 	if err != nil {
 		log.Error(err)
-		return nil, errors.New(ErrInvalidPassphrase)
+		return nil, 0, newWalletError(ErrInvalidPassphrase)
 	}
 
 	var additionalPkScripts map[wire.OutPoint][]byte
@@ -1256,7 +1462,7 @@ func (lw *LibWallet) SendTransaction(privPass []byte, destAddr string, amount in
 	invalidSigs, err := lw.wallet.SignTransaction(&tx, txscript.SigHashAll, additionalPkScripts, nil, nil)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, 0, err
 	}
 
 	invalidInputIndexes := make([]uint32, len(invalidSigs))
@@ -1269,7 +1475,7 @@ func (lw *LibWallet) SendTransaction(privPass []byte, destAddr string, amount in
 	err = tx.Serialize(&serializedTransaction)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, 0, err
 	}
 
 	var msgTx wire.MsgTx
@@ -1277,36 +1483,107 @@ func (lw *LibWallet) SendTransaction(privPass []byte, destAddr string, amount in
 	if err != nil {
 		//Invalid tx
 		log.Error(err)
-		return nil, err
+		return nil, 0, err
+	}
+
+	if beforePublish != nil {
+		if err := beforePublish(&msgTx); err != nil {
+			log.Error(err)
+			return nil, 0, translateError(err)
+		}
 	}
 
 	txHash, err := lw.wallet.PublishTransaction(&msgTx, serializedTransaction.Bytes(), n)
 	if err != nil {
-		return nil, translateError(err)
+		return nil, 0, translateError(err)
 	}
-	return txHash[:], nil
+
+	var sent int64
+	for _, out := range msgTx.TxOut {
+		if bytes.Equal(out.PkScript, pkScript) {
+			sent += out.Value
+		}
+	}
+	return txHash[:], sent, nil
 }
 
 func (lw *LibWallet) PublishUnminedTransactions() error {
 	netBackend, err := lw.wallet.NetworkBackend()
 	if err != nil {
-		return errors.New(ErrNotConnected)
+		return newWalletError(ErrNotConnected)
 	}
 	err = lw.wallet.PublishUnminedTransactions(contextWithShutdownCancel(context.Background()), netBackend)
-	return err
+	return translateError(err)
 }
 
+// GetAccounts returns the JSON encoded Accounts of the wallet, excluding
+// accounts hidden with HideAccount.
 func (lw *LibWallet) GetAccounts(requiredConfirmations int32) (string, error) {
+	return lw.accountsJSON(requiredConfirmations, false)
+}
+
+// GetHiddenAccounts returns the JSON encoded Accounts of the accounts hidden
+// with HideAccount.
+func (lw *LibWallet) GetHiddenAccounts(requiredConfirmations int32) (string, error) {
+	return lw.accountsJSON(requiredConfirmations, true)
+}
+
+// GetAccountList returns the accounts of the wallet, excluding accounts hidden
+// with HideAccount.
+func (lw *LibWallet) GetAccountList(requiredConfirmations int32) (*AccountList, error) {
+	return lw.accounts(requiredConfirmations, false)
+}
+
+// GetHiddenAccountList returns the accounts hidden with HideAccount.
+func (lw *LibWallet) GetHiddenAccountList(requiredConfirmations int32) (*AccountList, error) {
+	return lw.accounts(requiredConfirmations, true)
+}
+
+// accountsJSON returns the JSON encoded Accounts of the AccountList returned
+// by accounts, for GetAccounts and GetHiddenAccounts.
+func (lw *LibWallet) accountsJSON(requiredConfirmations int32, hidden bool) (string, error) {
+	list, err := lw.accounts(requiredConfirmations, hidden)
+	if err != nil {
+		return "", translateError(err)
+	}
+	accountsResponse := &Accounts{
+		Count:              len(list.accounts),
+		CurrentBlockHash:   list.CurrentBlockHash,
+		CurrentBlockHeight: list.CurrentBlockHeight,
+		Acc:                &list.accounts,
+		ErrorOccurred:      false,
+	}
+	result, err := json.Marshal(accountsResponse)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+// accounts returns the AccountList of either the hidden or the visible
+// accounts of the wallet.
+func (lw *LibWallet) accounts(requiredConfirmations int32, hidden bool) (*AccountList, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
 	resp, err := lw.wallet.Accounts()
 	if err != nil {
-		return "", err
+		return nil, translateError(err)
 	}
-	accounts := make([]Account, len(resp.Accounts))
+	accounts := make([]Account, 0, len(resp.Accounts))
 	for i := range resp.Accounts {
 		a := &resp.Accounts[i]
+		isHidden, err := lw.accountHidden(a.AccountNumber)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		if isHidden != hidden {
+			continue
+		}
 		bals, err := lw.wallet.CalculateAccountBalance(a.AccountNumber, requiredConfirmations)
 		if err != nil {
-			return "", err
+			return nil, translateError(err)
 		}
 		balance := Balance{
 			Total:                   int64(bals.Total),
@@ -1317,25 +1594,26 @@ func (lw *LibWallet) GetAccounts(requiredConfirmations int32) (string, error) {
 			VotingAuthority:         int64(bals.VotingAuthority),
 			UnConfirmed:             int64(bals.Unconfirmed),
 		}
-		accounts[i] = Account{
+		externalKeyCount, internalKeyCount, err := lw.accountKeyCounts(a.AccountNumber)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		accounts = append(accounts, Account{
 			Number:           int32(a.AccountNumber),
 			Name:             a.AccountName,
 			TotalBalance:     int64(a.TotalBalance),
 			Balance:          &balance,
-			ExternalKeyCount: int32(a.LastUsedExternalIndex + 20),
-			InternalKeyCount: int32(a.LastUsedInternalIndex + 20),
+			ExternalKeyCount: externalKeyCount,
+			InternalKeyCount: internalKeyCount,
 			ImportedKeyCount: int32(a.ImportedKeyCount),
-		}
+			Hidden:           isHidden,
+		})
 	}
-	accountsResponse := &Accounts{
-		Count:              len(resp.Accounts),
+	return &AccountList{
 		CurrentBlockHash:   resp.CurrentBlockHash[:],
 		CurrentBlockHeight: resp.CurrentBlockHeight,
-		Acc:                &accounts,
-		ErrorOccurred:      false,
-	}
-	result, _ := json.Marshal(accountsResponse)
-	return string(result), nil
+		accounts:           accounts,
+	}, nil
 }
 
 func (lw *LibWallet) NextAccount(accountName string, privPass []byte) error {
@@ -1349,61 +1627,89 @@ func (lw *LibWallet) NextAccount(accountName string, privPass []byte) error {
 	err := lw.wallet.Unlock(privPass, lock)
 	if err != nil {
 		log.Error(err)
-		return errors.New(ErrInvalidPassphrase)
+		return newWalletError(ErrInvalidPassphrase)
 	}
 
 	_, err = lw.wallet.NextAccount(accountName)
 	if err != nil {
 		log.Error(err)
-		return err
+		return translateError(err)
 	}
 	return nil
 }
 
 func (lw *LibWallet) RenameAccount(accountNumber int32, newName string) error {
 	err := lw.wallet.RenameAccount(uint32(accountNumber), newName)
-	return err
+	return translateError(err)
 }
 
-func (lw *LibWallet) HaveAddress(address string) bool {
+// HaveAddress returns whether an address belongs to the wallet.
+func (lw *LibWallet) HaveAddress(address string) (bool, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return false, newWalletError(ErrWalletNotLoaded)
+	}
 	addr, err := decodeAddress(address, lw.wallet.ChainParams())
 	if err != nil {
 		log.Error(err)
-		return false
+		return false, newWalletError(ErrInvalidAddress)
 	}
 	have, err := lw.wallet.HaveAddress(addr)
 	if err != nil {
-		return false
+		log.Error(err)
+		return false, translateError(err)
 	}
-
-	return have
+	return have, nil
 }
 
-func (lw *LibWallet) IsAddressValid(address string) bool {
+// IsAddressValid returns whether an address is valid for the active network.
+func (lw *LibWallet) IsAddressValid(address string) (bool, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return false, newWalletError(ErrWalletNotLoaded)
+	}
 	_, err := decodeAddress(address, lw.wallet.ChainParams())
+	return err == nil, nil
+}
+
+// AccountName returns the name of an account.
+func (lw *LibWallet) AccountName(account int32) (string, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return "", newWalletError(ErrWalletNotLoaded)
+	}
+	name, err := lw.wallet.AccountName(uint32(account))
 	if err != nil {
 		log.Error(err)
-		return false
+		return "", translateError(err)
 	}
-	return true
+	return name, nil
 }
 
-func (lw *LibWallet) AccountName(account int32) string {
+// accountName returns the name of an account for display, or an empty string
+// if it cannot be looked up.
+func (lw *LibWallet) accountName(account int32) string {
 	name, err := lw.wallet.AccountName(uint32(account))
 	if err != nil {
 		log.Error(err)
-		return "Account not found"
+		return ""
 	}
 	return name
 }
 
-func (lw *LibWallet) AccountOfAddress(address string) string {
-	addr, err := dcrutil.DecodeAddress(address)
+// AccountOfAddress returns the name of the account of an address of the
+// wallet.  It fails with ErrNotExist if the wallet does not own the address.
+func (lw *LibWallet) AccountOfAddress(address string) (string, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return "", newWalletError(ErrWalletNotLoaded)
+	}
+	addr, err := decodeAddress(address, lw.wallet.ChainParams())
 	if err != nil {
 		log.Error(err)
-		return "Address decode error"
+		return "", newWalletError(ErrInvalidAddress)
+	}
+	info, err := lw.wallet.AddressInfo(addr)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
 	}
-	info, _ := lw.wallet.AddressInfo(addr)
 	return lw.AccountName(int32(info.Account()))
 }
 
@@ -1411,7 +1717,7 @@ func (lw *LibWallet) CurrentAddress(account int32) (string, error) {
 	addr, err := lw.wallet.CurrentAddress(uint32(account))
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return "", translateError(err)
 	}
 	return addr.EncodeAddress(), nil
 }
@@ -1423,7 +1729,7 @@ func (lw *LibWallet) NextAddress(account int32) (string, error) {
 	addr, err := lw.wallet.NewExternalAddress(uint32(account), callOpts...)
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return "", translateError(err)
 	}
 	return addr.EncodeAddress(), nil
 }
@@ -1448,10 +1754,10 @@ func (lw *LibWallet) SignMessage(passphrase []byte, address string, message stri
 	case *dcrutil.AddressSecpPubKey:
 	case *dcrutil.AddressPubKeyHash:
 		if a.DSA(a.Net()) != dcrec.STEcdsaSecp256k1 {
-			return nil, errors.New(ErrInvalidAddress)
+			return nil, newWalletError(ErrInvalidAddress)
 		}
 	default:
-		return nil, errors.New(ErrInvalidAddress)
+		return nil, newWalletError(ErrInvalidAddress)
 	}
 
 	sig, err = lw.wallet.SignMessage(message, addr)
@@ -1472,7 +1778,7 @@ func (lw *LibWallet) VerifyMessage(address string, message string, signatureBase
 
 	signature, err := DecodeBase64(signatureBase64)
 	if err != nil {
-		return false, err
+		return false, translateError(err)
 	}
 
 	// Addresses must have an associated secp256k1 private key and therefore
@@ -1481,10 +1787,10 @@ func (lw *LibWallet) VerifyMessage(address string, message string, signatureBase
 	case *dcrutil.AddressSecpPubKey:
 	case *dcrutil.AddressPubKeyHash:
 		if a.DSA(a.Net()) != dcrec.STEcdsaSecp256k1 {
-			return false, errors.New(ErrInvalidAddress)
+			return false, newWalletError(ErrInvalidAddress)
 		}
 	default:
-		return false, errors.New(ErrInvalidAddress)
+		return false, newWalletError(ErrInvalidAddress)
 	}
 
 	valid, err = wallet.VerifyMessage(message, addr, signature)
@@ -1515,13 +1821,13 @@ func (lw *LibWallet) CallJSONRPC(method string, args string, address string, use
 		if jerr, ok := err.(dcrjson.Error); ok {
 			log.Errorf("%s command: %v (code: %s)\n",
 				method, err, jerr.Code)
-			return "", err
+			return "", translateError(err)
 		}
 		// The error is not a dcrjson.Error and this really should not
 		// happen.  Nevertheless, fallback to just showing the error
 		// if it should happen due to a bug in the package.
 		log.Errorf("%s command: %v\n", method, err)
-		return "", err
+		return "", translateError(err)
 	}
 
 	// Marshal the command into a JSON-RPC byte slice in preparation for
@@ -1529,15 +1835,15 @@ func (lw *LibWallet) CallJSONRPC(method string, args string, address string, use
 	marshalledJSON, err := dcrjson.MarshalCmd("1.0", 1, cmd)
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return "", translateError(err)
 	}
 
 	// Send the JSON-RPC request to the server using the user-specified
 	// connection configuration.
-	result, err := sendPostRequest(marshalledJSON, address, username, password, caCert)
+	result, err := sendPostRequest(marshalledJSON, address, username, password, caCert, lw.currentProxy())
 	if err != nil {
 		log.Error(err)
-		return "", err
+		return "", translateError(err)
 	}
 
 	// Choose how to display the result based on its type.
@@ -1546,7 +1852,7 @@ func (lw *LibWallet) CallJSONRPC(method string, args string, address string, use
 		var dst bytes.Buffer
 		if err := json.Indent(&dst, result, "", "  "); err != nil {
 			log.Errorf("Failed to format result: %v", err)
-			return "", err
+			return "", translateError(err)
 		}
 		fmt.Println(dst.String())
 		return dst.String(), nil
@@ -1555,7 +1861,7 @@ func (lw *LibWallet) CallJSONRPC(method string, args string, address string, use
 		var str string
 		if err := json.Unmarshal(result, &str); err != nil {
 			log.Errorf("Failed to unmarshal result: %v", err)
-			return "", err
+			return "", translateError(err)
 		}
 		fmt.Println(str)
 		return str, nil
@@ -1580,22 +1886,6 @@ func AmountAtom(f float64) int64 {
 	return int64(amount)
 }
 
-func translateError(err error) error {
-	if err, ok := err.(*errors.Error); ok {
-		switch err.Kind {
-		case errors.InsufficientBalance:
-			return errors.New(ErrInsufficientBalance)
-		case errors.NotExist:
-			return errors.New(ErrNotExist)
-		case errors.Passphrase:
-			return errors.New(ErrInvalidPassphrase)
-		case errors.NoPeers:
-			return errors.New(ErrNoPeers)
-		}
-	}
-	return err
-}
-
 func EncodeHex(hexBytes []byte) string {
 	return hex.EncodeToString(hexBytes)
 }
@@ -1607,7 +1897,7 @@ func EncodeBase64(text []byte) string {
 func DecodeBase64(base64Text string) ([]byte, error) {
 	b, err := base64.StdEncoding.DecodeString(base64Text)
 	if err != nil {
-		return nil, err
+		return nil, newWalletError(ErrInvalid)
 	}
 
 	return b, nil
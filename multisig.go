@@ -0,0 +1,502 @@
+package mobilewallet
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainec"
+	"github.com/decred/dcrd/dcrec"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet"
+	"github.com/decred/dcrwallet/wallet/txrules"
+)
+
+// Multisig transactions are passed between co-signers hex encoded.  Each
+// co-signer adds their signatures with SignMultisigTransaction, or signs a copy
+// in parallel and has the copies combined with MergeMultisigTransactions.  The
+// transaction is published with PublishMultisigTransaction once every input
+// has enough signatures.
+
+// multisigVerifyFlags are the script flags that a complete multisig input must
+// verify with.
+const multisigVerifyFlags = txscript.ScriptVerifyCleanStack | txscript.ScriptVerifySigPushOnly
+
+// MultisigAddress is a P2SH address created by CreateMultisigAddress.  The
+// redeem script must be given to every co-signer, who import it with
+// ImportScript.
+type MultisigAddress struct {
+	Address      string
+	RedeemScript string
+	Required     int32
+	Keys         int32
+}
+
+// MultisigTransaction is a hex encoded multisig transaction.  Signatures is the
+// fewest signatures of any input, and Complete is set once every input has the
+// signatures it requires.
+type MultisigTransaction struct {
+	Transaction string
+	Signatures  int32
+	Required    int32
+	Complete    bool
+}
+
+// multisigInput holds the scripts redeemed by an input of a multisig
+// transaction.
+type multisigInput struct {
+	pkScript     []byte
+	redeemScript []byte
+	required     int
+}
+
+// AddressPublicKey returns the hex encoded public key of a P2PKH address of the
+// wallet, to be shared with co-signers of a multisig address.  The address
+// must be recorded by the wallet, as those returned by NextAddress are.
+func (lw *LibWallet) AddressPublicKey(address string) (string, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return "", newWalletError(ErrWalletNotLoaded)
+	}
+	addr, err := decodeAddress(address, lw.wallet.ChainParams())
+	if err != nil {
+		return "", newWalletError(ErrInvalidAddress)
+	}
+	pubKey, err := lw.wallet.PubKeyForAddress(addr)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return hex.EncodeToString(pubKey.SerializeCompressed()), nil
+}
+
+// CreateMultisigAddress creates a P2SH address that is spent with the
+// signatures of required of the comma separated keys, and imports its redeem
+// script into the wallet.  Each key is either a hex encoded secp256k1 public
+// key, such as one returned by AddressPublicKey, or a P2PKH address of this
+// wallet.  The JSON encoded MultisigAddress is returned.
+func (lw *LibWallet) CreateMultisigAddress(privPass []byte, required int32, keys string) (string, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return "", newWalletError(ErrWalletNotLoaded)
+	}
+	params := lw.wallet.ChainParams()
+	var addrs []dcrutil.Address
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if addr, err := decodeAddress(key, params); err == nil {
+			addrs = append(addrs, addr)
+			continue
+		}
+		pubKey, err := hex.DecodeString(key)
+		if err != nil {
+			return "", newWalletError(ErrInvalid)
+		}
+		addr, err := dcrutil.NewAddressSecpPubKey(pubKey, params)
+		if err != nil {
+			return "", newWalletError(ErrInvalid)
+		}
+		addrs = append(addrs, addr)
+	}
+	if required < 1 || int(required) > len(addrs) {
+		return "", newWalletError(ErrInvalid)
+	}
+
+	script, err := lw.wallet.MakeSecp256k1MultiSigScript(addrs, int(required))
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	var p2shAddr *dcrutil.AddressScriptHash
+	err = lw.withUnlockedWallet(privPass, func() error {
+		var err error
+		p2shAddr, err = lw.wallet.ImportP2SHRedeemScript(script)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	if n, err := lw.wallet.NetworkBackend(); err == nil {
+		ctx := contextWithShutdownCancel(context.Background())
+		err := n.LoadTxFilter(ctx, false, []dcrutil.Address{p2shAddr}, nil)
+		if err != nil {
+			log.Error(err)
+			return "", translateError(err)
+		}
+	}
+
+	multisigAddr := &MultisigAddress{
+		Address:      p2shAddr.EncodeAddress(),
+		RedeemScript: hex.EncodeToString(script),
+		Required:     required,
+		Keys:         int32(len(addrs)),
+	}
+	result, err := json.Marshal(multisigAddr)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+// CreateMultisigTransaction returns an unsigned, hex encoded transaction that
+// pays amount from the unspent outputs of a multisig address of the wallet to
+// destAddr, with change returned to the multisig address.  If sendAll is set,
+// every unspent output is spent and amount is ignored.
+func (lw *LibWallet) CreateMultisigTransaction(multisigAddress string, destAddr string, amount int64, sendAll bool) (string, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return "", newWalletError(ErrWalletNotLoaded)
+	}
+	params := lw.wallet.ChainParams()
+	addr, err := decodeAddress(multisigAddress, params)
+	if err != nil {
+		return "", newWalletError(ErrInvalidAddress)
+	}
+	p2shAddr, ok := addr.(*dcrutil.AddressScriptHash)
+	if !ok {
+		return "", newWalletError(ErrInvalidAddress)
+	}
+	dest, err := decodeAddress(destAddr, params)
+	if err != nil {
+		return "", newWalletError(ErrInvalidAddress)
+	}
+	destScript, err := txscript.PayToAddrScript(dest)
+	if err != nil {
+		return "", newWalletError(ErrInvalidAddress)
+	}
+	changeScript, err := txscript.PayToAddrScript(p2shAddr)
+	if err != nil {
+		return "", translateError(err)
+	}
+	if !sendAll && amount <= 0 {
+		return "", newWalletError(ErrInvalid)
+	}
+
+	credits, err := wallet.UnstableAPI(lw.wallet).UnspentMultisigCreditsForAddress(p2shAddr)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+
+	relayFee := lw.wallet.RelayFee()
+	tx := wire.NewMsgTx()
+	tx.AddTxOut(wire.NewTxOut(amount, destScript))
+	var total dcrutil.Amount
+	var fee dcrutil.Amount
+	for _, credit := range credits {
+		sigScriptSize := multisigSigScriptSize(int(credit.M), credit.MSScript)
+		tx.AddTxIn(wire.NewTxIn(credit.OutPoint, int64(credit.Amount), make([]byte, sigScriptSize)))
+		total += credit.Amount
+
+		if sendAll {
+			continue
+		}
+		// Estimate the fee of the transaction with a change output.
+		fee = txrules.FeeForSerializeSize(relayFee,
+			tx.SerializeSize()+wire.NewTxOut(0, changeScript).SerializeSize())
+		if total >= dcrutil.Amount(amount)+fee {
+			break
+		}
+	}
+
+	if sendAll {
+		fee = txrules.FeeForSerializeSize(relayFee, tx.SerializeSize())
+		tx.TxOut[0].Value = int64(total - fee)
+		if total-fee <= 0 || txrules.IsDustAmount(total-fee, len(destScript), relayFee) {
+			return "", newWalletError(ErrInsufficientBalance)
+		}
+	} else {
+		if len(tx.TxIn) == 0 || total < dcrutil.Amount(amount)+fee {
+			return "", newWalletError(ErrInsufficientBalance)
+		}
+		change := total - dcrutil.Amount(amount) - fee
+		if !txrules.IsDustAmount(change, len(changeScript), relayFee) {
+			tx.AddTxOut(wire.NewTxOut(int64(change), changeScript))
+		}
+	}
+
+	for _, in := range tx.TxIn {
+		in.SignatureScript = nil
+	}
+	return encodeTx(tx)
+}
+
+// SignMultisigTransaction adds this wallet's signatures to a multisig
+// transaction created by CreateMultisigTransaction, keeping any signatures of
+// other co-signers, and returns the JSON encoded MultisigTransaction.
+func (lw *LibWallet) SignMultisigTransaction(privPass []byte, txHex string) (string, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return "", newWalletError(ErrWalletNotLoaded)
+	}
+	tx, err := decodeTx(txHex)
+	if err != nil {
+		return "", translateError(err)
+	}
+	if _, err := lw.multisigInputs(tx); err != nil {
+		return "", translateError(err)
+	}
+
+	// Inputs lacking signatures are reported by multisigTransaction, so
+	// signature errors are not.
+	err = lw.withUnlockedWallet(privPass, func() error {
+		_, err := lw.wallet.SignTransaction(tx, txscript.SigHashAll, nil, nil, nil)
+		return err
+	})
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return lw.multisigTransaction(tx)
+}
+
+// MergeMultisigTransactions combines the signatures of two copies of a
+// multisig transaction that were signed by different co-signers, and returns
+// the JSON encoded MultisigTransaction.
+func (lw *LibWallet) MergeMultisigTransactions(txHex string, otherTxHex string) (string, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return "", newWalletError(ErrWalletNotLoaded)
+	}
+	tx, err := decodeTx(txHex)
+	if err != nil {
+		return "", translateError(err)
+	}
+	other, err := decodeTx(otherTxHex)
+	if err != nil {
+		return "", translateError(err)
+	}
+	if tx.TxHash() != other.TxHash() {
+		// The transactions spend or pay differently.
+		return "", newWalletError(ErrInvalid)
+	}
+	inputs, err := lw.multisigInputs(tx)
+	if err != nil {
+		return "", translateError(err)
+	}
+
+	params := lw.wallet.ChainParams()
+	for i, in := range inputs {
+		sigScript, err := mergeMultisigSigScripts(params, tx, i, in,
+			tx.TxIn[i].SignatureScript, other.TxIn[i].SignatureScript)
+		if err != nil {
+			log.Error(err)
+			return "", translateError(err)
+		}
+		tx.TxIn[i].SignatureScript = sigScript
+	}
+	return lw.multisigTransaction(tx)
+}
+
+// PublishMultisigTransaction publishes a multisig transaction whose inputs all
+// have the signatures they require, and returns its hash.
+func (lw *LibWallet) PublishMultisigTransaction(txHex string) ([]byte, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
+	n, err := lw.wallet.NetworkBackend()
+	if err != nil {
+		return nil, newWalletError(ErrNotConnected)
+	}
+	tx, err := decodeTx(txHex)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	inputs, err := lw.multisigInputs(tx)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if _, complete := multisigStatus(tx, inputs); !complete {
+		return nil, newWalletError(ErrFailedPrecondition)
+	}
+
+	var serializedTx bytes.Buffer
+	serializedTx.Grow(tx.SerializeSize())
+	if err := tx.Serialize(&serializedTx); err != nil {
+		return nil, translateError(err)
+	}
+	txHash, err := lw.wallet.PublishTransaction(tx, serializedTx.Bytes(), n)
+	if err != nil {
+		log.Error(err)
+		return nil, translateError(err)
+	}
+	return txHash[:], nil
+}
+
+// multisigInputs looks up the scripts of each input of tx, which must all spend
+// outputs of multisig addresses whose redeem scripts the wallet holds.
+func (lw *LibWallet) multisigInputs(tx *wire.MsgTx) ([]*multisigInput, error) {
+	if len(tx.TxIn) == 0 {
+		return nil, newWalletError(ErrInvalid)
+	}
+	params := lw.wallet.ChainParams()
+	inputs := make([]*multisigInput, len(tx.TxIn))
+	for i, in := range tx.TxIn {
+		prevOut := &in.PreviousOutPoint
+		details, err := wallet.UnstableAPI(lw.wallet).TxDetails(&prevOut.Hash)
+		if err != nil {
+			log.Error(err)
+			return nil, translateError(err)
+		}
+		if int(prevOut.Index) >= len(details.MsgTx.TxOut) {
+			return nil, newWalletError(ErrInvalid)
+		}
+		pkScript := details.MsgTx.TxOut[prevOut.Index].PkScript
+		class, addrs, _, err := txscript.ExtractPkScriptAddrs(txscript.DefaultScriptVersion,
+			pkScript, params)
+		if err != nil || class != txscript.ScriptHashTy || len(addrs) != 1 {
+			return nil, newWalletError(ErrInvalid)
+		}
+		redeemScript, err := lw.wallet.RedeemScriptCopy(addrs[0])
+		if err != nil {
+			log.Error(err)
+			return nil, translateError(err)
+		}
+		required, _, err := txscript.CalcMultiSigStats(redeemScript)
+		if err != nil {
+			return nil, newWalletError(ErrInvalid)
+		}
+		inputs[i] = &multisigInput{
+			pkScript:     pkScript,
+			redeemScript: redeemScript,
+			required:     required,
+		}
+	}
+	return inputs, nil
+}
+
+// multisigTransaction returns the JSON encoded MultisigTransaction of tx.
+func (lw *LibWallet) multisigTransaction(tx *wire.MsgTx) (string, error) {
+	inputs, err := lw.multisigInputs(tx)
+	if err != nil {
+		return "", translateError(err)
+	}
+	txHex, err := encodeTx(tx)
+	if err != nil {
+		return "", translateError(err)
+	}
+	signatures, complete := multisigStatus(tx, inputs)
+	required := 0
+	for _, in := range inputs {
+		if in.required > required {
+			required = in.required
+		}
+	}
+	multisigTx := &MultisigTransaction{
+		Transaction: txHex,
+		Signatures:  int32(signatures),
+		Required:    int32(required),
+		Complete:    complete,
+	}
+	result, err := json.Marshal(multisigTx)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+// mergeMultisigSigScripts returns a signature script for input i of tx, which
+// redeems in, holding the valid signatures of both sigScript and otherSigScript.
+func mergeMultisigSigScripts(params *chaincfg.Params, tx *wire.MsgTx, i int, in *multisigInput,
+	sigScript, otherSigScript []byte) ([]byte, error) {
+
+	noKeys := txscript.KeyClosure(func(dcrutil.Address) (chainec.PrivateKey, bool, error) {
+		return nil, false, errors.E(errors.NotExist, "no keys are used when merging")
+	})
+	getScript := txscript.ScriptClosure(func(dcrutil.Address) ([]byte, error) {
+		return in.redeemScript, nil
+	})
+
+	// Every signature of both copies is offered to the merge, which keeps
+	// the valid signatures in the order of the keys.
+	b := txscript.NewScriptBuilder()
+	for _, script := range [][]byte{sigScript, otherSigScript} {
+		for _, sig := range multisigSignatures(script) {
+			b.AddData(sig)
+		}
+	}
+	b.AddData(in.redeemScript)
+	combined, err := b.Script()
+	if err != nil {
+		return nil, errors.E(errors.Invalid, err)
+	}
+	return txscript.SignTxOutput(params, tx, i, in.pkScript, txscript.SigHashAll,
+		noKeys, getScript, combined, dcrec.STEcdsaSecp256k1)
+}
+
+// multisigStatus returns the fewest signatures of any input of tx and whether
+// every input verifies.
+func multisigStatus(tx *wire.MsgTx, inputs []*multisigInput) (signatures int, complete bool) {
+	complete = true
+	for i, in := range inputs {
+		n := len(multisigSignatures(tx.TxIn[i].SignatureScript))
+		if i == 0 || n < signatures {
+			signatures = n
+		}
+		vm, err := txscript.NewEngine(in.pkScript, tx, i, multisigVerifyFlags,
+			txscript.DefaultScriptVersion, nil)
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			complete = false
+		}
+	}
+	return signatures, complete
+}
+
+// multisigSignatures returns the signatures pushed by a P2SH multisig signature
+// script, which end with the redeem script.
+func multisigSignatures(sigScript []byte) [][]byte {
+	pushes, err := txscript.PushedData(sigScript)
+	if err != nil || len(pushes) == 0 {
+		return nil
+	}
+	var sigs [][]byte
+	for _, data := range pushes[:len(pushes)-1] {
+		if len(data) != 0 {
+			sigs = append(sigs, data)
+		}
+	}
+	return sigs
+}
+
+// multisigSigScriptSize returns the largest size of a signature script with
+// required signatures redeeming a P2SH output of redeemScript.
+func multisigSigScriptSize(required int, redeemScript []byte) int {
+	size := required * (1 + 73)
+	switch l := len(redeemScript); {
+	case l < txscript.OP_PUSHDATA1:
+		size += 1 + l
+	case l <= 0xff:
+		size += 2 + l
+	default:
+		size += 3 + l
+	}
+	return size
+}
+
+func decodeTx(txHex string) (*wire.MsgTx, error) {
+	b, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, newWalletError(ErrInvalid)
+	}
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, newWalletError(ErrInvalid)
+	}
+	return &tx, nil
+}
+
+func encodeTx(tx *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	buf.Grow(tx.SerializeSize())
+	if err := tx.Serialize(&buf); err != nil {
+		return "", translateError(err)
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
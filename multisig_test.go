@@ -0,0 +1,113 @@
+package mobilewallet
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainec"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrec"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/decred/dcrwallet/errors"
+)
+
+// signMultisigTestTx returns the signature script of the input of tx signed by
+// key only.
+func signMultisigTestTx(t *testing.T, params *chaincfg.Params, tx *wire.MsgTx, in *multisigInput,
+	key chainec.PrivateKey, addr dcrutil.Address) []byte {
+
+	getKey := txscript.KeyClosure(func(a dcrutil.Address) (chainec.PrivateKey, bool, error) {
+		if a.EncodeAddress() != addr.EncodeAddress() {
+			return nil, false, errors.E(errors.NotExist, "not the signing key")
+		}
+		return key, true, nil
+	})
+	getScript := txscript.ScriptClosure(func(dcrutil.Address) ([]byte, error) {
+		return in.redeemScript, nil
+	})
+	sigScript, err := txscript.SignTxOutput(params, tx, 0, in.pkScript, txscript.SigHashAll,
+		getKey, getScript, nil, dcrec.STEcdsaSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sigScript
+}
+
+func TestMergeMultisigSignatures(t *testing.T) {
+	params := &chaincfg.TestNet3Params
+
+	// A 2-of-3 multisig address.
+	var keys []chainec.PrivateKey
+	var addrs []*dcrutil.AddressSecpPubKey
+	for i := 0; i < 3; i++ {
+		priv, _, _, err := chainec.Secp256k1.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, pub := chainec.Secp256k1.PrivKeyFromBytes(priv)
+		addr, err := dcrutil.NewAddressSecpPubKey(pub.SerializeCompressed(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+		addrs = append(addrs, addr)
+	}
+	redeemScript, err := txscript.MultiSigScript(addrs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2shAddr, err := dcrutil.NewAddressScriptHash(redeemScript, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(p2shAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := &multisigInput{pkScript: pkScript, redeemScript: redeemScript, required: 2}
+	inputs := []*multisigInput{in}
+
+	tx := wire.NewMsgTx()
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0, wire.TxTreeRegular), 1e8, nil))
+	tx.AddTxOut(wire.NewTxOut(1e8-1e5, pkScript))
+
+	checkStatus := func(name string, sigScript []byte, wantSigs int, wantComplete bool) {
+		tx.TxIn[0].SignatureScript = sigScript
+		sigs, complete := multisigStatus(tx, inputs)
+		if sigs != wantSigs || complete != wantComplete {
+			t.Errorf("%s: %d signatures, complete: %v, want %d signatures, complete: %v",
+				name, sigs, complete, wantSigs, wantComplete)
+		}
+		if size := multisigSigScriptSize(in.required, redeemScript); len(sigScript) > size {
+			t.Errorf("%s: signature script is %d bytes, estimated %d", name, len(sigScript), size)
+		}
+	}
+
+	// Co-signers each sign their own copy of the unsigned transaction.
+	checkStatus("unsigned", nil, 0, false)
+	first := signMultisigTestTx(t, params, tx, in, keys[0], addrs[0])
+	checkStatus("first key", first, 1, false)
+	tx.TxIn[0].SignatureScript = nil
+	last := signMultisigTestTx(t, params, tx, in, keys[2], addrs[2])
+	checkStatus("last key", last, 1, false)
+
+	merge := func(sigScript, otherSigScript []byte) []byte {
+		merged, err := mergeMultisigSigScripts(params, tx, 0, in, sigScript, otherSigScript)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return merged
+	}
+	checkStatus("merged with itself", merge(first, first), 1, false)
+	checkStatus("merged with unsigned", merge(nil, last), 1, false)
+	merged := merge(first, last)
+	checkStatus("merged", merged, 2, true)
+	if sigs := multisigSignatures(merged); len(sigs) != 2 {
+		t.Fatalf("merged signature script has %d signatures", len(sigs))
+	}
+	checkStatus("merged in the other order", merge(last, first), 2, true)
+	checkStatus("merged again", merge(merged, first), 2, true)
+}
@@ -0,0 +1,159 @@
+package mobilewallet
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/btcsuite/go-socks/socks"
+	"github.com/decred/dcrd/connmgr"
+)
+
+const defaultProxyPort = "9050"
+
+// proxyConfig describes the SOCKS5 proxy that outbound connections are routed
+// through when one has been set with SetProxy.
+type proxyConfig struct {
+	host            string
+	username        string
+	password        string
+	streamIsolation bool
+}
+
+// dialer returns a SOCKS5 dialer for the proxy.  When stream isolation is
+// enabled every connection is made with random credentials so that Tor places
+// it on its own circuit.
+func (p *proxyConfig) dialer() *socks.Proxy {
+	return &socks.Proxy{
+		Addr:         p.host,
+		Username:     p.username,
+		Password:     p.password,
+		TorIsolation: p.streamIsolation,
+	}
+}
+
+// lookup resolves host through the proxy using the Tor RESOLVE extension so
+// that no DNS queries are made outside of the proxy.
+func (p *proxyConfig) lookup(host string) ([]net.IP, error) {
+	return connmgr.TorLookupIP(host, p.host)
+}
+
+// SetProxy routes SPV peer connections, dcrd RPC connections and JSON-RPC
+// calls through the SOCKS5 proxy at host.  If streamIsolation is true, random
+// credentials are used for each connection, which makes Tor use a separate
+// circuit per connection.  The proxy applies to connections started after
+// this call.  dcrd RPC connections reach the server through a loopback tunnel,
+// so its TLS certificate must be valid for 127.0.0.1, as the certificates that
+// dcrd generates are.
+func (lw *LibWallet) SetProxy(host, username, password string, streamIsolation bool) error {
+	host, err := NormalizeAddress(host, defaultProxyPort)
+	if err != nil {
+		return newWalletError(ErrInvalidAddress)
+	}
+
+	lw.mu.Lock()
+	lw.proxy = &proxyConfig{
+		host:            host,
+		username:        username,
+		password:        password,
+		streamIsolation: streamIsolation,
+	}
+	lw.mu.Unlock()
+	return nil
+}
+
+// ClearProxy removes a proxy set with SetProxy.  Connections started after
+// this call are made directly.
+func (lw *LibWallet) ClearProxy() {
+	lw.mu.Lock()
+	lw.proxy = nil
+	lw.mu.Unlock()
+}
+
+func (lw *LibWallet) currentProxy() *proxyConfig {
+	lw.mu.Lock()
+	p := lw.proxy
+	lw.mu.Unlock()
+	return p
+}
+
+// proxyTunnel listens on a loopback address and forwards each accepted
+// connection to a remote address through the proxy.  The SPV syncer and the
+// dcrd RPC client dial with dialers that cannot be replaced, so peers and RPC
+// servers are handed to them as tunnel addresses instead.  Names are resolved
+// by the proxy, never locally.
+type proxyTunnel struct {
+	listener net.Listener
+	remote   string
+	proxy    *socks.Proxy
+	wg       sync.WaitGroup
+}
+
+func newProxyTunnel(p *proxyConfig, remote string) (*proxyTunnel, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	t := &proxyTunnel{
+		listener: l,
+		remote:   remote,
+		proxy:    p.dialer(),
+	}
+	return t, nil
+}
+
+// Addr returns the loopback address the tunnel accepts connections on.
+func (t *proxyTunnel) Addr() string {
+	return t.listener.Addr().String()
+}
+
+// serve accepts and forwards connections until the context is cancelled.
+func (t *proxyTunnel) serve(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		t.listener.Close()
+	}()
+
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("Proxy tunnel to %v stopped: %v", t.remote, err)
+			}
+			break
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.forward(ctx, local)
+		}()
+	}
+	t.wg.Wait()
+}
+
+func (t *proxyTunnel) forward(ctx context.Context, local net.Conn) {
+	defer local.Close()
+
+	remote, err := t.proxy.Dial("tcp", t.remote)
+	if err != nil {
+		log.Errorf("Failed to connect to %v through proxy: %v", t.remote, err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,254 @@
+package mobilewallet
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// socksRequest records a CONNECT request received by testSocksServer.
+type socksRequest struct {
+	username string
+	target   string
+	domain   bool
+}
+
+// testSocksServer is a SOCKS5 stand-in that accepts any credentials, records
+// each CONNECT request and forwards the connection to its target.
+type testSocksServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	requests []socksRequest
+}
+
+func newTestSocksServer(t *testing.T) *testSocksServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSocksServer{listener: l}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *testSocksServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	read := func(n int) []byte {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil
+		}
+		return b
+	}
+
+	// Greeting: version, method count and methods.
+	hdr := read(2)
+	if hdr == nil || hdr[0] != 5 {
+		return
+	}
+	methods := read(int(hdr[1]))
+	method := byte(0)
+	for _, m := range methods {
+		if m == 2 {
+			method = 2
+		}
+	}
+	c.Write([]byte{5, method})
+
+	var req socksRequest
+	if method == 2 {
+		// Username and password subnegotiation.
+		ver := read(2)
+		if ver == nil {
+			return
+		}
+		req.username = string(read(int(ver[1])))
+		plen := read(1)
+		if plen == nil || read(int(plen[0])) == nil {
+			return
+		}
+		c.Write([]byte{1, 0})
+	}
+
+	// Request: version, command, reserved, address type, address, port.
+	cmd := read(4)
+	if cmd == nil || cmd[1] != 1 {
+		return
+	}
+	var host string
+	switch cmd[3] {
+	case 1:
+		host = net.IP(read(4)).String()
+	case 3:
+		n := read(1)
+		if n == nil {
+			return
+		}
+		host = string(read(int(n[0])))
+		req.domain = true
+	case 4:
+		host = net.IP(read(16)).String()
+	default:
+		return
+	}
+	port := read(2)
+	if port == nil {
+		return
+	}
+	req.target = net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	remote, err := net.Dial("tcp", req.target)
+	if err != nil {
+		c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer remote.Close()
+	c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(remote, r)
+	io.Copy(c, remote)
+}
+
+func (s *testSocksServer) received() []socksRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]socksRequest(nil), s.requests...)
+}
+
+// newEchoServer returns the port of a server echoing what it receives.
+func newEchoServer(t *testing.T) (net.Listener, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return l, port
+}
+
+func TestProxyTunnel(t *testing.T) {
+	socksServer := newTestSocksServer(t)
+	defer socksServer.listener.Close()
+	echo, port := newEchoServer(t)
+	defer echo.Close()
+
+	// The remote is given by name, which the proxy must resolve.
+	remote := net.JoinHostPort("localhost", port)
+	proxy := &proxyConfig{
+		host:            socksServer.listener.Addr().String(),
+		streamIsolation: true,
+	}
+	tunnel, err := newProxyTunnel(proxy, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	go func() {
+		tunnel.serve(ctx)
+		close(served)
+	}()
+
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", tunnel.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := []byte("ping " + strconv.Itoa(i))
+		if _, err := c.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		reply := make([]byte, len(msg))
+		if _, err := io.ReadFull(c, reply); err != nil {
+			t.Fatalf("reading through tunnel: %v", err)
+		}
+		if string(reply) != string(msg) {
+			t.Fatalf("tunnel returned %q, want %q", reply, msg)
+		}
+		c.Close()
+	}
+
+	requests := socksServer.received()
+	if len(requests) != 2 {
+		t.Fatalf("proxy received %d connections, want 2", len(requests))
+	}
+	for _, req := range requests {
+		if req.target != remote || !req.domain {
+			t.Errorf("proxy connected to %q (by name: %v), want %q by name", req.target, req.domain, remote)
+		}
+		if req.username == "" {
+			t.Errorf("connection was not isolated with random credentials")
+		}
+	}
+	if requests[0].username == requests[1].username {
+		t.Errorf("connections share the credentials %q", requests[0].username)
+	}
+
+	cancel()
+	<-served
+	if _, err := net.Dial("tcp", tunnel.Addr()); err == nil {
+		t.Errorf("tunnel accepts connections after it was stopped")
+	}
+}
+
+func TestRpcSyncThroughProxy(t *testing.T) {
+	socksServer := newTestSocksServer(t)
+	defer socksServer.listener.Close()
+
+	dir, err := ioutil.TempDir("", "proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lw := NewLibWallet(dir, "bdb", "testnet3")
+	lw.InitLoader()
+	if err := lw.SetProxy(socksServer.listener.Addr().String(), "", "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stand-in cannot reach the server, so the sync fails, but only
+	// after the connection was requested from the proxy.
+	const server = "dcrd.invalid:19109"
+	err = lw.RpcSync(server, "user", "pass", nil)
+	if walletErr, ok := err.(*WalletError); !ok || walletErr.Code != ErrUnavailable {
+		t.Fatalf("RpcSync returned %v, want %s", err, ErrUnavailable)
+	}
+	requests := socksServer.received()
+	if len(requests) == 0 {
+		t.Fatal("RPC connection was not made through the proxy")
+	}
+	for _, req := range requests {
+		if req.target != server || !req.domain {
+			t.Errorf("proxy connected to %q (by name: %v), want %q by name", req.target, req.domain, server)
+		}
+	}
+}
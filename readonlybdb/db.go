@@ -0,0 +1,223 @@
+// Copyright (c) 2014 The btcsuite developers
+// Copyright (c) 2015 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package readonlybdb
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet/walletdb"
+)
+
+// lockTimeout is how long opening a database waits for a process that has it
+// open for writing.
+const lockTimeout = time.Second
+
+// errReadOnly is returned for every attempt to write to the database.
+var errReadOnly = errors.E(errors.Invalid, "database is read-only")
+
+// convertErr wraps a driver-specific error with an error code.
+func convertErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	var kind errors.Kind
+	switch err {
+	case bolt.ErrInvalid: // Invalid database file, not invalid operation
+		kind = errors.IO
+	case bolt.ErrTimeout:
+		return errors.E(errors.IO, "database is in use by another process")
+	case bolt.ErrDatabaseNotOpen, bolt.ErrTxNotWritable, bolt.ErrTxClosed, bolt.ErrDatabaseReadOnly:
+		kind = errors.Invalid
+	case bolt.ErrBucketNameRequired, bolt.ErrKeyRequired, bolt.ErrKeyTooLarge, bolt.ErrValueTooLarge, bolt.ErrIncompatibleValue:
+		kind = errors.Invalid
+	case bolt.ErrBucketNotFound:
+		kind = errors.NotExist
+	case bolt.ErrBucketExists:
+		kind = errors.Exist
+	}
+	return errors.E(kind, err)
+}
+
+// transaction represents a read-only database transaction and implements the
+// walletdb.ReadTx interface.
+type transaction struct {
+	boltTx *bolt.Tx
+}
+
+func (tx *transaction) ReadBucket(key []byte) walletdb.ReadBucket {
+	boltBucket := tx.boltTx.Bucket(key)
+	if boltBucket == nil {
+		return nil
+	}
+	return (*bucket)(boltBucket)
+}
+
+// Rollback ends the transaction.
+//
+// This function is part of the walletdb.ReadTx interface implementation.
+func (tx *transaction) Rollback() error {
+	return convertErr(tx.boltTx.Rollback())
+}
+
+// bucket is an internal type used to represent a collection of key/value pairs
+// and implements the walletdb.ReadBucket interface.
+type bucket bolt.Bucket
+
+// Enforce bucket implements the walletdb.ReadBucket interface.
+var _ walletdb.ReadBucket = (*bucket)(nil)
+
+// NestedReadBucket retrieves a nested bucket with the given key.  Returns nil
+// if the bucket does not exist.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) NestedReadBucket(key []byte) walletdb.ReadBucket {
+	boltBucket := (*bolt.Bucket)(b).Bucket(key)
+	// Don't return a non-nil interface to a nil pointer.
+	if boltBucket == nil {
+		return nil
+	}
+	return (*bucket)(boltBucket)
+}
+
+// ForEach invokes the passed function with every key/value pair in the bucket.
+// This includes nested buckets, in which case the value is nil, but it does not
+// include the key/value pairs within those nested buckets.
+//
+// NOTE: The values returned by this function are only valid during a
+// transaction.  Attempting to access them after a transaction has ended will
+// likely result in an access violation.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) ForEach(fn func(k, v []byte) error) error {
+	return convertErr((*bolt.Bucket)(b).ForEach(fn))
+}
+
+// Get returns the value for the given key.  Returns nil if the key does
+// not exist in this bucket (or nested buckets).
+//
+// NOTE: The value returned by this function is only valid during a
+// transaction.  Attempting to access it after a transaction has ended
+// will likely result in an access violation.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) Get(key []byte) []byte {
+	return (*bolt.Bucket)(b).Get(key)
+}
+
+// ReadCursor returns a new cursor, allowing for iteration over the bucket's
+// key/value pairs and nested buckets in forward or backward order.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) ReadCursor() walletdb.ReadCursor {
+	return (*cursor)((*bolt.Bucket)(b).Cursor())
+}
+
+// cursor represents a cursor over key/value pairs and nested buckets of a
+// bucket.
+type cursor bolt.Cursor
+
+// First positions the cursor at the first key/value pair and returns the pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) First() (key, value []byte) {
+	return (*bolt.Cursor)(c).First()
+}
+
+// Last positions the cursor at the last key/value pair and returns the pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Last() (key, value []byte) {
+	return (*bolt.Cursor)(c).Last()
+}
+
+// Next moves the cursor one key/value pair forward and returns the new pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Next() (key, value []byte) {
+	return (*bolt.Cursor)(c).Next()
+}
+
+// Prev moves the cursor one key/value pair backward and returns the new pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Prev() (key, value []byte) {
+	return (*bolt.Cursor)(c).Prev()
+}
+
+// Seek positions the cursor at the passed seek key. If the key does not exist,
+// the cursor is moved to the next key after seek. Returns the new pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Seek(seek []byte) (key, value []byte) {
+	return (*bolt.Cursor)(c).Seek(seek)
+}
+
+// Closes the cursor
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Close() {}
+
+// db represents a read-only bolt database and implements the walletdb.DB
+// interface.  Write transactions are refused.
+type db bolt.DB
+
+// Enforce db implements the walletdb.DB interface.
+var _ walletdb.DB = (*db)(nil)
+
+func (db *db) BeginReadTx() (walletdb.ReadTx, error) {
+	boltTx, err := (*bolt.DB)(db).Begin(false)
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	return &transaction{boltTx: boltTx}, nil
+}
+
+// BeginReadWriteTx always errors, as the database is read-only.
+//
+// This function is part of the walletdb.DB interface implementation.
+func (db *db) BeginReadWriteTx() (walletdb.ReadWriteTx, error) {
+	return nil, errReadOnly
+}
+
+// Copy writes a copy of the database to the provided writer.  This call will
+// start a read-only transaction to perform all operations.
+//
+// This function is part of the walletdb.DB interface implementation.
+func (db *db) Copy(w io.Writer) error {
+	return convertErr((*bolt.DB)(db).View(func(tx *bolt.Tx) error {
+		return tx.Copy(w)
+	}))
+}
+
+// Close releases the database.
+//
+// This function is part of the walletdb.DB interface implementation.
+func (db *db) Close() error {
+	return convertErr((*bolt.DB)(db).Close())
+}
+
+// openDB opens the database at the provided path for reading.
+func openDB(dbPath string) (walletdb.DB, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.E(errors.NotExist, "missing database file")
+		}
+		return nil, errors.E(errors.IO, err)
+	}
+
+	boltDB, err := bolt.Open(dbPath, 0600, &bolt.Options{
+		ReadOnly: true,
+		Timeout:  lockTimeout,
+	})
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	return (*db)(boltDB), nil
+}
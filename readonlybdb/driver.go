@@ -0,0 +1,67 @@
+// Copyright (c) 2014 The btcsuite developers
+// Copyright (c) 2015 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package readonlybdb implements a walletdb driver that opens databases
+// written by the bdb driver without write access.  Databases are opened with a
+// shared lock, so several read-only opens may share a database, but not with
+// a process that has it open with the bdb driver.
+package readonlybdb
+
+import (
+	"fmt"
+
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet/walletdb"
+)
+
+const (
+	dbType = "readonlybdb"
+)
+
+// parseArgs parses the arguments from the walletdb Open method.
+func parseArgs(funcName string, args ...interface{}) (string, error) {
+	if len(args) != 1 {
+		return "", errors.Errorf("invalid arguments to %s.%s -- "+
+			"expected database path", dbType, funcName)
+	}
+
+	dbPath, ok := args[0].(string)
+	if !ok {
+		return "", errors.Errorf("first argument to %s.%s is invalid -- "+
+			"expected database path string", dbType, funcName)
+	}
+
+	return dbPath, nil
+}
+
+// openDBDriver is the callback provided during driver registration that opens
+// an existing database for reading.
+func openDBDriver(args ...interface{}) (walletdb.DB, error) {
+	dbPath, err := parseArgs("Open", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return openDB(dbPath)
+}
+
+// createDBDriver is the callback provided during driver registration.  Read-only
+// databases cannot be created.
+func createDBDriver(args ...interface{}) (walletdb.DB, error) {
+	return nil, errors.E(errors.Invalid, "read-only databases cannot be created")
+}
+
+func init() {
+	// Register the driver.
+	driver := walletdb.Driver{
+		DbType: dbType,
+		Create: createDBDriver,
+		Open:   openDBDriver,
+	}
+	if err := walletdb.RegisterDriver(driver); err != nil {
+		panic(fmt.Sprintf("Failed to register database driver '%s': %v",
+			dbType, err))
+	}
+}
@@ -0,0 +1,109 @@
+package mobilewallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/decred/dcrwallet/wallet/walletdb"
+	"github.com/raedahgroup/mobilewallet/badgerdb"
+)
+
+// DatabaseRepair reports what RepairDatabase found in the wallet database and
+// what it changed.  Truncated is set when a write torn by a crash was removed
+// from a badgerdb database, losing any transaction committed after it.
+// Replayed is set when the log of a badgerdb database that was not closed
+// cleanly was replayed, which loses nothing.  OrphanedKeys counts removed keys
+// of buckets that no longer exist.  BackupPath holds a copy of the database
+// taken before it was truncated or keys were removed.  UnparsableKeys counts
+// keys of a badgerdb database that belong to no bucket, and CorruptValues
+// counts values that could not be read, which are both kept.
+type DatabaseRepair struct {
+	Driver         string
+	Truncated      bool
+	BackupPath     string
+	Replayed       bool
+	Buckets        int
+	Keys           int
+	OrphanedKeys   int
+	UnparsableKeys int
+	CorruptValues  int
+}
+
+// RepairDatabase checks the integrity of the wallet database and repairs a
+// database left unopenable by a crash, which OpenWallet reports with
+// ErrRepairNeeded.  pubPass opens an encrypted database.  Any loaded wallet is
+// closed first, and the wallet must be opened again with OpenWallet.  The
+// result is a JSON encoded DatabaseRepair.
+//
+// bdb databases are never left unopenable by a crash, as bolt only commits by
+// atomically switching to a fully written copy of the changed pages, so they
+// are only checked.  A bdb database that cannot be read fails with
+// ErrCannotRepair and must be restored from a backup or the seed.
+func (lw *LibWallet) RepairDatabase(pubPass []byte) (string, error) {
+	exists, err := lw.loader.WalletExists()
+	if err != nil {
+		return "", translateError(err)
+	}
+	if !exists {
+		return "", newWalletError(ErrNotExist)
+	}
+	if _, loaded := lw.loader.LoadedWallet(); loaded {
+		if err := lw.loader.UnloadWallet(); err != nil {
+			return "", translateError(err)
+		}
+	}
+
+	result := &DatabaseRepair{Driver: lw.dbDriver}
+	dbPath := filepath.Join(lw.loader.DbDirPath(), walletDbName)
+	if lw.dbDriver == "badgerdb" {
+		backupPath := fmt.Sprintf("%s.%d.bak", dbPath, time.Now().Unix())
+		opts := lw.loader.dbArgs(lw.dbDriver, dbPath, pubPass)[1].(*badgerdb.Options)
+		report, err := badgerdb.Repair(dbPath, backupPath, opts)
+		if err != nil {
+			return "", translateError(err)
+		}
+		result.Truncated = report.Truncated
+		result.BackupPath = report.BackupPath
+		result.Replayed = report.Replayed
+		result.Buckets = report.Buckets
+		result.Keys = report.Keys
+		result.OrphanedKeys = report.OrphanedKeys
+		result.UnparsableKeys = report.UnparsableKeys
+		result.CorruptValues = report.CorruptValues
+	} else {
+		db, err := walletdb.Open(lw.dbDriver, lw.loader.dbArgs(lw.dbDriver, dbPath, pubPass)...)
+		if err != nil {
+			return "", cannotRepair(err)
+		}
+		summary, err := summarizeDatabase(db)
+		db.Close()
+		if err != nil {
+			return "", cannotRepair(err)
+		}
+		result.Buckets = summary.buckets
+		result.Keys = summary.keys
+	}
+
+	if result.Truncated || result.Replayed || result.OrphanedKeys != 0 ||
+		result.UnparsableKeys != 0 || result.CorruptValues != 0 {
+		log.Warnf("Repaired wallet database: truncated: %v, replayed: %v, orphaned keys: %d, "+
+			"unparsable keys: %d, corrupt values: %d", result.Truncated, result.Replayed,
+			result.OrphanedKeys, result.UnparsableKeys, result.CorruptValues)
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return string(resultJSON), nil
+}
+
+// cannotRepair returns the error of a database that RepairDatabase found to be
+// damaged but cannot repair.
+func cannotRepair(err error) error {
+	walletErr := translateError(err).(*WalletError)
+	walletErr.Code = ErrCannotRepair
+	return walletErr
+}
@@ -26,6 +26,7 @@ type Account struct {
 	ExternalKeyCount int32
 	InternalKeyCount int32
 	ImportedKeyCount int32
+	Hidden           bool
 }
 
 type Accounts struct {
@@ -38,8 +39,10 @@ type Accounts struct {
 	CurrentBlockHeight int32
 }
 
+// BlockScanResponse receives the progress of a rescan started with
+// RescanFromHeight.  Returning false from OnScan cancels the rescan.
 type BlockScanResponse interface {
-	OnScan(rescannedThrough int32) bool
+	OnScan(rescannedThrough int32, scannedBlocks int32, totalBlocks int32, percentage int32) bool
 	OnEnd(height int32, cancelled bool)
 	OnError(err string)
 }
@@ -49,20 +52,31 @@ Direction
 0: Sent
 1: Received
 2: Transfered
+
+AccountAmounts is the net change of the balance of each account involved, and
+Counterparties are the addresses of outputs paying outside the wallet.  The
+FromAccount and ToAccount fields are set for transfers made by
+TransferBetweenAccounts.
 */
 type Transaction struct {
-	Hash        string
-	Raw         string
-	Transaction []byte
-	Fee         int64
-	Timestamp   int64
-	Type        string
-	Amount      int64
-	Status      string
-	Height      int32
-	Direction   int32
-	Debits      *[]TransactionDebit
-	Credits     *[]TransactionCredit
+	Hash            string
+	Raw             string
+	Transaction     []byte
+	Fee             int64
+	Timestamp       int64
+	Type            string
+	Amount          int64
+	Status          string
+	Height          int32
+	Direction       int32
+	Debits          *[]TransactionDebit
+	Credits         *[]TransactionCredit
+	AccountAmounts  []AccountAmount
+	Counterparties  []string
+	FromAccount     int32
+	FromAccountName string
+	ToAccount       int32
+	ToAccountName   string
 }
 
 type TransactionDebit struct {
@@ -72,6 +86,13 @@ type TransactionDebit struct {
 	AccountName     string
 }
 
+// AccountAmount is the net change of an account's balance by a transaction.
+type AccountAmount struct {
+	Account     int32
+	AccountName string
+	Amount      int64
+}
+
 type TransactionCredit struct {
 	Index    int32
 	Account  int32
@@ -133,14 +154,9 @@ type SpvSyncResponse interface {
 	OnDiscoveredAddresses(state string)
 	OnRescan(rescannedThrough int32, state string)
 	OnSynced(synced bool)
-	/*
-	* Handled Error Codes
-	* -1 - Unexpected Error
-	*  1 - Context Canceled
-	*  2 - Deadline Exceeded
-	*  3 - Invalid Address
-	 */
-	OnSyncError(code int, err error)
+	// OnSyncError is called when synchronization stops with an error.  See
+	// the SyncErr constants for the possible codes.
+	OnSyncError(err *SyncError)
 }
 
 const (
@@ -159,6 +175,25 @@ const (
 	ErrContextCanceled     = "context_canceled"
 	ErrFailedPrecondition  = "failed_precondition"
 	ErrNoPeers             = "no_peers"
+	ErrProxyRequiresPeers  = "proxy_requires_peers"
+	ErrRepairNeeded        = "repair_needed"
+	ErrCannotRepair        = "cannot_repair"
+	ErrUnknown             = "unknown"
+	ErrInternal            = "internal"
+	ErrPermission          = "permission_denied"
+	ErrIO                  = "io"
+	ErrExist               = "exists"
+	ErrEncoding            = "encoding"
+	ErrCrypto              = "crypto"
+	ErrLocked              = "locked"
+	ErrInvalidSeed         = "invalid_seed"
+	ErrWatchingOnly        = "watching_only"
+	ErrScriptFailure       = "script_failure"
+	ErrPolicy              = "policy"
+	ErrConsensus           = "consensus"
+	ErrDoubleSpend         = "double_spend"
+	ErrProtocol            = "protocol"
+	ErrDeployment          = "inactive_deployment"
 
 	//Sync States
 
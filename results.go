@@ -0,0 +1,148 @@
+package mobilewallet
+
+// The types in this file and their accessors are returned by the typed
+// variants of the methods returning JSON, such as GetTransactionList for
+// GetTransactions.  gomobile cannot bind slices of structs, so the elements of
+// lists are read with Count and Get methods instead.  Get methods return nil
+// if the index is out of range.
+
+// AccountList is the list of accounts returned by GetAccountList.
+type AccountList struct {
+	CurrentBlockHash   []byte
+	CurrentBlockHeight int32
+	accounts           []Account
+}
+
+// Count returns the number of accounts in the list.
+func (l *AccountList) Count() int {
+	return len(l.accounts)
+}
+
+// Get returns the account at index i of the list.
+func (l *AccountList) Get(i int) *Account {
+	if i < 0 || i >= len(l.accounts) {
+		return nil
+	}
+	return &l.accounts[i]
+}
+
+// TransactionList is the list of transactions returned by GetTransactionList.
+type TransactionList struct {
+	transactions []Transaction
+}
+
+// Count returns the number of transactions in the list.
+func (l *TransactionList) Count() int {
+	return len(l.transactions)
+}
+
+// Get returns the transaction at index i of the list.
+func (l *TransactionList) Get(i int) *Transaction {
+	if i < 0 || i >= len(l.transactions) {
+		return nil
+	}
+	return &l.transactions[i]
+}
+
+// DebitCount returns the number of inputs of the transaction spending from the
+// wallet.
+func (tx *Transaction) DebitCount() int {
+	if tx.Debits == nil {
+		return 0
+	}
+	return len(*tx.Debits)
+}
+
+// Debit returns the debit at index i of the transaction.
+func (tx *Transaction) Debit(i int) *TransactionDebit {
+	if i < 0 || i >= tx.DebitCount() {
+		return nil
+	}
+	return &(*tx.Debits)[i]
+}
+
+// CreditCount returns the number of outputs of the transaction paying to the
+// wallet.
+func (tx *Transaction) CreditCount() int {
+	if tx.Credits == nil {
+		return 0
+	}
+	return len(*tx.Credits)
+}
+
+// Credit returns the credit at index i of the transaction.
+func (tx *Transaction) Credit(i int) *TransactionCredit {
+	if i < 0 || i >= tx.CreditCount() {
+		return nil
+	}
+	return &(*tx.Credits)[i]
+}
+
+// AccountAmountCount returns the number of accounts whose balance is changed
+// by the transaction.
+func (tx *Transaction) AccountAmountCount() int {
+	return len(tx.AccountAmounts)
+}
+
+// AccountAmount returns the balance change at index i of the transaction.
+func (tx *Transaction) AccountAmount(i int) *AccountAmount {
+	if i < 0 || i >= len(tx.AccountAmounts) {
+		return nil
+	}
+	return &tx.AccountAmounts[i]
+}
+
+// CounterpartyCount returns the number of counterparty addresses of the
+// transaction.
+func (tx *Transaction) CounterpartyCount() int {
+	return len(tx.Counterparties)
+}
+
+// Counterparty returns the counterparty address at index i of the
+// transaction, or an empty string if the index is out of range.
+func (tx *Transaction) Counterparty(i int) string {
+	if i < 0 || i >= len(tx.Counterparties) {
+		return ""
+	}
+	return tx.Counterparties[i]
+}
+
+// InputCount returns the number of inputs of the transaction.
+func (tx *DecodedTransaction) InputCount() int {
+	return len(tx.Inputs)
+}
+
+// Input returns the input at index i of the transaction.
+func (tx *DecodedTransaction) Input(i int) *DecodedInput {
+	if i < 0 || i >= len(tx.Inputs) {
+		return nil
+	}
+	return &tx.Inputs[i]
+}
+
+// OutputCount returns the number of outputs of the transaction.
+func (tx *DecodedTransaction) OutputCount() int {
+	return len(tx.Outputs)
+}
+
+// Output returns the output at index i of the transaction.
+func (tx *DecodedTransaction) Output(i int) *DecodedOutput {
+	if i < 0 || i >= len(tx.Outputs) {
+		return nil
+	}
+	return &tx.Outputs[i]
+}
+
+// AddressCount returns the number of addresses the output pays to.
+func (out *DecodedOutput) AddressCount() int {
+	return len(out.Addresses)
+}
+
+// Address returns the address at index i of the output, or an empty string if
+// the index is out of range.
+func (out *DecodedOutput) Address(i int) string {
+	if i < 0 || i >= len(out.Addresses) {
+		return ""
+	}
+	return out.Addresses[i]
+}
@@ -0,0 +1,336 @@
+package mobilewallet
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrec"
+	"github.com/decred/dcrd/dcrjson"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/gcs/blockcf"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet"
+	"github.com/decred/dcrwallet/wallet/txrules"
+)
+
+// Signature script sizes used to estimate the fee of a sweep.  A signature is
+// up to 73 bytes and a compressed public key 33 bytes, each with a data push.
+// P2PK outputs are redeemed by the signature alone.
+const (
+	redeemP2PKHSigScriptSize = 1 + 73 + 1 + 33
+	redeemP2PKSigScriptSize  = 1 + 73
+)
+
+// p2pkhPkScriptSize is the size of the P2PKH script of a sweep destination.
+const p2pkhPkScriptSize = 25
+
+// sweepOutput is an unspent output paying to a swept key.  height is -1 for
+// unmined outputs.
+type sweepOutput struct {
+	outPoint wire.OutPoint
+	value    int64
+	pkScript []byte
+	height   int32
+	index    uint32
+}
+
+// SweepPrivateKey moves the funds of a WIF encoded private key, such as one
+// printed on a paper wallet, to a new address of destAccount and returns the
+// hash of the published transaction.  Unlike ImportPrivateKey, the key is not
+// added to the wallet.  feeRate is in atoms per kilobyte; if it is 0 the
+// default relay fee is paid.
+//
+// Outputs paying to the key's P2PKH address or to the key itself (P2PK) are
+// found by matching the block filters of the main chain from the wallet
+// birthday; SweepPrivateKeyFromHeight searches from another height.  The
+// wallet must be synced, and only the blocks that may pay to the key are
+// fetched from the network.  Unmined outputs are found among the wallet's
+// unmined transactions and, when syncing with dcrd over RPC, in the mempool of
+// dcrd.  Coinbase outputs are not swept.  The destination address is only
+// derived once enough funds to pay the fee have been found.
+func (lw *LibWallet) SweepPrivateKey(wif string, destAccount int32, feeRate int64) ([]byte, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
+	return lw.sweepPrivateKey(wif, destAccount, feeRate, lw.birthdayScanStart())
+}
+
+// SweepPrivateKeyFromHeight is SweepPrivateKey searching the main chain for
+// outputs paying to the key from startHeight, such as the height the key was
+// first paid at, rather than from the wallet birthday.
+func (lw *LibWallet) SweepPrivateKeyFromHeight(wif string, destAccount int32, feeRate int64, startHeight int32) ([]byte, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
+	if _, tipHeight := lw.wallet.MainChainTip(); startHeight < 0 || startHeight > tipHeight {
+		return nil, newWalletError(ErrInvalid)
+	}
+	return lw.sweepPrivateKey(wif, destAccount, feeRate, startHeight)
+}
+
+func (lw *LibWallet) sweepPrivateKey(wif string, destAccount int32, feeRate int64, startHeight int32) ([]byte, error) {
+	n, err := lw.wallet.NetworkBackend()
+	if err != nil {
+		return nil, newWalletError(ErrNotConnected)
+	}
+	if destAccount < 0 || feeRate < 0 {
+		return nil, newWalletError(ErrInvalid)
+	}
+	if feeRate == 0 {
+		feeRate = int64(txrules.DefaultRelayFeePerKb)
+	}
+
+	params := lw.wallet.ChainParams()
+	key, err := dcrutil.DecodeWIF(wif)
+	if err != nil || !key.IsForNet(params) || key.DSA() != dcrec.STEcdsaSecp256k1 {
+		return nil, newWalletError(ErrInvalid)
+	}
+	pubKey := key.SerializePubKey()
+	addr, err := dcrutil.NewAddressPubKeyHash(dcrutil.Hash160(pubKey),
+		params, dcrec.STEcdsaSecp256k1)
+	if err != nil {
+		return nil, newWalletError(ErrInvalid)
+	}
+	pkAddr, err := dcrutil.NewAddressSecpPubKey(pubKey, params)
+	if err != nil {
+		return nil, newWalletError(ErrInvalid)
+	}
+	pkhScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(pkAddr)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	ctx := contextWithShutdownCancel(context.Background())
+	outputs, err := lw.findUnspentOutputs(ctx, n, [][]byte{pkhScript, pkScript}, startHeight)
+	if err != nil {
+		log.Error(err)
+		return nil, translateError(err)
+	}
+	if len(outputs) == 0 {
+		return nil, newWalletError(ErrInsufficientBalance)
+	}
+
+	tx, amount, err := sweepTransaction(outputs, pkScript, dcrutil.Amount(feeRate), lw.wallet.RelayFee())
+	if err != nil {
+		return nil, err
+	}
+
+	destAddr, err := lw.wallet.NewExternalAddress(uint32(destAccount), wallet.WithGapPolicyWrap())
+	if err != nil {
+		log.Error(err)
+		return nil, translateError(err)
+	}
+	destScript, err := txscript.PayToAddrScript(destAddr)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	tx.TxOut[0].Value = int64(amount)
+	tx.TxOut[0].PkScript = destScript
+
+	for i, out := range outputs {
+		var sigScript []byte
+		if bytes.Equal(out.pkScript, pkScript) {
+			var sig []byte
+			sig, err = txscript.RawTxInSignature(tx, i, pkScript, txscript.SigHashAll, key.PrivKey)
+			if err == nil {
+				sigScript, err = txscript.NewScriptBuilder().AddData(sig).Script()
+			}
+		} else {
+			sigScript, err = txscript.SignatureScript(tx, i, pkhScript, txscript.SigHashAll,
+				key.PrivKey, true)
+		}
+		if err != nil {
+			log.Error(err)
+			return nil, translateError(err)
+		}
+		tx.TxIn[i].SignatureScript = sigScript
+	}
+
+	var serializedTx bytes.Buffer
+	serializedTx.Grow(tx.SerializeSize())
+	if err := tx.Serialize(&serializedTx); err != nil {
+		log.Error(err)
+		return nil, translateError(err)
+	}
+	txHash, err := lw.wallet.PublishTransaction(tx, serializedTx.Bytes(), n)
+	if err != nil {
+		log.Error(err)
+		return nil, translateError(err)
+	}
+	log.Infof("Swept %v from %v to %v in transaction %v", amount, addr, destAddr, txHash)
+	return txHash[:], nil
+}
+
+// sweepTransaction returns an unsigned transaction spending outputs, with
+// signature scripts of the largest size that redeems them, to a single output
+// whose script is yet to be set.  p2pkScript is the script of the outputs that
+// pay to the key itself.  The returned amount is the value of the outputs less
+// the fee at feeRate, which fails with ErrInsufficientBalance if it is dust.
+func sweepTransaction(outputs []*sweepOutput, p2pkScript []byte, feeRate, relayFee dcrutil.Amount) (*wire.MsgTx, dcrutil.Amount, error) {
+	tx := wire.NewMsgTx()
+	var total int64
+	for _, out := range outputs {
+		sigScriptSize := redeemP2PKHSigScriptSize
+		if bytes.Equal(out.pkScript, p2pkScript) {
+			sigScriptSize = redeemP2PKSigScriptSize
+		}
+		in := wire.NewTxIn(&out.outPoint, out.value, make([]byte, sigScriptSize))
+		if out.height < 0 {
+			in.BlockHeight = wire.NullBlockHeight
+			in.BlockIndex = wire.NullBlockIndex
+		} else {
+			in.BlockHeight = uint32(out.height)
+			in.BlockIndex = out.index
+		}
+		tx.AddTxIn(in)
+		total += out.value
+	}
+	// The destination script is added once the amount is known to cover the
+	// fee, so that no address is used up for a sweep that fails.
+	tx.AddTxOut(wire.NewTxOut(0, make([]byte, p2pkhPkScriptSize)))
+	fee := txrules.FeeForSerializeSize(feeRate, tx.SerializeSize())
+	amount := dcrutil.Amount(total) - fee
+	if amount <= 0 || txrules.IsDustAmount(amount, p2pkhPkScriptSize, relayFee) {
+		return nil, 0, newWalletError(ErrInsufficientBalance)
+	}
+	return tx, amount, nil
+}
+
+// findUnspentOutputs returns the unspent outputs of regular, non-coinbase
+// transactions paying to any of pkScripts.  Main chain blocks from startHeight
+// whose filters match a script or a previously found output are fetched from n.
+// Unmined transactions are searched as described for SweepPrivateKey.
+func (lw *LibWallet) findUnspentOutputs(ctx context.Context, n wallet.NetworkBackend,
+	pkScripts [][]byte, startHeight int32) ([]*sweepOutput, error) {
+
+	var entries blockcf.Entries
+	for _, pkScript := range pkScripts {
+		entries.AddRegularPkScript(pkScript)
+	}
+	unspent := make(map[wire.OutPoint]*sweepOutput)
+	addOutputs := func(tx *wire.MsgTx, height int32, index uint32) {
+		txHash := tx.TxHash()
+		for j, out := range tx.TxOut {
+			for _, pkScript := range pkScripts {
+				if !bytes.Equal(out.PkScript, pkScript) {
+					continue
+				}
+				op := wire.OutPoint{Hash: txHash, Index: uint32(j), Tree: wire.TxTreeRegular}
+				unspent[op] = &sweepOutput{
+					outPoint: op,
+					value:    out.Value,
+					pkScript: pkScript,
+					height:   height,
+					index:    index,
+				}
+				entries.AddOutPoint(&op)
+			}
+		}
+	}
+	removeSpent := func(txs []*wire.MsgTx) {
+		for _, tx := range txs {
+			for _, in := range tx.TxIn {
+				delete(unspent, in.PreviousOutPoint)
+			}
+		}
+	}
+
+	_, tipHeight := lw.wallet.MainChainTip()
+	// The genesis block pays to no one.
+	if startHeight < 1 {
+		startHeight = 1
+	}
+	for height := startHeight; height <= tipHeight; height++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		info, err := lw.wallet.BlockInfo(wallet.NewBlockIdentifierFromHeight(height))
+		if err != nil {
+			return nil, err
+		}
+		filter, err := lw.wallet.CFilter(&info.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if !filter.MatchAny(blockcf.Key(&info.Hash), entries) {
+			continue
+		}
+
+		blocks, err := n.GetBlocks(ctx, []*chainhash.Hash{&info.Hash})
+		if err != nil {
+			return nil, err
+		}
+		if len(blocks) != 1 {
+			return nil, errors.E(errors.Protocol, "block was not returned")
+		}
+		block := blocks[0]
+		for i, tx := range block.Transactions {
+			removeSpent([]*wire.MsgTx{tx})
+			if i != 0 {
+				addOutputs(tx, height, uint32(i))
+			}
+		}
+		removeSpent(block.STransactions)
+	}
+
+	// Unmined transactions may depend on each other, so every output is
+	// found before spent outputs are removed.  Stake transactions pay to no
+	// P2PKH or P2PK script but may spend the key's outputs.
+	unmined, err := lw.unminedTransactions()
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range unmined {
+		addOutputs(tx, -1, wire.NullBlockIndex)
+	}
+	removeSpent(unmined)
+
+	outputs := make([]*sweepOutput, 0, len(unspent))
+	for _, out := range unspent {
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+// unminedTransactions returns the unmined transactions known to the wallet and,
+// when connected to dcrd over RPC, those in the mempool of dcrd.
+func (lw *LibWallet) unminedTransactions() ([]*wire.MsgTx, error) {
+	txs, err := lw.wallet.UnminedTransactions()
+	if err != nil {
+		return nil, err
+	}
+
+	lw.mu.Lock()
+	rpcClient := lw.rpcClient
+	lw.mu.Unlock()
+	if rpcClient == nil || rpcClient.Disconnected() {
+		return txs, nil
+	}
+	hashes, err := rpcClient.GetRawMempool(dcrjson.GRMAll)
+	if err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+	known := make(map[chainhash.Hash]bool, len(txs))
+	for _, tx := range txs {
+		known[tx.TxHash()] = true
+	}
+	for _, hash := range hashes {
+		if known[*hash] {
+			continue
+		}
+		tx, err := rpcClient.GetRawTransaction(hash)
+		if err != nil {
+			// Mined or removed from the mempool since it was listed.
+			continue
+		}
+		txs = append(txs, tx.MsgTx())
+	}
+	return txs, nil
+}
@@ -0,0 +1,181 @@
+package mobilewallet
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"testing"
+
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainec"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrec"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
+	"github.com/decred/dcrwallet/wallet"
+	"github.com/decred/dcrwallet/wallet/txrules"
+)
+
+// newSweepTestKey returns a new WIF encoded key and the P2PKH and P2PK scripts
+// paying to it.
+func newSweepTestKey(t *testing.T, params *chaincfg.Params) (string, []byte, []byte) {
+	priv, _, _, err := chainec.Secp256k1.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, pub := chainec.Secp256k1.PrivKeyFromBytes(priv)
+	wif, err := dcrutil.NewWIF(key, params, dcrec.STEcdsaSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhAddr, err := dcrutil.NewAddressPubKeyHash(dcrutil.Hash160(pub.SerializeCompressed()),
+		params, dcrec.STEcdsaSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkAddr, err := dcrutil.NewAddressSecpPubKey(pub.SerializeCompressed(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhScript, err := txscript.PayToAddrScript(pkhAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(pkAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wif.String(), pkhScript, pkScript
+}
+
+func TestSweepTransactionFee(t *testing.T) {
+	_, pkhScript, pkScript := newSweepTestKey(t, &chaincfg.TestNet3Params)
+	feeRate := txrules.DefaultRelayFeePerKb
+	output := func(value int64, pkScript []byte) *sweepOutput {
+		return &sweepOutput{
+			outPoint: wire.OutPoint{Hash: chainhash.Hash{1}},
+			value:    value,
+			pkScript: pkScript,
+			height:   -1,
+		}
+	}
+	// sweepFee returns the fee of sweeping outputs, which must succeed.
+	sweepFee := func(name string, rate dcrutil.Amount, outputs ...*sweepOutput) dcrutil.Amount {
+		tx, amount, err := sweepTransaction(outputs, pkScript, rate, feeRate)
+		if err != nil {
+			t.Fatalf("%s: sweepTransaction: %v", name, err)
+		}
+		var total int64
+		for _, out := range outputs {
+			total += out.value
+		}
+		fee := dcrutil.Amount(total) - amount
+		if want := txrules.FeeForSerializeSize(rate, tx.SerializeSize()); fee != want {
+			t.Errorf("%s: fee is %v, want %v", name, fee, want)
+		}
+		if len(tx.TxOut) != 1 || tx.TxIn[0].ValueIn != outputs[0].value ||
+			tx.TxIn[0].BlockHeight != wire.NullBlockHeight {
+			t.Errorf("%s: unexpected transaction %+v", name, tx)
+		}
+		return fee
+	}
+
+	pkhFee := sweepFee("p2pkh", feeRate, output(1e8, pkhScript))
+	if pkFee := sweepFee("p2pk", feeRate, output(1e8, pkScript)); pkFee >= pkhFee {
+		t.Errorf("fee of a P2PK output %v is not less than of a P2PKH output %v", pkFee, pkhFee)
+	}
+	if fee := sweepFee("two outputs", feeRate, output(1e8, pkhScript), output(1e8, pkScript)); fee <= pkhFee {
+		t.Errorf("fee of two outputs %v is not more than of one %v", fee, pkhFee)
+	}
+	sweepFee("small output", feeRate, output(int64(pkhFee)+1e6, pkhScript))
+
+	tests := []struct {
+		name    string
+		value   int64
+		feeRate dcrutil.Amount
+	}{
+		{"fee only", int64(pkhFee), feeRate},
+		{"less than the fee", int64(pkhFee) - 1, feeRate},
+		{"dust left", int64(pkhFee) + 1, feeRate},
+		{"high fee rate", 1e6, 1e8},
+	}
+	for _, test := range tests {
+		_, _, err := sweepTransaction([]*sweepOutput{output(test.value, pkhScript)}, pkScript,
+			test.feeRate, feeRate)
+		checkWalletErrorCode(t, test.name+": sweepTransaction ", err, ErrInsufficientBalance)
+	}
+}
+
+// sweepTestBackend is a network backend for sweeps that need not fetch blocks
+// and are not published.
+type sweepTestBackend struct {
+	wallet.NetworkBackend
+}
+
+func TestSweepUnmined(t *testing.T) {
+	lw, dir := newTestWallet(t, "bdb")
+	defer os.RemoveAll(dir)
+	defer lw.CloseWallet()
+
+	params := lw.wallet.ChainParams()
+	wif, pkhScript, pkScript := newSweepTestKey(t, params)
+	address, err := lw.CurrentAddress(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := dcrutil.DecodeAddress(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	walletScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unmined transactions are recorded by the wallet when they pay to it.
+	// The second spends the output of the first paying to the key.
+	newTx := func(prevOut *wire.OutPoint, keyValue int64, keyScript []byte) *wire.MsgTx {
+		tx := wire.NewMsgTx()
+		tx.AddTxIn(wire.NewTxIn(prevOut, 1e9, nil))
+		tx.AddTxOut(wire.NewTxOut(keyValue, keyScript))
+		tx.AddTxOut(wire.NewTxOut(1e6, walletScript))
+		return tx
+	}
+	paid := newTx(wire.NewOutPoint(&chainhash.Hash{1}, 0, wire.TxTreeRegular), 1e8, pkhScript)
+	paidHash := paid.TxHash()
+	spending := newTx(wire.NewOutPoint(&paidHash, 0, wire.TxTreeRegular), 4e7, pkScript)
+	other := newTx(wire.NewOutPoint(&chainhash.Hash{2}, 0, wire.TxTreeRegular), 2e7, pkhScript)
+	for _, tx := range []*wire.MsgTx{spending, paid, other} {
+		if err := lw.wallet.AcceptMempoolTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outputs, err := lw.findUnspentOutputs(context.Background(), nil, [][]byte{pkhScript, pkScript}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[wire.OutPoint]int64{
+		{Hash: spending.TxHash(), Index: 0}: 4e7,
+		{Hash: other.TxHash(), Index: 0}:    2e7,
+	}
+	if len(outputs) != len(want) {
+		t.Errorf("found %d unspent outputs, want %d", len(outputs), len(want))
+	}
+	for _, out := range outputs {
+		if value, ok := want[out.outPoint]; !ok || out.value != value || out.height != -1 {
+			t.Errorf("unexpected unspent output %v of %v at height %d", out.outPoint, out.value, out.height)
+		}
+	}
+
+	// A sweep that leaves nothing after the fee derives no address.
+	lw.wallet.SetNetworkBackend(sweepTestBackend{})
+	_, err = lw.SweepPrivateKey(wif, 0, 1e9)
+	checkWalletErrorCode(t, "SweepPrivateKey ", err, ErrInsufficientBalance)
+	if got, err := lw.CurrentAddress(0); err != nil || got != address {
+		t.Errorf("current address is %s (%v) after a failed sweep, want %s", got, err, address)
+	}
+	_, err = lw.SweepPrivateKeyFromHeight(wif, 0, 0, 1)
+	checkWalletErrorCode(t, "SweepPrivateKeyFromHeight past the tip ", err, ErrInvalid)
+}
@@ -0,0 +1,143 @@
+package mobilewallet
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/decred/dcrd/rpcclient"
+	"github.com/decred/dcrd/wire"
+	"github.com/decred/dcrwallet/errors"
+)
+
+// Sync error codes classify why synchronization stopped and are reported
+// through SpvSyncResponse.OnSyncError.  The same codes are used for SPV and RPC
+// synchronization.  They are plain int32 values as gomobile cannot bind named
+// numeric types.
+const (
+	SyncErrUnexpected         int32 = -1
+	SyncErrCanceled           int32 = 1
+	SyncErrDeadlineExceeded   int32 = 2
+	SyncErrInvalidPeerAddress int32 = 3
+	SyncErrAuthFailure        int32 = 4
+	SyncErrNoPeers            int32 = 5
+	SyncErrNetworkUnreachable int32 = 6
+	SyncErrChainMismatch      int32 = 7
+	SyncErrDatabase           int32 = 8
+)
+
+// errChainMismatch is returned when a dcrd RPC server is on another network
+// than the wallet.
+var errChainMismatch = errors.E(errors.Invalid, "RPC server is on another network")
+
+// Sync backends that a SyncError can originate from.
+const (
+	SyncBackendSPV = "spv"
+	SyncBackendRPC = "rpc"
+)
+
+// SyncError describes why wallet synchronization stopped.  Retryable reports
+// whether starting synchronization again without changing any settings may
+// succeed.
+type SyncError struct {
+	Code      int32
+	Backend   string
+	Retryable bool
+	Message   string
+}
+
+func (e *SyncError) Error() string {
+	return e.Message
+}
+
+func newSyncError(backend string, code int32, err error) *SyncError {
+	var retryable bool
+	switch code {
+	case SyncErrDeadlineExceeded, SyncErrNoPeers, SyncErrNetworkUnreachable:
+		retryable = true
+	}
+	return &SyncError{
+		Code:      code,
+		Backend:   backend,
+		Retryable: retryable,
+		Message:   err.Error(),
+	}
+}
+
+// syncErrorCode classifies an error returned by a network backend.  Peers on
+// another network are detected by wire rejecting their messages, which start
+// with the magic number of their network.
+func syncErrorCode(err error) int32 {
+	switch {
+	case hasError(err, isError(context.Canceled)):
+		return SyncErrCanceled
+	case hasError(err, isError(context.DeadlineExceeded)):
+		return SyncErrDeadlineExceeded
+	case hasError(err, isError(rpcclient.ErrInvalidAuth)):
+		return SyncErrAuthFailure
+	case hasError(err, isError(errChainMismatch)) || hasError(err, isMessageError):
+		return SyncErrChainMismatch
+	case errors.Is(errors.NoPeers, err):
+		return SyncErrNoPeers
+	case isDatabaseError(err):
+		return SyncErrDatabase
+	case errors.Is(errors.IO, err) || hasError(err, isNetError):
+		return SyncErrNetworkUnreachable
+	}
+	return SyncErrUnexpected
+}
+
+// hasError returns whether match is true for err or any error nested in it.
+func hasError(err error, match func(error) bool) bool {
+	for err != nil {
+		if match(err) {
+			return true
+		}
+		e, ok := err.(*errors.Error)
+		if !ok {
+			return false
+		}
+		err = e.Err
+	}
+	return false
+}
+
+func isError(target error) func(error) bool {
+	return func(err error) bool {
+		return err == target
+	}
+}
+
+func isNetError(err error) bool {
+	_, ok := err.(net.Error)
+	return ok
+}
+
+func isMessageError(err error) bool {
+	_, ok := err.(*wire.MessageError)
+	return ok
+}
+
+// isDatabaseError returns whether err was raised by the wallet database.
+func isDatabaseError(err error) bool {
+	for err != nil {
+		e, ok := err.(*errors.Error)
+		if !ok {
+			return false
+		}
+		op := string(e.Op)
+		if strings.HasPrefix(op, "walletdb.") || strings.HasPrefix(op, "udb.") {
+			return true
+		}
+		err = e.Err
+	}
+	return false
+}
+
+// notifySyncError reports err to every registered sync response.
+func (lw *LibWallet) notifySyncError(backend string, code int32, err error) {
+	syncErr := newSyncError(backend, code, err)
+	for _, syncResponse := range lw.syncResponses {
+		syncResponse.OnSyncError(syncErr)
+	}
+}
@@ -0,0 +1,36 @@
+package mobilewallet
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/decred/dcrd/rpcclient"
+	"github.com/decred/dcrd/wire"
+	"github.com/decred/dcrwallet/errors"
+)
+
+func TestSyncErrorCode(t *testing.T) {
+	const op errors.Op = "rpcclient.Start"
+	tests := []struct {
+		name string
+		err  error
+		code int32
+	}{
+		{"canceled", errors.E(op, context.Canceled), SyncErrCanceled},
+		{"deadline exceeded", context.DeadlineExceeded, SyncErrDeadlineExceeded},
+		{"auth failure", errors.E(op, errors.IO, rpcclient.ErrInvalidAuth), SyncErrAuthFailure},
+		{"rpc chain mismatch", errChainMismatch, SyncErrChainMismatch},
+		{"peer chain mismatch", errors.E(errors.Op("p2p.handshake"), errors.IO,
+			&wire.MessageError{Func: "ReadMessage"}), SyncErrChainMismatch},
+		{"no peers", errors.E(errors.NoPeers), SyncErrNoPeers},
+		{"database", errors.E(errors.Op("walletdb.Update"), errors.IO), SyncErrDatabase},
+		{"unreachable", errors.E(op, &net.OpError{Op: "dial"}), SyncErrNetworkUnreachable},
+		{"unexpected", errors.New("unexpected"), SyncErrUnexpected},
+	}
+	for _, test := range tests {
+		if code := syncErrorCode(test.err); code != test.code {
+			t.Errorf("%s: got code %d, want %d", test.name, code, test.code)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package mobilewallet
+
+import (
+	"encoding/binary"
+
+	"github.com/decred/dcrd/wire"
+	"github.com/decred/dcrwallet/wallet"
+)
+
+// transferPrefix begins the metadata keys recording transfers made by
+// TransferBetweenAccounts, which are followed by the transaction hash.  Values
+// hold the source and destination accounts.
+const transferPrefix = "transfer:"
+
+// transferRequiredConfs is the number of confirmations of the outputs spent by
+// TransferBetweenAccounts.  Unconfirmed outputs are not spent, as the transfer
+// would be lost if they were double spent.
+const transferRequiredConfs = 1
+
+// TransferBetweenAccounts moves amount, or every confirmed output of
+// fromAccount if sendAll is set, to a new internal address of toAccount and
+// returns the transaction hash.  The transaction is listed in the history with
+// direction 2 (transferred) and the names of both accounts.
+func (lw *LibWallet) TransferBetweenAccounts(privPass []byte, fromAccount int32, toAccount int32,
+	amount int64, sendAll bool) ([]byte, error) {
+
+	clear := func() {
+		for i := range privPass {
+			privPass[i] = 0
+		}
+	}
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		clear()
+		return nil, newWalletError(ErrWalletNotLoaded)
+	}
+	if _, err := lw.wallet.NetworkBackend(); err != nil {
+		clear()
+		return nil, newWalletError(ErrNotConnected)
+	}
+	if fromAccount < 0 || toAccount < 0 || fromAccount == toAccount || (!sendAll && amount <= 0) {
+		clear()
+		return nil, newWalletError(ErrInvalid)
+	}
+	for _, account := range []int32{fromAccount, toAccount} {
+		if _, err := lw.wallet.AccountName(uint32(account)); err != nil {
+			clear()
+			log.Error(err)
+			return nil, translateError(err)
+		}
+	}
+
+	addr, err := lw.wallet.NewInternalAddress(uint32(toAccount), wallet.WithGapPolicyWrap())
+	if err != nil {
+		clear()
+		log.Error(err)
+		return nil, translateError(err)
+	}
+
+	// The transfer is recorded before publishing so that it is known when
+	// the wallet is notified of the transaction.
+	var transferKey []byte
+	recordTransfer := func(tx *wire.MsgTx) error {
+		txHash := tx.TxHash()
+		transferKey = []byte(transferPrefix + txHash.String())
+		return lw.writeMetadata(transferKey, serializeTransfer(fromAccount, toAccount))
+	}
+	txHash, _, err := lw.sendToAddress(privPass, addr, amount, fromAccount, transferRequiredConfs,
+		sendAll, recordTransfer)
+	if err != nil {
+		if transferKey != nil {
+			if err := lw.deleteMetadata(transferKey); err != nil {
+				log.Error(err)
+			}
+		}
+		return nil, translateError(err)
+	}
+	return txHash, nil
+}
+
+func serializeTransfer(fromAccount, toAccount int32) []byte {
+	v := make([]byte, 8)
+	binary.LittleEndian.PutUint32(v, uint32(fromAccount))
+	binary.LittleEndian.PutUint32(v[4:], uint32(toAccount))
+	return v
+}
+
+// applyTransfer sets the accounts of tx if it was made by
+// TransferBetweenAccounts.  Its direction and amount are those found by
+// classifyTransaction.
+func (lw *LibWallet) applyTransfer(tx *Transaction) {
+	v, err := lw.readMetadata([]byte(transferPrefix + tx.Hash))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if len(v) != 8 {
+		return
+	}
+	tx.FromAccount = int32(binary.LittleEndian.Uint32(v))
+	tx.ToAccount = int32(binary.LittleEndian.Uint32(v[4:]))
+	tx.FromAccountName = lw.accountName(tx.FromAccount)
+	tx.ToAccountName = lw.accountName(tx.ToAccount)
+}
@@ -0,0 +1,493 @@
+// Copyright (c) 2018 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package walletdbtest provides a conformance suite for walletdb drivers.
+// Drivers call TestInterface from their own tests with a fresh database so that
+// every driver is held to the same contract, including behavior that the bdb
+// driver provides through bolt and other drivers must reimplement.
+package walletdbtest
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/decred/dcrwallet/errors"
+	"github.com/decred/dcrwallet/wallet/walletdb"
+)
+
+// Tester is implemented by *testing.T.  It allows the suite to be used without
+// importing the testing package into non-test code.
+type Tester interface {
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// errSubTestFail signals that a check has already reported a failure.
+var errSubTestFail = errors.New("sub test failure")
+
+type testContext struct {
+	t  Tester
+	db walletdb.DB
+}
+
+// errorf reports a failure and returns errSubTestFail to end the sub test.
+func (tc *testContext) errorf(format string, args ...interface{}) error {
+	tc.t.Errorf(format, args...)
+	return errSubTestFail
+}
+
+// TestInterface creates a database of type dbType with args and checks that it
+// implements the walletdb interface contract.  The database is closed before
+// returning.
+func TestInterface(t Tester, dbType string, args ...interface{}) {
+	db, err := walletdb.Create(dbType, args...)
+	if err != nil {
+		t.Fatalf("Failed to create %s database: %v", dbType, err)
+	}
+	defer db.Close()
+
+	tc := &testContext{t: t, db: db}
+	tests := []struct {
+		name string
+		f    func(*testContext) error
+	}{
+		{"nested bucket isolation", testNestedBucketIsolation},
+		{"cursor ordering", testCursorOrdering},
+		{"cursor delete", testCursorDelete},
+		{"rollback", testRollback},
+		{"read-only transactions", testReadOnly},
+		{"top-level bucket deletion", testDeleteTopLevelBucket},
+	}
+	for _, test := range tests {
+		err := test.f(tc)
+		if err != nil && err != errSubTestFail {
+			t.Errorf("%s: %s: unexpected error: %v", dbType, test.name, err)
+		}
+	}
+}
+
+// bucketContents returns every key of b mapped to its value, with nested
+// buckets recorded as "<bucket>".
+func bucketContents(b walletdb.ReadBucket) (map[string]string, error) {
+	m := make(map[string]string)
+	err := b.ForEach(func(k, v []byte) error {
+		if v == nil && b.NestedReadBucket(k) != nil {
+			m[string(k)] = "<bucket>"
+			return nil
+		}
+		m[string(k)] = string(v)
+		return nil
+	})
+	return m, err
+}
+
+func checkContents(tc *testContext, desc string, b walletdb.ReadBucket, want map[string]string) error {
+	got, err := bucketContents(b)
+	if err != nil {
+		return err
+	}
+	if len(got) != len(want) {
+		return tc.errorf("%s: ForEach returned %d keys %v, want %d keys %v",
+			desc, len(got), got, len(want), want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			return tc.errorf("%s: key %q has value %q, want %q", desc, k, got[k], v)
+		}
+	}
+	return nil
+}
+
+// testNestedBucketIsolation checks that keys and buckets whose names share a
+// prefix, or that concatenate to the same bytes, never see each other.
+func testNestedBucketIsolation(tc *testContext) error {
+	return walletdb.Update(tc.db, func(tx walletdb.ReadWriteTx) error {
+		top, err := tx.CreateTopLevelBucket([]byte("isolation"))
+		if err != nil {
+			return err
+		}
+		a, err := top.CreateBucket([]byte("a"))
+		if err != nil {
+			return err
+		}
+		ab, err := top.CreateBucket([]byte("ab"))
+		if err != nil {
+			return err
+		}
+		if err := a.Put([]byte("bc"), []byte("a/bc")); err != nil {
+			return err
+		}
+		if err := ab.Put([]byte("c"), []byte("ab/c")); err != nil {
+			return err
+		}
+		if err := top.Put([]byte("abc"), []byte("abc")); err != nil {
+			return err
+		}
+
+		if err := checkContents(tc, "bucket a", a, map[string]string{"bc": "a/bc"}); err != nil {
+			return err
+		}
+		if err := checkContents(tc, "bucket ab", ab, map[string]string{"c": "ab/c"}); err != nil {
+			return err
+		}
+		err = checkContents(tc, "parent bucket", top, map[string]string{
+			"a": "<bucket>", "ab": "<bucket>", "abc": "abc",
+		})
+		if err != nil {
+			return err
+		}
+
+		if v := top.Get([]byte("a")); v != nil {
+			return tc.errorf("Get of a nested bucket key returned %q, want nil", v)
+		}
+		if top.NestedReadBucket([]byte("abc")) != nil {
+			return tc.errorf("NestedReadBucket of a value key returned a bucket")
+		}
+		if top.NestedReadBucket([]byte("missing")) != nil {
+			return tc.errorf("NestedReadBucket of a missing key returned a bucket")
+		}
+		if v := a.Get([]byte("c")); v != nil {
+			return tc.errorf("bucket a returned %q for a key of bucket ab", v)
+		}
+
+		_, err = top.CreateBucket([]byte("a"))
+		if !errors.Is(errors.Exist, err) {
+			return tc.errorf("CreateBucket of an existing bucket: got %v, want Exist", err)
+		}
+		_, err = top.CreateBucket(nil)
+		if !errors.Is(errors.Invalid, err) {
+			return tc.errorf("CreateBucket with an empty key: got %v, want Invalid", err)
+		}
+		if _, err := top.CreateBucketIfNotExists([]byte("a")); err != nil {
+			return tc.errorf("CreateBucketIfNotExists of an existing bucket: %v", err)
+		}
+
+		// Deleting a bucket removes everything nested in it, and nothing
+		// else.
+		deep, err := a.CreateBucket([]byte("deep"))
+		if err != nil {
+			return err
+		}
+		if err := deep.Put([]byte("k"), []byte("v")); err != nil {
+			return err
+		}
+		if err := top.DeleteNestedBucket([]byte("a")); err != nil {
+			return err
+		}
+		err = top.DeleteNestedBucket([]byte("a"))
+		if !errors.Is(errors.NotExist, err) {
+			return tc.errorf("DeleteNestedBucket of a missing bucket: got %v, want NotExist", err)
+		}
+		err = checkContents(tc, "parent bucket after delete", top, map[string]string{
+			"ab": "<bucket>", "abc": "abc",
+		})
+		if err != nil {
+			return err
+		}
+		if err := checkContents(tc, "bucket ab after delete", ab, map[string]string{"c": "ab/c"}); err != nil {
+			return err
+		}
+		a, err = top.CreateBucket([]byte("a"))
+		if err != nil {
+			return err
+		}
+		return checkContents(tc, "recreated bucket a", a, map[string]string{})
+	})
+}
+
+type kv struct {
+	k, v string
+}
+
+func cursorPair(k, v []byte) kv {
+	if k == nil {
+		return kv{"<nil>", ""}
+	}
+	if v == nil {
+		return kv{string(k), "<bucket>"}
+	}
+	return kv{string(k), string(v)}
+}
+
+// testCursorOrdering checks that cursors visit keys and nested buckets in byte
+// order in both directions, and that Seek finds the first key at or after the
+// seek key.
+func testCursorOrdering(tc *testContext) error {
+	return walletdb.Update(tc.db, func(tx walletdb.ReadWriteTx) error {
+		top, err := tx.CreateTopLevelBucket([]byte("cursor"))
+		if err != nil {
+			return err
+		}
+		want := []kv{
+			{"a", "1"}, {"b", "<bucket>"}, {"b\x00", "2"}, {"ba", "3"},
+			{"c", "4"}, {"d", "<bucket>"}, {"e", "5"},
+		}
+		// Insert out of order.
+		for _, i := range []int{4, 0, 6, 2, 3} {
+			if err := top.Put([]byte(want[i].k), []byte(want[i].v)); err != nil {
+				return err
+			}
+		}
+		b, err := top.CreateBucket([]byte("b"))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("0"), []byte("nested")); err != nil {
+			return err
+		}
+		if _, err := top.CreateBucket([]byte("d")); err != nil {
+			return err
+		}
+
+		c := top.ReadCursor()
+		defer c.Close()
+
+		var got []kv
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			got = append(got, cursorPair(k, v))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			return tc.errorf("forward iteration: got %v, want %v", got, want)
+		}
+
+		got = got[:0]
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			got = append(got, cursorPair(k, v))
+		}
+		var reversed []kv
+		for i := len(want) - 1; i >= 0; i-- {
+			reversed = append(reversed, want[i])
+		}
+		if fmt.Sprint(got) != fmt.Sprint(reversed) {
+			return tc.errorf("reverse iteration: got %v, want %v", got, reversed)
+		}
+
+		seeks := []struct {
+			seek string
+			want kv
+		}{
+			{"c", kv{"c", "4"}},
+			{"b\x00\x00", kv{"ba", "3"}},
+			{"bb", kv{"c", "4"}},
+			{"\x00", kv{"a", "1"}},
+			{"f", kv{"<nil>", ""}},
+		}
+		for _, s := range seeks {
+			if got := cursorPair(c.Seek([]byte(s.seek))); got != s.want {
+				return tc.errorf("Seek(%q): got %v, want %v", s.seek, got, s.want)
+			}
+		}
+		if got := cursorPair(c.Seek([]byte("c"))); got != (kv{"c", "4"}) {
+			return tc.errorf("Seek(\"c\"): got %v", got)
+		}
+		if got := cursorPair(c.Next()); got != (kv{"d", "<bucket>"}) {
+			return tc.errorf("Next after Seek: got %v, want d", got)
+		}
+		return nil
+	})
+}
+
+// testCursorDelete checks that keys may be deleted through a cursor while
+// iterating, and that a cursor cannot delete a nested bucket.  bolt may skip the
+// key after a deleted one when Next is called
+// (https://github.com/boltdb/bolt/issues/620), so iteration resumes with a
+// Seek to the deleted key, which every driver must support.
+func testCursorDelete(tc *testContext) error {
+	return walletdb.Update(tc.db, func(tx walletdb.ReadWriteTx) error {
+		top, err := tx.CreateTopLevelBucket([]byte("cursordelete"))
+		if err != nil {
+			return err
+		}
+		remaining := make(map[string]string)
+		for i := 0; i < 10; i++ {
+			k := fmt.Sprintf("k%d", i)
+			if err := top.Put([]byte(k), []byte(k)); err != nil {
+				return err
+			}
+			if i%2 == 1 {
+				remaining[k] = k
+			}
+		}
+		if _, err := top.CreateBucket([]byte("k5b")); err != nil {
+			return err
+		}
+		remaining["k5b"] = "<bucket>"
+
+		c := top.ReadWriteCursor()
+		defer c.Close()
+		var visited int
+		k, v := c.First()
+		for k != nil {
+			visited++
+			if v == nil {
+				if err := c.Delete(); !errors.Is(errors.Invalid, err) {
+					return tc.errorf("cursor Delete of a nested bucket: got %v, want Invalid", err)
+				}
+				k, v = c.Next()
+				continue
+			}
+			var i int
+			fmt.Sscanf(string(k), "k%d", &i)
+			if i%2 == 1 {
+				k, v = c.Next()
+				continue
+			}
+			deleted := append([]byte{}, k...)
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			k, v = c.Seek(deleted)
+			if bytes.Equal(k, deleted) {
+				return tc.errorf("Seek found the deleted key %q", k)
+			}
+		}
+		if visited != 11 {
+			return tc.errorf("iteration while deleting visited %d keys, want 11", visited)
+		}
+		return checkContents(tc, "bucket after cursor deletes", top, remaining)
+	})
+}
+
+// testRollback checks that changes are discarded by an explicit rollback and
+// by a failed update, and kept by a commit.
+func testRollback(tc *testContext) error {
+	err := walletdb.Update(tc.db, func(tx walletdb.ReadWriteTx) error {
+		top, err := tx.CreateTopLevelBucket([]byte("rollback"))
+		if err != nil {
+			return err
+		}
+		return top.Put([]byte("committed"), []byte("1"))
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := tc.db.BeginReadWriteTx()
+	if err != nil {
+		return err
+	}
+	top := tx.ReadWriteBucket([]byte("rollback"))
+	if top == nil {
+		tx.Rollback()
+		return tc.errorf("committed top-level bucket is missing")
+	}
+	if err := top.Put([]byte("rolledback"), []byte("2")); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := top.Delete([]byte("committed")); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := top.CreateBucket([]byte("nested")); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.CreateTopLevelBucket([]byte("rollbacktop")); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Rollback(); err != nil {
+		return err
+	}
+
+	errUpdate := errors.New("update failed")
+	err = walletdb.Update(tc.db, func(tx walletdb.ReadWriteTx) error {
+		if err := tx.ReadWriteBucket([]byte("rollback")).Put([]byte("failed"), []byte("3")); err != nil {
+			return err
+		}
+		return errUpdate
+	})
+	if err != errUpdate {
+		return tc.errorf("Update returned %v, want %v", err, errUpdate)
+	}
+
+	return walletdb.View(tc.db, func(tx walletdb.ReadTx) error {
+		if tx.ReadBucket([]byte("rollbacktop")) != nil {
+			return tc.errorf("rolled back top-level bucket exists")
+		}
+		return checkContents(tc, "bucket after rollback", tx.ReadBucket([]byte("rollback")),
+			map[string]string{"committed": "1"})
+	})
+}
+
+// testReadOnly checks that read transactions reject writes.
+func testReadOnly(tc *testContext) error {
+	err := walletdb.Update(tc.db, func(tx walletdb.ReadWriteTx) error {
+		_, err := tx.CreateTopLevelBucket([]byte("readonly"))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return walletdb.View(tc.db, func(tx walletdb.ReadTx) error {
+		b, ok := tx.ReadBucket([]byte("readonly")).(walletdb.ReadWriteBucket)
+		if !ok {
+			return nil
+		}
+		if err := b.Put([]byte("k"), []byte("v")); err == nil {
+			return tc.errorf("Put succeeded in a read transaction")
+		}
+		if _, err := b.CreateBucket([]byte("b")); err == nil {
+			return tc.errorf("CreateBucket succeeded in a read transaction")
+		}
+		return nil
+	})
+}
+
+// testDeleteTopLevelBucket checks that deleting a top-level bucket removes it
+// and everything nested in it without touching buckets that share its prefix.
+func testDeleteTopLevelBucket(tc *testContext) error {
+	err := walletdb.Update(tc.db, func(tx walletdb.ReadWriteTx) error {
+		for _, name := range []string{"del", "delete"} {
+			top, err := tx.CreateTopLevelBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			if err := top.Put([]byte("k"), []byte(name)); err != nil {
+				return err
+			}
+			nested, err := top.CreateBucket([]byte("nested"))
+			if err != nil {
+				return err
+			}
+			if err := nested.Put([]byte("k"), []byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = walletdb.Update(tc.db, func(tx walletdb.ReadWriteTx) error {
+		return tx.DeleteTopLevelBucket([]byte("del"))
+	})
+	if err != nil {
+		return err
+	}
+	err = walletdb.Update(tc.db, func(tx walletdb.ReadWriteTx) error {
+		return tx.DeleteTopLevelBucket([]byte("del"))
+	})
+	if !errors.Is(errors.NotExist, err) {
+		return tc.errorf("DeleteTopLevelBucket of a missing bucket: got %v, want NotExist", err)
+	}
+
+	return walletdb.View(tc.db, func(tx walletdb.ReadTx) error {
+		if tx.ReadBucket([]byte("del")) != nil {
+			return tc.errorf("deleted top-level bucket exists")
+		}
+		top := tx.ReadBucket([]byte("delete"))
+		if top == nil {
+			return tc.errorf("top-level bucket sharing a prefix was deleted")
+		}
+		nested := top.NestedReadBucket([]byte("nested"))
+		if nested == nil || !bytes.Equal(nested.Get([]byte("k")), []byte("delete")) {
+			return tc.errorf("nested bucket of a top-level bucket sharing a prefix was modified")
+		}
+		return checkContents(tc, "top-level bucket sharing a prefix", top,
+			map[string]string{"k": "delete", "nested": "<bucket>"})
+	})
+}
@@ -0,0 +1,108 @@
+package mobilewallet
+
+import (
+	"context"
+	"strings"
+
+	"github.com/decred/dcrwallet/errors"
+)
+
+// WalletError is the error returned by LibWallet methods.  Code is one of the
+// Err constants and is also returned by Error, so apps can keep matching
+// errors by their message.  Kind is the dcrwallet errors.Kind the error was
+// classified with by the wallet, or 0 (unclassified) if it did not come from
+// dcrwallet, and Op is the wallet operation that failed, if known.  Message
+// describes the error and is meant for logs and error reports rather than
+// being matched.  SyncForDuration is the exception: synchronization failures
+// are reported as a SyncError, as they are to SpvSyncResponse.
+type WalletError struct {
+	Code    string
+	Kind    int32
+	Op      string
+	Message string
+}
+
+func (e *WalletError) Error() string {
+	return e.Code
+}
+
+// kindCodes maps every dcrwallet error kind to the code of the WalletError it
+// is reported as.
+var kindCodes = map[errors.Kind]string{
+	errors.Other:               ErrUnknown,
+	errors.Bug:                 ErrInternal,
+	errors.Invalid:             ErrInvalid,
+	errors.Permission:          ErrPermission,
+	errors.IO:                  ErrIO,
+	errors.Exist:               ErrExist,
+	errors.NotExist:            ErrNotExist,
+	errors.Encoding:            ErrEncoding,
+	errors.Crypto:              ErrCrypto,
+	errors.Locked:              ErrLocked,
+	errors.Passphrase:          ErrInvalidPassphrase,
+	errors.Seed:                ErrInvalidSeed,
+	errors.WatchingOnly:        ErrWatchingOnly,
+	errors.InsufficientBalance: ErrInsufficientBalance,
+	errors.ScriptFailure:       ErrScriptFailure,
+	errors.Policy:              ErrPolicy,
+	errors.Consensus:           ErrConsensus,
+	errors.DoubleSpend:         ErrDoubleSpend,
+	errors.Protocol:            ErrProtocol,
+	errors.NoPeers:             ErrNoPeers,
+	errors.Deployment:          ErrDeployment,
+}
+
+// newWalletError returns a WalletError with a code and no underlying wallet
+// error.
+func newWalletError(code string) error {
+	return &WalletError{
+		Code:    code,
+		Message: strings.Replace(code, "_", " ", -1),
+	}
+}
+
+// translateError returns err as a WalletError.  Errors of dcrwallet are
+// reported with the code of their kind; other errors are unknown unless they
+// are cancellations.
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err, ok := err.(*WalletError); ok {
+		return err
+	}
+
+	walletErr := &WalletError{
+		Code:    ErrUnknown,
+		Message: err.Error(),
+	}
+	if e, ok := err.(*errors.Error); ok {
+		kind, op := errorKindOp(e)
+		walletErr.Kind = int32(kind)
+		walletErr.Op = string(op)
+		if code, ok := kindCodes[kind]; ok {
+			walletErr.Code = code
+		}
+	}
+	if hasError(err, isError(context.Canceled)) {
+		walletErr.Code = ErrContextCanceled
+	}
+	return walletErr
+}
+
+// errorKindOp returns the first classified kind and the outermost operation of
+// a wallet error and the errors nested in it.
+func errorKindOp(e *errors.Error) (errors.Kind, errors.Op) {
+	kind := errors.Other
+	var op errors.Op
+	for e != nil {
+		if op == "" {
+			op = e.Op
+		}
+		if kind == errors.Other {
+			kind = e.Kind
+		}
+		e, _ = e.Err.(*errors.Error)
+	}
+	return kind, op
+}
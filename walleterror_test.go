@@ -0,0 +1,49 @@
+package mobilewallet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/decred/dcrwallet/errors"
+)
+
+// TestKindCodes checks that every dcrwallet error kind is reported with a code
+// of its own.  Kinds are numbered from errors.Other, and kinds unknown to the
+// errors package are described as "unknown error kind", so the loop also finds
+// kinds added by later versions of dcrwallet.
+func TestKindCodes(t *testing.T) {
+	unknown := errors.Kind(-1).String()
+	kinds := 0
+	for k := errors.Other; k.String() != unknown; k++ {
+		kinds++
+		code, ok := kindCodes[k]
+		if !ok {
+			t.Errorf("kind %d (%v) is not mapped to a code", k, k)
+			continue
+		}
+		// Errors with no nested error must not be mistaken for
+		// cancellations.
+		err := translateError(errors.E(errors.Op("op"), k))
+		walletErr, ok := err.(*WalletError)
+		if !ok {
+			t.Errorf("kind %v translated to %T", k, err)
+			continue
+		}
+		if walletErr.Code != code || walletErr.Kind != int32(k) || walletErr.Op != "op" {
+			t.Errorf("kind %v translated to %+v", k, *walletErr)
+		}
+	}
+	if kinds <= int(errors.Deployment) {
+		t.Errorf("only %d kinds checked", kinds)
+	}
+	if len(kindCodes) != kinds {
+		t.Errorf("kindCodes maps %d kinds, errors has %d", len(kindCodes), kinds)
+	}
+}
+
+func TestTranslateCanceled(t *testing.T) {
+	err := translateError(errors.E(errors.Op("op"), errors.IO, context.Canceled))
+	if code := err.(*WalletError).Code; code != ErrContextCanceled {
+		t.Errorf("cancellation translated to code %q", code)
+	}
+}
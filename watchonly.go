@@ -0,0 +1,94 @@
+package mobilewallet
+
+import (
+	"encoding/json"
+
+	"github.com/decred/dcrd/hdkeychain"
+	"github.com/decred/dcrwallet/wallet"
+)
+
+// AccountExport is the payload produced by ExportAccount.  It is meant to be
+// shown as a QR code and read by another LibWallet with
+// CreateWatchingOnlyWallet.
+type AccountExport struct {
+	Network        string
+	Account        int32
+	AccountName    string
+	ExtendedPubKey string
+}
+
+// AccountExtendedPubKey returns the extended public key of an account, encoded
+// for the active network.  Every address of the account can be derived from it,
+// so it should only be shared with services trusted with the account's
+// history.
+func (lw *LibWallet) AccountExtendedPubKey(account int32) (string, error) {
+	if _, ok := lw.loader.LoadedWallet(); !ok {
+		return "", newWalletError(ErrWalletNotLoaded)
+	}
+	xpub, err := lw.wallet.MasterPubKey(uint32(account))
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return xpub.String(), nil
+}
+
+// ExportAccount returns the JSON encoded AccountExport of an account.
+func (lw *LibWallet) ExportAccount(account int32) (string, error) {
+	xpub, err := lw.AccountExtendedPubKey(account)
+	if err != nil {
+		return "", translateError(err)
+	}
+	name, err := lw.wallet.AccountName(uint32(account))
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	export := &AccountExport{
+		Network:        lw.activeNet.Name,
+		Account:        account,
+		AccountName:    name,
+		ExtendedPubKey: xpub,
+	}
+	result, err := json.Marshal(export)
+	if err != nil {
+		log.Error(err)
+		return "", translateError(err)
+	}
+	return string(result), nil
+}
+
+// CreateWatchingOnlyWallet creates a wallet that watches the account exported
+// by ExportAccount, or the account of an extended public key returned by
+// AccountExtendedPubKey.  The watched account becomes the default account of
+// the new wallet: the account number and name of the export are not kept, so
+// account 0 of the new wallet derives the addresses of the exported account
+// whatever its number.  A watching-only wallet tracks balances and hands out
+// addresses but cannot sign transactions.
+func (lw *LibWallet) CreateWatchingOnlyWallet(exportPayload string, pubPass []byte) error {
+	xpub := exportPayload
+	var export AccountExport
+	if err := json.Unmarshal([]byte(exportPayload), &export); err == nil {
+		if export.Network != lw.activeNet.Name {
+			return newWalletError(ErrInvalid)
+		}
+		xpub = export.ExtendedPubKey
+	}
+
+	key, err := hdkeychain.NewKeyFromString(xpub)
+	if err != nil || key.IsPrivate() || !key.IsForNet(lw.activeNet.Params) {
+		return newWalletError(ErrInvalid)
+	}
+
+	if len(pubPass) == 0 {
+		pubPass = []byte(wallet.InsecurePubPassphrase)
+	}
+	w, err := lw.loader.CreateWatchingOnlyWallet(xpub, pubPass)
+	if err != nil {
+		log.Error(err)
+		return translateError(err)
+	}
+	lw.wallet = w
+	log.Info("Created watching-only wallet")
+	return nil
+}
@@ -0,0 +1,59 @@
+package mobilewallet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWatchExportedAccount(t *testing.T) {
+	lw, dir := newTestWallet(t, "bdb")
+	defer os.RemoveAll(dir)
+	defer lw.CloseWallet()
+
+	if err := lw.NextAccount("savings", []byte("private")); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := lw.ExportAccount(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export AccountExport
+	if err := json.Unmarshal([]byte(payload), &export); err != nil {
+		t.Fatal(err)
+	}
+	if export.Account != 1 || export.AccountName != "savings" || export.Network != lw.activeNet.Name {
+		t.Errorf("unexpected export %+v", export)
+	}
+	address, err := lw.CurrentAddress(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watchDir, err := ioutil.TempDir("", "mobilewallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(watchDir)
+	mainnet := NewLibWallet(watchDir, "bdb", "mainnet")
+	mainnet.InitLoader()
+	err = mainnet.CreateWatchingOnlyWallet(payload, nil)
+	checkWalletErrorCode(t, "watching an account of another network ", err, ErrInvalid)
+
+	watch := NewLibWallet(watchDir, "bdb", "testnet3")
+	watch.InitLoader()
+	if err := watch.CreateWatchingOnlyWallet(payload, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer watch.CloseWallet()
+
+	// The exported account is watched as the default account.
+	xpub, err := watch.AccountExtendedPubKey(0)
+	if err != nil || xpub != export.ExtendedPubKey {
+		t.Errorf("watched account has extended public key %s (%v), want %s", xpub, err, export.ExtendedPubKey)
+	}
+	if got, err := watch.CurrentAddress(0); err != nil || got != address {
+		t.Errorf("watched account has current address %s (%v), want %s", got, err, address)
+	}
+}